@@ -0,0 +1,340 @@
+package admin
+
+import (
+	"bufio"
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/storage"
+	"chat-app/internal/text"
+	"chat-app/internal/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `Usage: go run main.go -app=admin <command> [arguments]
+
+Commands:
+  create-admin <username>             Create an administrator, the password is read from stdin
+  promote <username>                  Grant the admin role to an existing user
+  demote <username>                   Take the admin role away
+  users [search]                      List users, optionally those whose username contains search
+  disable <username>                  Disable an account and end its sessions
+  enable <username>                   Enable a disabled account
+  reset-password <username>           Set a generated password and end the user's sessions
+  rename-chatroom <id> <name>         Rename a chatroom
+  archive-chatroom <id>               Archive a chatroom, it keeps its history but takes no new messages
+  unarchive-chatroom <id>             Bring an archived chatroom back
+  retention <id> <policy>             Set how long a chatroom keeps its messages: forever, days=N or messages=N
+  legal-hold <id> on|off              Place a chatroom under legal hold, exempting it from retention, or lift it
+  claim-text-room <room> <username>   Make a user the owner of a text room from before ownership
+  stats                               Show system stats`
+
+type command struct {
+	args int // Number of required arguments
+	run  func(c *cli, ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin": {1, (*cli).createAdmin},
+	"promote": {1, func(c *cli, ctx context.Context, args []string) error {
+		return c.setRole(ctx, args[0], repository.RoleAdmin)
+	}},
+	"demote": {1, func(c *cli, ctx context.Context, args []string) error {
+		return c.setRole(ctx, args[0], repository.RoleUser)
+	}},
+	"users":              {0, (*cli).listUsers},
+	"disable":            {1, func(c *cli, ctx context.Context, args []string) error { return c.setDisabled(ctx, args[0], true) }},
+	"enable":             {1, func(c *cli, ctx context.Context, args []string) error { return c.setDisabled(ctx, args[0], false) }},
+	"reset-password":     {1, (*cli).resetPassword},
+	"rename-chatroom":    {2, (*cli).renameChatroom},
+	"archive-chatroom":   {1, func(c *cli, ctx context.Context, args []string) error { return c.setArchived(ctx, args[0], true) }},
+	"unarchive-chatroom": {1, func(c *cli, ctx context.Context, args []string) error { return c.setArchived(ctx, args[0], false) }},
+	"retention":          {2, (*cli).setRetention},
+	"legal-hold":         {2, (*cli).setLegalHold},
+	"claim-text-room":    {2, (*cli).claimTextRoom},
+	"stats":              {0, (*cli).stats},
+}
+
+// cli runs administration commands straight against the database, it is how the first administrator gets created
+type cli struct {
+	users     *repository.UserRepository
+	chatrooms *repository.ChatroomRepository
+	admin     *repository.AdminRepository
+	retention *repository.RetentionRepository
+	db        *sql.DB // Text rooms have no repository, their package queries the database itself
+	in        io.Reader
+	out       io.Writer
+}
+
+// RunAdminCommand runs one command, args are what follows the flags on the command line
+func RunAdminCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return errors.New("no command given")
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok || len(args)-1 < cmd.args {
+		fmt.Println(usage)
+		return fmt.Errorf("invalid command %q", strings.Join(args, " "))
+	}
+
+	db, err := storage.SetupDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	c := &cli{
+		users:     repository.NewUserRepository(db.Conn),
+		chatrooms: repository.NewChatroomRepository(db.Conn),
+		admin:     repository.NewAdminRepository(db.Conn),
+		retention: repository.NewRetentionRepository(db.Conn),
+		db:        db.Conn,
+		in:        os.Stdin,
+		out:       os.Stdout,
+	}
+	return cmd.run(c, context.Background(), args[1:])
+}
+
+func (c *cli) userID(ctx context.Context, username string) (int, error) {
+	userIDs, err := c.users.GetUserIDsByUsernames(ctx, []string{username})
+	if err != nil {
+		return 0, err
+	}
+
+	userID, ok := userIDs[strings.ToLower(username)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", repository.ErrUserNotFound, username)
+	}
+	return userID, nil
+}
+
+// createAdmin reads the password from the first line of stdin, so it stays out of the shell history
+func (c *cli) createAdmin(ctx context.Context, args []string) error {
+	username := args[0]
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(c.in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if err := auth.ValidateCredentials(username, password); err != nil {
+		return err
+	}
+	if err := c.users.Register(ctx, username, password); err != nil {
+		return err
+	}
+
+	if err := c.setRole(ctx, username, repository.RoleAdmin); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Created administrator %s\n", username)
+	return nil
+}
+
+func (c *cli) setRole(ctx context.Context, username, role string) error {
+	userID, err := c.userID(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := c.users.SetRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s now has the %s role\n", username, role)
+	return nil
+}
+
+func (c *cli) listUsers(ctx context.Context, args []string) error {
+	query := repository.UserQuery{Limit: 100}
+	if len(args) > 0 {
+		query.Search = args[0]
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tCREATED\tDISABLED")
+	for {
+		users, err := c.users.ListUsers(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			disabled := ""
+			if user.DisabledAt != nil {
+				disabled = user.DisabledAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", user.ID, user.Username, user.Role, user.CreatedAt.Format(time.DateTime), disabled)
+		}
+
+		if len(users) < query.Limit {
+			return w.Flush()
+		}
+		query.After = users[len(users)-1].ID
+	}
+}
+
+func (c *cli) setDisabled(ctx context.Context, username string, disabled bool) error {
+	userID, err := c.userID(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err := c.users.SetDisabled(ctx, userID, disabled); err != nil {
+		return err
+	}
+
+	// Requests are refused right away, open WebSocket connections of the user last until they reconnect
+	if disabled {
+		fmt.Fprintf(c.out, "Disabled %s\n", username)
+	} else {
+		fmt.Fprintf(c.out, "Enabled %s\n", username)
+	}
+	return nil
+}
+
+func (c *cli) resetPassword(ctx context.Context, args []string) error {
+	userID, err := c.userID(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	password, err := auth.NewTemporaryPassword()
+	if err != nil {
+		return err
+	}
+	if err := c.users.SetPassword(ctx, userID, password); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "New password for %s: %s\n", args[0], password)
+	return nil
+}
+
+func (c *cli) renameChatroom(ctx context.Context, args []string) error {
+	chatroomID, err := utils.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid chatroom id %q", args[0])
+	}
+
+	name := strings.TrimSpace(strings.Join(args[1:], " "))
+	if err := c.chatrooms.RenameChatroom(ctx, chatroomID, name); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Renamed chatroom %d to %s\n", chatroomID, name)
+	return nil
+}
+
+func (c *cli) setArchived(ctx context.Context, rawID string, archived bool) error {
+	chatroomID, err := utils.Atoi(rawID)
+	if err != nil {
+		return fmt.Errorf("invalid chatroom id %q", rawID)
+	}
+	if err := c.chatrooms.SetArchived(ctx, chatroomID, archived); err != nil {
+		return err
+	}
+
+	if archived {
+		fmt.Fprintf(c.out, "Archived chatroom %d\n", chatroomID)
+	} else {
+		fmt.Fprintf(c.out, "Unarchived chatroom %d\n", chatroomID)
+	}
+	return nil
+}
+
+func (c *cli) setRetention(ctx context.Context, args []string) error {
+	chatroomID, err := utils.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid chatroom id %q", args[0])
+	}
+
+	var policy repository.RetentionPolicy
+	if args[1] != "forever" {
+		kind, rawLimit, _ := strings.Cut(args[1], "=")
+		limit, err := utils.Atoi(rawLimit)
+		if err != nil {
+			return fmt.Errorf("invalid retention policy %q", args[1])
+		}
+		switch kind {
+		case "days":
+			policy.Days = &limit
+		case "messages":
+			policy.Messages = &limit
+		default:
+			return fmt.Errorf("invalid retention policy %q", args[1])
+		}
+	}
+	if err := c.retention.SetPolicy(ctx, chatroomID, policy); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "Chatroom %d now keeps its messages %s\n", chatroomID, describePolicy(policy))
+	return nil
+}
+
+func describePolicy(policy repository.RetentionPolicy) string {
+	switch {
+	case policy.Days != nil:
+		return fmt.Sprintf("for %d days", *policy.Days)
+	case policy.Messages != nil:
+		return fmt.Sprintf("up to the last %d messages", *policy.Messages)
+	default:
+		return "forever"
+	}
+}
+
+func (c *cli) setLegalHold(ctx context.Context, args []string) error {
+	chatroomID, err := utils.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid chatroom id %q", args[0])
+	}
+	if args[1] != "on" && args[1] != "off" {
+		return fmt.Errorf("invalid legal hold %q, expected on or off", args[1])
+	}
+	held := args[1] == "on"
+	if err := c.retention.SetLegalHold(ctx, chatroomID, held); err != nil {
+		return err
+	}
+
+	if held {
+		fmt.Fprintf(c.out, "Chatroom %d is under legal hold\n", chatroomID)
+	} else {
+		fmt.Fprintf(c.out, "Lifted the legal hold on chatroom %d\n", chatroomID)
+	}
+	return nil
+}
+
+func (c *cli) claimTextRoom(ctx context.Context, args []string) error {
+	userID, err := c.userID(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	if err := text.ClaimRoom(ctx, c.db, args[0], userID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s now owns text room %s\n", args[1], args[0])
+	return nil
+}
+
+func (c *cli) stats(ctx context.Context, _ []string) error {
+	stats, err := c.admin.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
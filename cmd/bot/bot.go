@@ -2,8 +2,16 @@ package bot
 
 import (
 	"chat-app/internal/bot"
+	"chat-app/internal/health"
+	"chat-app/internal/logging"
 	"chat-app/internal/messaging"
-	"log"
+	"chat-app/internal/metrics"
+	"chat-app/internal/unfurl"
+	"chat-app/internal/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
 )
 
 var botRabbitMQ *messaging.RabbitMQ
@@ -11,13 +19,38 @@ var botRabbitMQ *messaging.RabbitMQ
 func RunBotServer() error {
 	var err error
 
-	botRabbitMQ, err = messaging.SetupRabbitMQ("stock_requests", "stock_responses")
+	botRabbitMQ, err = messaging.SetupRabbitMQ("stock_requests", "stock_responses", "link_preview_requests", "link_preview_responses")
 	if err != nil {
-		log.Fatal("RabbitMQ setup failed:", err)
+		logging.Fatal("RabbitMQ setup failed", "error", err)
 	}
 	defer botRabbitMQ.Close()
 
+	checker := health.NewChecker("bot")
+	checker.Add("rabbitmq", botRabbitMQ.Check)
+	go serveHTTP(utils.GetEnv("BOT_HTTP_ADDR", ":8081"), checker)
+
+	go bot.ConsumeLinkPreviewRequests(botRabbitMQ, unfurl.NewFetcher())
 	bot.ConsumeStockRequests(botRabbitMQ)
 
 	return nil
 }
+
+// serveHTTP runs the bot's own small admin HTTP server, it has no API and only exposes the metrics and health checks
+func serveHTTP(addr string, checker *health.Checker) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	checker.Register(mux)
+
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      metrics.Middleware(mux),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  15 * time.Second,
+	}
+
+	slog.Info("Bot HTTP server is running", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logging.Fatal("Failed to start bot HTTP server", "error", err)
+	}
+}
@@ -0,0 +1,432 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+	maxChatroomNameBytes = 255
+)
+
+var startedAt = time.Now()
+
+// accountDisabled answers 403 for accounts an administrator disabled. Sign-ins check it once the credentials are
+// known to be right, so the answer tells nothing to someone guessing passwords.
+func accountDisabled(ctx context.Context, w http.ResponseWriter, userID int) bool {
+	err := userRepo.CheckSession(ctx, userID, time.Time{})
+	if errors.Is(err, repository.ErrAccountDisabled) {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return true
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Failed to check account", "error", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return true
+	}
+	return false
+}
+
+// requireAdmin answers 403 unless the user is an administrator
+func requireAdmin(w http.ResponseWriter, r *http.Request, userID int) bool {
+	isAdmin, err := userRepo.IsAdmin(r.Context(), userID)
+	if err != nil {
+		adminError(w, r, "Failed to check permissions", err)
+		return false
+	}
+	if !isAdmin {
+		http.Error(w, "Admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// adminRequest checks the method and the caller's role, and decodes the JSON body into req when there is one
+func adminRequest(w http.ResponseWriter, r *http.Request, method string, req interface{}) (int, bool) {
+	if r.Method != method {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return 0, false
+	}
+	if !requireAdmin(w, r, userID) {
+		return 0, false
+	}
+
+	if req != nil {
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return 0, false
+		}
+	}
+
+	return userID, true
+}
+
+// adminError logs what went wrong and answers 500 with message, the details stay out of the response
+func adminError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	slog.ErrorContext(r.Context(), message, "error", err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminUsers lists users ordered by ID, optionally those whose username contains q.
+// Paginated with limit and after, the client passes next_cursor back as 'after'.
+func handleAdminUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := adminRequest(w, r, http.MethodGet, nil); !ok {
+		return
+	}
+
+	params := r.URL.Query()
+	query := repository.UserQuery{
+		Search: strings.TrimSpace(params.Get("q")),
+		Limit:  defaultAdminPageSize,
+	}
+
+	intParams := []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"after", &query.After, 0},
+		{"limit", &query.Limit, maxAdminPageSize},
+	}
+	for _, param := range intParams {
+		raw := params.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := utils.Atoi(raw)
+		if err != nil || value <= 0 || (param.max > 0 && value > param.max) {
+			http.Error(w, "Invalid "+param.name, http.StatusBadRequest)
+			return
+		}
+		*param.value = value
+	}
+
+	users, err := userRepo.ListUsers(r.Context(), query)
+	if err != nil {
+		adminError(w, r, "Failed to list users", err)
+		return
+	}
+
+	var nextCursor *int
+	if len(users) == query.Limit {
+		nextCursor = &users[len(users)-1].ID
+	}
+
+	writeAdminJSON(w, map[string]interface{}{
+		"users":       users,
+		"next_cursor": nextCursor,
+	})
+}
+
+// handleAdminDisableUser disables an account, which also ends its sessions and WebSocket connections, or enables it again
+func handleAdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   int  `json:"user_id"`
+		Disabled bool `json:"disabled"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.UserID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == adminID {
+		http.Error(w, "Administrators cannot disable themselves", http.StatusConflict)
+		return
+	}
+
+	err := userRepo.SetDisabled(r.Context(), req.UserID, req.Disabled)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to update account", err)
+		return
+	}
+
+	if req.Disabled {
+		chat.DisconnectUser(req.UserID)
+	}
+	slog.InfoContext(r.Context(), "Admin changed account state", "admin_id", adminID, "user_id", req.UserID, "disabled", req.Disabled)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminUserRole grants or takes away the admin role
+func handleAdminUserRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID int    `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.UserID <= 0 || (req.Role != repository.RoleUser && req.Role != repository.RoleAdmin) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	// Otherwise the last administrator could leave the system without any
+	if req.UserID == adminID && req.Role != repository.RoleAdmin {
+		http.Error(w, "Administrators cannot give up their own role", http.StatusConflict)
+		return
+	}
+
+	err := userRepo.SetRole(r.Context(), req.UserID, req.Role)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to update role", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin changed role", "admin_id", adminID, "user_id", req.UserID, "role", req.Role)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminResetPassword sets a new password and ends the user's sessions. Without a password in the request a
+// temporary one is generated, it is only returned in this response.
+func handleAdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Password string `json:"password"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.UserID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	username, err := userRepo.GetUsername(r.Context(), req.UserID)
+	if err != nil {
+		http.Error(w, repository.ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	generated := req.Password == ""
+	if generated {
+		req.Password, err = auth.NewTemporaryPassword()
+		if err != nil {
+			adminError(w, r, "Failed to generate password", err)
+			return
+		}
+	} else if fields := auth.ValidatePassword(req.Password, username); len(fields) > 0 {
+		writeValidationError(w, http.StatusBadRequest, fields...)
+		return
+	}
+
+	if err := userRepo.SetPassword(r.Context(), req.UserID, req.Password); err != nil {
+		adminError(w, r, "Failed to reset password", err)
+		return
+	}
+	chat.DisconnectUser(req.UserID)
+	recordLoginSuccess(r.Context(), username)
+	slog.InfoContext(r.Context(), "Admin reset password", "admin_id", adminID, "user_id", req.UserID)
+
+	if !generated {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeAdminJSON(w, map[string]string{"password": req.Password})
+}
+
+func handleAdminRenameChatroom(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChatroomID int    `json:"chatroom_id"`
+		Name       string `json:"name"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.ChatroomID <= 0 || req.Name == "" || len(req.Name) > maxChatroomNameBytes {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := chatroomRepo.RenameChatroom(r.Context(), req.ChatroomID, req.Name)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrChatroomNameTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to rename chatroom", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin renamed chatroom", "admin_id", adminID, "chatroom_id", req.ChatroomID, "name", req.Name)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminArchiveChatroom archives a chatroom, or brings it back. Archived rooms keep their history but take no new messages.
+func handleAdminArchiveChatroom(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChatroomID int  `json:"chatroom_id"`
+		Archived   bool `json:"archived"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.ChatroomID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := chatroomRepo.SetArchived(r.Context(), req.ChatroomID, req.Archived)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to update chatroom", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin changed chatroom state", "admin_id", adminID, "chatroom_id", req.ChatroomID, "archived", req.Archived)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminChatroomRetention shows (GET) or sets (POST) how long a chatroom keeps its messages. A policy without
+// days or messages keeps them forever.
+func handleAdminChatroomRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if _, ok := adminRequest(w, r, http.MethodGet, nil); !ok {
+			return
+		}
+		chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+		if err != nil || chatroomID <= 0 {
+			http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+			return
+		}
+		writeRetention(w, r, chatroomID)
+		return
+	}
+
+	var req struct {
+		ChatroomID int                        `json:"chatroom_id"`
+		Policy     repository.RetentionPolicy `json:"policy"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.ChatroomID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := retentionRepo.SetPolicy(r.Context(), req.ChatroomID, req.Policy)
+	if errors.Is(err, repository.ErrInvalidRetention) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to update retention", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin changed retention", "admin_id", adminID, "chatroom_id", req.ChatroomID,
+		"days", req.Policy.Days, "messages", req.Policy.Messages)
+
+	writeRetention(w, r, req.ChatroomID)
+}
+
+// handleAdminLegalHold places a chatroom under legal hold, which keeps the retention janitor away from it, or lifts it
+func handleAdminLegalHold(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChatroomID int  `json:"chatroom_id"`
+		LegalHold  bool `json:"legal_hold"`
+	}
+	adminID, ok := adminRequest(w, r, http.MethodPost, &req)
+	if !ok {
+		return
+	}
+	if req.ChatroomID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := retentionRepo.SetLegalHold(r.Context(), req.ChatroomID, req.LegalHold)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to update legal hold", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Admin changed legal hold", "admin_id", adminID, "chatroom_id", req.ChatroomID,
+		"legal_hold", req.LegalHold)
+
+	writeRetention(w, r, req.ChatroomID)
+}
+
+func writeRetention(w http.ResponseWriter, r *http.Request, chatroomID int) {
+	retention, err := retentionRepo.GetRetention(r.Context(), chatroomID)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		adminError(w, r, "Failed to fetch retention", err)
+		return
+	}
+	writeAdminJSON(w, retention)
+}
+
+// handleAdminStats combines the database counts with the state of this server process
+func handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if _, ok := adminRequest(w, r, http.MethodGet, nil); !ok {
+		return
+	}
+
+	stats, err := adminRepo.Stats(r.Context())
+	if err != nil {
+		adminError(w, r, "Failed to fetch stats", err)
+		return
+	}
+
+	connections, connectedUsers := chat.ConnectionCount()
+	writeAdminJSON(w, map[string]interface{}{
+		"database": stats,
+		"server": map[string]interface{}{
+			"uptime_seconds":  int(time.Since(startedAt).Seconds()),
+			"connections":     connections,
+			"connected_users": connectedUsers,
+			"goroutines":      runtime.NumGoroutine(),
+		},
+	})
+}
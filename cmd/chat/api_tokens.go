@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	maxAPITokenNameLength = 100
+	maxAPITokenLifetime   = 365 // days
+	apiTokenPrefixLength  = 12
+)
+
+// lookupAPIToken resolves the tokens presented to the routes that accept them
+func lookupAPIToken(ctx context.Context, token string) (auth.APIToken, error) {
+	stored, err := apiTokenRepo.LookupAPIToken(ctx, auth.HashAPIToken(token))
+	if errors.Is(err, repository.ErrAPITokenNotFound) {
+		return auth.APIToken{}, auth.ErrInvalidAPIToken
+	} else if err != nil {
+		return auth.APIToken{}, err
+	}
+
+	return auth.APIToken{
+		ID:          stored.ID,
+		UserID:      stored.UserID,
+		Scopes:      stored.Scopes,
+		ChatroomIDs: stored.ChatroomIDs,
+	}, nil
+}
+
+// handleAPITokens lists (GET), creates (POST) or revokes (DELETE) the caller's API tokens.
+// The token itself is only returned by the creation. Only user sessions reach this handler, tokens cannot mint tokens.
+func handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := apiTokenRepo.ListAPITokens(r.Context(), userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"api_tokens": tokens,
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost:
+		var req struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ChatroomIDs   []int    `json:"chatroom_ids"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Name == "" || len(req.Name) > maxAPITokenNameLength || len(req.ChatroomIDs) == 0 ||
+			req.ExpiresInDays < 0 || req.ExpiresInDays > maxAPITokenLifetime {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !auth.ValidScopes(req.Scopes) {
+			http.Error(w, "Invalid scopes", http.StatusBadRequest)
+			return
+		}
+		for _, chatroomID := range req.ChatroomIDs {
+			if !requireMember(w, r, chatroomID, userID) {
+				return
+			}
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInDays > 0 {
+			expiry := time.Now().AddDate(0, 0, req.ExpiresInDays)
+			expiresAt = &expiry
+		}
+
+		token, err := auth.NewAPIToken()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		created, err := apiTokenRepo.CreateAPIToken(r.Context(), userID, req.Name, auth.HashAPIToken(token), token[:apiTokenPrefixLength],
+			req.Scopes, req.ChatroomIDs, expiresAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		created.Token = token
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(created)
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodDelete:
+		tokenID, err := utils.Atoi(r.URL.Query().Get("token_id"))
+		if err != nil || tokenID <= 0 {
+			http.Error(w, "Invalid token_id", http.StatusBadRequest)
+			return
+		}
+
+		err = apiTokenRepo.RevokeAPIToken(r.Context(), userID, tokenID)
+		if errors.Is(err, repository.ErrAPITokenNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
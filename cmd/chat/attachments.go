@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"bytes"
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/media"
+	"chat-app/internal/storage"
+	"chat-app/internal/utils"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultMaxAttachmentSize = 10 << 20 // 10 MiB
+	multipartMemory          = 1 << 20
+	maxFilenameLength        = 255
+)
+
+var maxAttachmentSize = int64(utils.GetEnvInt("ATTACHMENT_MAX_BYTES", defaultMaxAttachmentSize))
+
+// handleUploadAttachment stores a file sent as multipart form data ('chatroom_id' and 'file') and returns its metadata.
+// The returned ID is then sent in 'attachment_ids' when posting the message.
+func handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	// Leave some room for the multipart boundaries and the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+multipartMemory)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	chatroomID, err := utils.Atoi(r.FormValue("chatroom_id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+		return
+	}
+
+	isMember, err := chatroomRepo.IsMember(r.Context(), chatroomID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !isMember {
+		http.Error(w, "Join the chatroom before uploading files", http.StatusForbidden)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxAttachmentSize {
+		http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "File is empty", http.StatusBadRequest)
+		return
+	}
+
+	contentType, err := media.DetectContentType(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	key, err := newAttachmentKey()
+	if err != nil {
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+
+	if err := blobStore.Put(r.Context(), key, bytes.NewReader(data)); err != nil {
+		slog.Error("Failed to store attachment", "error", err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := repository.Attachment{
+		ChatroomID:  chatroomID,
+		UploaderID:  userID,
+		Filename:    sanitizeFilename(header.Filename),
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		StorageKey:  key,
+	}
+
+	if media.IsImage(contentType) {
+		thumbnail, width, height, err := media.Thumbnail(data)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Storing attachment without a thumbnail", "error", err)
+		} else if err := blobStore.Put(r.Context(), key+"-thumb", bytes.NewReader(thumbnail)); err != nil {
+			slog.Error("Failed to store thumbnail", "error", err)
+		} else {
+			attachment.ThumbnailKey = key + "-thumb"
+			attachment.Width = width
+			attachment.Height = height
+		}
+	}
+
+	created, err := attachmentRepo.CreateAttachment(r.Context(), attachment)
+	if err != nil {
+		// Without its row nothing would ever reference or clean up the stored file
+		for _, blobKey := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if blobKey == "" {
+				continue
+			}
+			if err := blobStore.Delete(r.Context(), blobKey); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to delete attachment blob", "key", blobKey, "error", err)
+			}
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(created)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDownloadAttachment serves an attachment, or its thumbnail with 'thumbnail=true', to members of its chatroom
+func handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	attachmentID, err := utils.Atoi(r.URL.Query().Get("id"))
+	if err != nil || attachmentID <= 0 {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := attachmentRepo.GetAttachment(r.Context(), attachmentID)
+	if errors.Is(err, repository.ErrAttachmentNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Non-members get the same answer as for a missing attachment so IDs cannot be probed. Uploads that are not
+	// posted yet are only the uploader's.
+	isMember, err := chatroomRepo.IsMember(r.Context(), attachment.ChatroomID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !isMember || (attachment.MessageID == nil && attachment.UploaderID != userID) {
+		http.Error(w, repository.ErrAttachmentNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	key, contentType := attachment.StorageKey, attachment.ContentType
+	if r.URL.Query().Get("thumbnail") == "true" {
+		if !attachment.HasThumbnail {
+			http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, "image/png"
+	}
+
+	blob, err := blobStore.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, repository.ErrAttachmentNotFound.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	disposition := "attachment"
+	if media.IsImage(contentType) {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if key == attachment.StorageKey {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.SizeBytes, 10))
+	}
+
+	if _, err := io.Copy(w, blob); err != nil {
+		slog.Error("Failed to send attachment", "error", err)
+	}
+}
+
+func newAttachmentKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "attachments/" + hex.EncodeToString(b), nil
+}
+
+// sanitizeFilename keeps the base name of the client supplied filename without control characters
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	// Keep the end of long names so the extension survives
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[len(runes)-maxFilenameLength:])
+	}
+
+	return name
+}
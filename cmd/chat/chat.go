@@ -4,25 +4,57 @@ import (
 	"chat-app/internal/bot"
 	"chat-app/internal/chat"
 	"chat-app/internal/chat/repository"
+	"chat-app/internal/health"
+	"chat-app/internal/logging"
+	"chat-app/internal/metrics"
+	"chat-app/internal/tracing"
 	"chat-app/internal/utils"
+	"chat-app/internal/webhook"
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"chat-app/internal/auth"
 	"chat-app/internal/messaging"
+	"chat-app/internal/ratelimit"
+	"chat-app/internal/retention"
 	"chat-app/internal/storage"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WebSocket frame types sent by clients, a frame without a type is a chat message
+const (
+	frameMessage   = "message"
+	frameTyping    = "typing"
+	frameHeartbeat = "heartbeat"
+	frameRead      = "read"
 )
 
 var (
-	userRepo     *repository.UserRepository
-	chatroomRepo *repository.ChatroomRepository
-	messageRepo  *repository.MessageRepository
+	userRepo            *repository.UserRepository
+	chatroomRepo        *repository.ChatroomRepository
+	messageRepo         *repository.MessageRepository
+	reactionRepo        *repository.ReactionRepository
+	readStateRepo       *repository.ReadStateRepository
+	attachmentRepo      *repository.AttachmentRepository
+	notificationRepo    *repository.NotificationRepository
+	webhookRepo         *repository.WebhookRepository
+	apiTokenRepo        *repository.APITokenRepository
+	incomingWebhookRepo *repository.IncomingWebhookRepository
+	loginThrottleRepo   *repository.LoginThrottleRepository
+	mfaRepo             *repository.MFARepository
+	identityRepo        *repository.IdentityRepository
+	adminRepo           *repository.AdminRepository
+	retentionRepo       *repository.RetentionRepository
+
+	blobStore storage.BlobStore
 
 	upgrader = websocket.Upgrader{
 		CheckOrigin: func(_ *http.Request) bool {
@@ -37,31 +69,116 @@ var (
 func RunChatServer() error {
 	var err error
 
-	chatRabbitMQ, err = messaging.SetupRabbitMQ("stock_requests", "stock_responses")
+	chatRabbitMQ, err = messaging.SetupRabbitMQ("stock_requests", "stock_responses", "link_preview_requests", "link_preview_responses")
 	if err != nil {
-		log.Fatal("chatRabbitMQ setup failed:", err)
+		logging.Fatal("chatRabbitMQ setup failed", "error", err)
 	}
 	defer chatRabbitMQ.Close()
 
 	go bot.ConsumeStockResponses(chatRabbitMQ)
+	go chat.StartPresenceSweeper(presenceSweepInterval)
 
 	db, err := storage.SetupDatabaseConnection()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
+	metrics.RegisterDB(db.Conn, "chatdb")
 
 	userRepo = repository.NewUserRepository(db.Conn)
 	chatroomRepo = repository.NewChatroomRepository(db.Conn)
 	messageRepo = repository.NewMessageRepository(db.Conn)
+	go bot.ConsumeLinkPreviewResponses(chatRabbitMQ, messageRepo)
+	reactionRepo = repository.NewReactionRepository(db.Conn)
+	readStateRepo = repository.NewReadStateRepository(db.Conn)
+	attachmentRepo = repository.NewAttachmentRepository(db.Conn)
+	notificationRepo = repository.NewNotificationRepository(db.Conn)
+	webhookRepo = repository.NewWebhookRepository(db.Conn)
+	apiTokenRepo = repository.NewAPITokenRepository(db.Conn)
+	incomingWebhookRepo = repository.NewIncomingWebhookRepository(db.Conn)
+	loginThrottleRepo = repository.NewLoginThrottleRepository(db.Conn)
+	mfaRepo = repository.NewMFARepository(db.Conn)
+	identityRepo = repository.NewIdentityRepository(db.Conn)
+	adminRepo = repository.NewAdminRepository(db.Conn)
+	retentionRepo = repository.NewRetentionRepository(db.Conn)
+	auth.UseSessionCheck(userRepo.SessionCheck)
+	go webhook.NewDispatcher(webhookRepo).Run(context.Background(), webhookDispatchInterval)
+
+	blobStore, err = storage.NewLocalBlobStore(utils.GetEnv("ATTACHMENTS_DIR", "./data/attachments"))
+	if err != nil {
+		logging.Fatal("Failed to set up attachment storage", "error", err)
+	}
+
+	retentionConfig, err := retention.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to set up message retention", "error", err)
+	}
+	go retention.NewJanitor(retentionRepo, blobStore, retentionConfig).Run(context.Background(), retentionConfig.Interval)
+
+	keyring, err := auth.KeyringFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to set up signing keys", "error", err)
+	}
+	auth.UseKeyring(keyring)
+
+	if err := setupOIDCProviders(); err != nil {
+		logging.Fatal("Failed to set up identity providers", "error", err)
+	}
 
 	// TODO: Migrate the 'handle' functions to separate files
-	http.HandleFunc("/register", handleRegister)
-	http.HandleFunc("/login", handleLogin)
-	http.Handle("/chatroom/create", auth.Middleware(http.HandlerFunc(handleCreateChatroom)))
-	http.Handle("/chatroom/list", auth.Middleware(http.HandlerFunc(handleListChatrooms)))
-	http.Handle("/chatroom/post_message", auth.Middleware(http.HandlerFunc(handlePostMessage)))
-	http.Handle("/chatroom/messages", auth.Middleware(http.HandlerFunc(handleGetMessages)))
+	http.Handle("/register", ratelimit.Middleware(authLimiter, ratelimit.ClientIP)(http.HandlerFunc(handleRegister)))
+	http.Handle("/login", ratelimit.Middleware(authLimiter, ratelimit.ClientIP)(http.HandlerFunc(handleLogin)))
+	http.Handle("/login/mfa", ratelimit.Middleware(authLimiter, ratelimit.ClientIP)(http.HandlerFunc(handleLoginMFA)))
+	http.HandleFunc("/.well-known/jwks.json", auth.HandleJWKS)
+	http.Handle("/metrics", metrics.Handler())
+
+	checker := health.NewChecker("chat")
+	checker.Add("database", db.Ping)
+	checker.Add("migrations", db.CheckSchema)
+	checker.Add("rabbitmq", chatRabbitMQ.Check)
+	checker.Register(http.DefaultServeMux)
+	http.HandleFunc("/auth/oidc/providers", handleListOIDCProviders)
+	http.Handle(oidcPathPrefix, ratelimit.Middleware(authLimiter, ratelimit.ClientIP)(http.HandlerFunc(handleOIDC)))
+	http.Handle("/chatroom/create", auth.Middleware(limited(handleCreateChatroom)))
+	http.Handle("/chatroom/list", auth.Middleware(limited(handleListChatrooms)))
+	http.Handle("/chatroom/post_message", auth.MiddlewareWithAPITokens(lookupAPIToken, auth.ScopeMessagesWrite)(limited(handlePostMessage)))
+	http.Handle("/chatroom/messages", auth.MiddlewareWithAPITokens(lookupAPIToken, auth.ScopeMessagesRead)(limited(handleGetMessages)))
+	http.Handle("/chatroom/{id}/export", auth.MiddlewareWithAPITokens(lookupAPIToken, auth.ScopeMessagesRead)(limited(handleExportChatroom)))
+	http.Handle("/chatroom/thread", auth.Middleware(limited(handleGetThread)))
+	http.Handle("/chatroom/reactions", auth.Middleware(limited(handleReactions)))
+	http.Handle("/chatroom/join", auth.Middleware(limited(handleJoinChatroom)))
+	http.Handle("/search", auth.Middleware(limited(handleSearch)))
+	http.Handle("/chatroom/presence", auth.Middleware(limited(handleChatroomPresence)))
+	http.Handle("/chatroom/read", auth.Middleware(limited(handleMarkRead)))
+	http.Handle("/chatroom/read_receipts", auth.Middleware(limited(handleListReadReceipts)))
+	http.Handle("/chatroom/attachments", auth.Middleware(limited(handleUploadAttachment)))
+	http.Handle("/chatroom/attachment", auth.Middleware(limited(handleDownloadAttachment)))
+	http.Handle("/chatroom/message", auth.Middleware(limited(handleDeleteMessage)))
+	http.Handle("/chatroom/webhooks", auth.Middleware(limited(handleWebhooks)))
+	http.Handle("/chatroom/webhooks/enable", auth.Middleware(limited(handleEnableWebhook)))
+	http.Handle("/chatroom/webhooks/deliveries", auth.Middleware(limited(handleWebhookDeliveries)))
+	http.Handle("/chatroom/incoming_webhooks", auth.Middleware(limited(handleIncomingWebhooks)))
+	http.Handle(incomingWebhookPath, ratelimit.Middleware(hookLimiter, func(r *http.Request) string {
+		return r.URL.Path
+	})(limited(handleIncomingWebhookPost)))
+	http.Handle("/api_tokens", auth.Middleware(limited(handleAPITokens)))
+	http.Handle("/notifications", auth.Middleware(limited(handleListNotifications)))
+	http.Handle("/notifications/read", auth.Middleware(limited(handleMarkNotificationsRead)))
+	http.Handle("/notifications/keywords", auth.Middleware(limited(handleNotificationKeywords)))
+	http.Handle("/mfa", auth.Middleware(limited(handleMFA)))
+	http.Handle("/mfa/totp", auth.Middleware(limited(handleTOTP)))
+	http.Handle("/mfa/totp/confirm", auth.Middleware(limited(handleConfirmTOTP)))
+	http.Handle("/mfa/recovery_codes", auth.Middleware(limited(handleRegenerateRecoveryCodes)))
+	http.Handle("/admin/unlock_login", auth.Middleware(limited(handleUnlockLogin)))
+	http.Handle("/admin/users", auth.Middleware(limited(handleAdminUsers)))
+	http.Handle("/admin/users/disable", auth.Middleware(limited(handleAdminDisableUser)))
+	http.Handle("/admin/users/role", auth.Middleware(limited(handleAdminUserRole)))
+	http.Handle("/admin/users/reset_password", auth.Middleware(limited(handleAdminResetPassword)))
+	http.Handle("/admin/chatrooms/rename", auth.Middleware(limited(handleAdminRenameChatroom)))
+	http.Handle("/admin/chatrooms/archive", auth.Middleware(limited(handleAdminArchiveChatroom)))
+	http.Handle("/admin/chatrooms/retention", auth.Middleware(limited(handleAdminChatroomRetention)))
+	http.Handle("/admin/chatrooms/legal_hold", auth.Middleware(limited(handleAdminLegalHold)))
+	http.Handle("/admin/stats", auth.Middleware(limited(handleAdminStats)))
 
 	http.HandleFunc("/ws", handleWebSocket)
 	http.Handle("/", http.FileServer(http.Dir("./web/static")))
@@ -72,12 +189,12 @@ func RunChatServer() error {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 		// TODO: REMOVE THE CORS MIDDLEWARE FOR PROD ENVIRONMENT
-		Handler: utils.CorsMiddleware(http.DefaultServeMux),
+		Handler: utils.CorsMiddleware(logging.Middleware(tracing.Middleware(metrics.Middleware(http.DefaultServeMux)))),
 	}
 
-	log.Println("Chat server is running on http://localhost:8080")
+	slog.Info("Chat server is running on http://localhost:8080")
 	if err := server.ListenAndServe(); err != nil {
-		log.Fatal("Failed to start server:", err)
+		logging.Fatal("Failed to start server", "error", err)
 	}
 
 	return nil
@@ -89,14 +206,19 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// TODO: Implement a more secure way to authenticate WebSocket connections [ephemeral access tokens, cookies, etc.]
 	tokenString := r.URL.Query().Get("token")
 	if tokenString == "" {
-		log.Println("Missing token parameter")
+		slog.WarnContext(r.Context(), "Missing token parameter")
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	claims, err := auth.ValidateJWT(tokenString)
 	if err != nil {
-		log.Printf("Invalid JWT token: %v", err)
+		slog.WarnContext(r.Context(), "Invalid JWT token", "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := auth.CheckSession(r.Context(), claims); err != nil {
+		slog.WarnContext(r.Context(), "Refused session", "user_id", claims.UserID, "error", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -115,48 +237,131 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = joinChatroom(r.Context(), chatroomID, userID)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, "Chatroom not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to join chatroom", "chatroom_id", chatroomID, "error", err)
+		http.Error(w, "Failed to join chatroom", http.StatusInternalServerError)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.WarnContext(r.Context(), "WebSocket upgrade error", "error", err)
 		return
 	}
 	defer conn.Close()
 
-	chat.AddClientToChatroom(conn, chatroomID)
-	defer chat.RemoveClientFromChatroom(conn, chatroomID)
+	client := chat.AddClientToChatroom(conn, chatroomID, userID)
+	chat.RefreshPresence(userID)
+	defer func() {
+		chat.RemoveClientFromChatroom(client)
+		chat.RefreshPresence(userID, chatroomID)
+	}()
 
 	// Start handling WebSocket messages
 	for {
 		var msg struct {
-			Content string `json:"content"`
+			Type          string `json:"type"`
+			Content       string `json:"content"`
+			ParentID      int    `json:"parent_id"`
+			Typing        bool   `json:"typing"`
+			MessageID     int    `json:"message_id"`
+			AttachmentIDs []int  `json:"attachment_ids"`
 		}
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("WebSocket read error for chatroom: %v", err)
+			slog.DebugContext(r.Context(), "WebSocket read error", "chatroom_id", chatroomID, "error", err)
 			break
 		}
 
+		if !allowFrame(client, wsFrameLimiter) {
+			continue
+		}
+
+		client.Heartbeat()
+		chat.RefreshPresence(userID)
+
+		switch msg.Type {
+		case frameHeartbeat:
+			continue
+		case frameTyping:
+			client.NotifyTyping(msg.Typing)
+			continue
+		case frameRead:
+			if err := markRead(r.Context(), userID, chatroomID, msg.MessageID); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to update read state", "error", err)
+			}
+			continue
+		case "", frameMessage:
+		default:
+			slog.WarnContext(r.Context(), "Unknown WebSocket frame type", "type", msg.Type)
+			continue
+		}
+
+		client.StoppedTyping()
+
+		if !allowFrame(client, writeLimiter) {
+			continue
+		}
+
 		if strings.HasPrefix(msg.Content, "/stock=") {
+			if !allowFrame(client, stockLimiter) {
+				continue
+			}
+
 			stockCode := strings.TrimPrefix(msg.Content, "/stock=")
 			stockRequest := map[string]interface{}{
 				"chatroom_id": chatroomID,
 				"stock_code":  stockCode,
 			}
 
-			bot.SendStockRequestToQueue(chatRabbitMQ, stockRequest)
-		} else {
-			if err := messageRepo.AddMessage(r.Context(), chatroomID, userID, msg.Content); err != nil {
-				log.Println("Failed to store message in the DB:", err)
+			// Every command gets its own request ID and trace, so its trip through the bot can be followed apart
+			// from the rest of the connection. The trace links back to the connection's span.
+			ctx := logging.WithRequestID(r.Context(), logging.NewRequestID())
+			ctx, span := tracing.Start(ctx, "WebSocket stock command",
+				trace.WithNewRoot(),
+				trace.WithLinks(trace.LinkFromContext(r.Context())),
+				trace.WithAttributes(attribute.Int("chatroom_id", chatroomID), attribute.Int("user_id", userID)),
+			)
+			slog.InfoContext(ctx, "Stock command received", "connection_request_id", logging.RequestID(r.Context()),
+				"chatroom_id", chatroomID, "user_id", userID)
+			bot.SendStockRequestToQueue(ctx, chatRabbitMQ, stockRequest)
+			span.End()
+			continue
+		}
+
+		input, err := newMessage(r.Context(), chatroomID, userID, msg.Content, msg.AttachmentIDs)
+		if isInvalidContent(err) {
+			sendError(client, errorInvalidMessage, err.Error(), 0)
+			continue
+		} else if errors.Is(err, repository.ErrChatroomArchived) {
+			sendError(client, errorChatroomArchived, "Chatroom is archived", 0)
+			continue
+		} else if err != nil {
+			slog.Error("Failed to format WebSocket message", "error", err)
+			continue
+		}
+
+		if msg.ParentID > 0 {
+			reply, err := postReply(r.Context(), msg.ParentID, input)
+			if err != nil {
+				slog.Error("Failed to store reply in the DB", "error", err)
 				continue
 			}
 
-			msgToSend := repository.Message{
-				ChatroomID: chatroomID,
-				UserID:     userID,
-				Content:    msg.Content,
-				Timestamp:  time.Now(),
+			messagePosted(r.Context(), reply)
+		} else {
+			msgToSend, err := messageRepo.AddMessage(r.Context(), input)
+			if err != nil {
+				slog.Error("Failed to store message in the DB", "error", err)
+				continue
 			}
+
 			chat.BroadcastMessageToChatroom(chatroomID, msgToSend)
+			messagePosted(r.Context(), msgToSend)
 		}
 	}
 }
@@ -178,10 +383,20 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	var validationErr *auth.ValidationError
+	if err := auth.ValidateCredentials(req.Username, req.Password); errors.As(err, &validationErr) {
+		writeValidationError(w, http.StatusBadRequest, validationErr.Fields...)
+		return
+	}
+
+	ctx := r.Context()
 	err = userRepo.Register(ctx, req.Username, req.Password)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		writeValidationError(w, http.StatusConflict, auth.FieldError{Field: "username", Code: auth.CodeTaken, Message: "Username is already taken"})
+		return
+	} else if err != nil {
+		slog.Error("Failed to register user", "error", err)
+		http.Error(w, "Failed to register user", http.StatusInternalServerError)
 		return
 	}
 
@@ -206,14 +421,39 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	userID, err := userRepo.Authenticate(ctx, req.Username, req.Password)
+	if loginLocked(w, r, req.Username) {
+		return
+	}
+
+	ctx := r.Context()
+	userID, username, err := userRepo.Authenticate(ctx, req.Username, req.Password)
+	if errors.Is(err, repository.ErrInvalidCredentials) {
+		recordLoginFailure(ctx, r, req.Username)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.Error("Failed to authenticate user", "error", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if accountDisabled(ctx, w, userID) {
+		return
+	}
+
+	mfaEnabled, err := mfaRepo.IsTOTPEnabled(ctx, userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		slog.Error("Failed to check MFA", "error", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
 		return
 	}
+	if mfaEnabled {
+		// The account's failures are only cleared once the code is right too, see handleLoginMFA
+		writeMFAChallenge(w, userID, username)
+		return
+	}
+	recordLoginSuccess(ctx, username)
 
-	token, err := auth.GenerateJWT(userID, req.Username)
+	token, err := auth.GenerateJWT(userID, username)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
@@ -235,6 +475,12 @@ func handleCreateChatroom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		Name string `json:"name"`
 	}
@@ -245,13 +491,18 @@ func handleCreateChatroom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 	id, err := chatroomRepo.CreateChatroom(ctx, req.Name)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := joinChatroom(ctx, id, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(map[string]interface{}{
 		"chatroom_id": id,
@@ -268,8 +519,14 @@ func handleListChatrooms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	chatrooms, err := chatroomRepo.ListChatrooms(ctx)
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	ctx := r.Context()
+	chatrooms, err := chatroomRepo.ListChatrooms(ctx, userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -298,23 +555,67 @@ func handlePostMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		ChatroomID int    `json:"chatroom_id"`
-		Content    string `json:"content"`
+		ChatroomID    int    `json:"chatroom_id"`
+		ParentID      int    `json:"parent_id"`
+		Content       string `json:"content"`
+		AttachmentIDs []int  `json:"attachment_ids"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil || req.ChatroomID <= 0 || req.Content == "" {
+	if err != nil || req.ChatroomID <= 0 || req.ParentID < 0 || (req.Content == "" && len(req.AttachmentIDs) == 0) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	ctx := context.Background()
-	err = messageRepo.AddMessage(ctx, req.ChatroomID, userID, req.Content)
-	if err != nil {
+	if !auth.AllowsChatroom(r.Context(), req.ChatroomID) {
+		http.Error(w, "API token is not allowed in this chatroom", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	err = joinChatroom(ctx, req.ChatroomID, userID)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, "Chatroom not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Failed to join chatroom", "chatroom_id", req.ChatroomID, "error", err)
+		http.Error(w, "Failed to join chatroom", http.StatusInternalServerError)
+		return
+	}
+
+	input, err := newMessage(ctx, req.ChatroomID, userID, req.Content, req.AttachmentIDs)
+	if isInvalidContent(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, repository.ErrChatroomArchived) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	var msg repository.Message
+	if req.ParentID > 0 {
+		msg, err = postReply(ctx, req.ParentID, input)
+	} else {
+		msg, err = messageRepo.AddMessage(ctx, input)
+	}
+	if errors.Is(err, repository.ErrMessageNotFound) || errors.Is(err, repository.ErrInvalidParent) ||
+		errors.Is(err, repository.ErrInvalidAttachments) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Replies were already broadcast as thread events, posts from API tokens must show up live like any other
+	if req.ParentID == 0 {
+		chat.BroadcastMessageToChatroom(req.ChatroomID, msg)
+	}
+	messagePosted(ctx, msg)
+
 	w.WriteHeader(http.StatusCreated)
 	err = json.NewEncoder(w).Encode(map[string]string{
 		"message": "Message posted successfully",
@@ -331,6 +632,12 @@ func handleGetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
 	chatroomIDStr := r.URL.Query().Get("chatroom_id")
 	if chatroomIDStr == "" {
 		http.Error(w, "Missing chatroom_id", http.StatusBadRequest)
@@ -343,8 +650,13 @@ func handleGetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	messages, err := messageRepo.GetLastMessages(ctx, chatroomID, 50)
+	if !auth.AllowsChatroom(r.Context(), chatroomID) {
+		http.Error(w, "API token is not allowed in this chatroom", http.StatusForbidden)
+		return
+	}
+
+	ctx := r.Context()
+	messages, err := messageRepo.GetLastMessages(ctx, chatroomID, userID, 50)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"bufio"
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/transcript"
+	"chat-app/internal/utils"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// exportWriteTimeout replaces the server's write timeout during an export, it bounds each write instead of the
+// whole response so large rooms can be downloaded
+const exportWriteTimeout = time.Minute
+
+// handleExportChatroom streams the transcript of a chatroom, members only: GET /chatroom/{id}/export with
+// format json (the default), csv or html, and optional from and to (RFC 3339) bounds on the message timestamps.
+func handleExportChatroom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	chatroomID, err := utils.Atoi(r.PathValue("id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom id", http.StatusBadRequest)
+		return
+	}
+	if !auth.AllowsChatroom(r.Context(), chatroomID) {
+		http.Error(w, "API token is not allowed in this chatroom", http.StatusForbidden)
+		return
+	}
+
+	params := r.URL.Query()
+	formatName := params.Get("format")
+	if formatName == "" {
+		formatName = transcript.FormatJSON
+	}
+	format, err := transcript.Lookup(formatName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := repository.ExportQuery{ChatroomID: chatroomID}
+	timeParams := []struct {
+		name  string
+		value **time.Time
+	}{
+		{"from", &query.From},
+		{"to", &query.To},
+	}
+	for _, param := range timeParams {
+		raw := params.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid "+param.name+", expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+		// Timestamps are stored in UTC without a zone, an offset in the bound would otherwise be dropped
+		value = value.UTC()
+		*param.value = &value
+	}
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		http.Error(w, "Invalid range, from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	if !requireMember(w, r, chatroomID, userID) {
+		return
+	}
+	chatroom, err := chatroomRepo.GetChatroom(r.Context(), chatroomID)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := transcript.Header{
+		ChatroomID:   chatroomID,
+		ChatroomName: chatroom.Name,
+		From:         query.From,
+		To:           query.To,
+		ExportedAt:   time.Now(),
+	}
+
+	// Nothing reaches the client before the buffer first fills, so failures opening the cursor still get a 500
+	out := &exportResponse{
+		ResponseWriter: w,
+		controller:     http.NewResponseController(w),
+		format:         format,
+		filename:       format.Filename(header),
+	}
+	buffered := bufio.NewWriter(out)
+
+	writer, err := format.NewWriter(buffered, header)
+	if err == nil {
+		err = messageRepo.ExportMessages(r.Context(), query, func(msg repository.ExportedMessage) error {
+			for i := range msg.Attachments {
+				msg.Attachments[i].URL = "/chatroom/attachment?id=" + strconv.Itoa(msg.Attachments[i].ID)
+			}
+			return writer.WriteMessage(msg)
+		})
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	slog.ErrorContext(r.Context(), "Chatroom export failed", "chatroom_id", chatroomID, "format", format.Name, "error", err)
+	if !out.started {
+		http.Error(w, "Failed to export chatroom", http.StatusInternalServerError)
+		return
+	}
+	// The status is long gone, breaking the connection is the only way left to tell the client the file is truncated
+	panic(http.ErrAbortHandler)
+}
+
+// exportResponse sets the export headers on the first write and lifts the server's write timeout for each write
+type exportResponse struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	format     transcript.Format
+	filename   string
+	started    bool
+}
+
+func (e *exportResponse) Write(b []byte) (int, error) {
+	if !e.started {
+		e.started = true
+		e.Header().Set("Content-Type", e.format.ContentType)
+		e.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.filename}))
+		e.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	if err := e.controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return e.ResponseWriter.Write(b)
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/markup"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// newMessage validates content and parses it into its structured representation, resolving @user and #room mentions.
+// Content may only be empty when attachments are posted. Archived chatrooms refuse new messages with ErrChatroomArchived.
+func newMessage(ctx context.Context, chatroomID, userID int, content string, attachmentIDs []int) (repository.NewMessage, error) {
+	archived, err := chatroomRepo.IsArchived(ctx, chatroomID)
+	if err != nil {
+		return repository.NewMessage{}, err
+	}
+	if archived {
+		return repository.NewMessage{}, repository.ErrChatroomArchived
+	}
+
+	input := repository.NewMessage{
+		ChatroomID:    chatroomID,
+		UserID:        userID,
+		Content:       content,
+		AttachmentIDs: attachmentIDs,
+	}
+
+	if err := markup.Validate(content); errors.Is(err, markup.ErrEmptyContent) && len(attachmentIDs) > 0 {
+		return input, nil
+	} else if err != nil {
+		return repository.NewMessage{}, err
+	}
+
+	doc := markup.Parse(content)
+	usernames, chatroomNames := doc.MentionNames()
+
+	userIDs, err := userRepo.GetUserIDsByUsernames(ctx, usernames)
+	if err != nil {
+		return repository.NewMessage{}, err
+	}
+	chatroomIDs, err := chatroomRepo.GetChatroomIDsByNames(ctx, chatroomNames)
+	if err != nil {
+		return repository.NewMessage{}, err
+	}
+	doc.Resolve(userIDs, chatroomIDs)
+
+	input.Formatted, err = json.Marshal(doc)
+	if err != nil {
+		return repository.NewMessage{}, fmt.Errorf("failed to encode formatted message: %w", err)
+	}
+
+	return input, nil
+}
+
+// isInvalidContent reports whether err means the content itself was refused
+func isInvalidContent(err error) bool {
+	return errors.Is(err, markup.ErrEmptyContent) || errors.Is(err, markup.ErrContentTooLong) || errors.Is(err, markup.ErrInvalidContent)
+}
@@ -0,0 +1,218 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	incomingWebhookPath     = "/hooks/"
+	maxIncomingWebhookBytes = 64 << 10
+)
+
+// Integration names become bot usernames, so they follow the characters @mentions can match
+var integrationNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+type incomingWebhookResponse struct {
+	repository.IncomingWebhook
+	URL string `json:"url"`
+}
+
+func newIncomingWebhookToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// handleIncomingWebhooks lists (GET), creates (POST) or revokes (DELETE) the incoming webhooks of a chatroom, members only.
+// Members list and revoke the webhooks they created, administrators all of them. The secret URL is only returned by the creation.
+func handleIncomingWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+		if err != nil || chatroomID <= 0 {
+			http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+			return
+		}
+		isAdmin, ok := requireMemberOrAdmin(w, r, chatroomID, userID)
+		if !ok {
+			return
+		}
+
+		webhooks, err := incomingWebhookRepo.ListIncomingWebhooks(r.Context(), chatroomID, webhookCreatorFilter(userID, isAdmin))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"incoming_webhooks": webhooks,
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost:
+		var req struct {
+			ChatroomID int    `json:"chatroom_id"`
+			Name       string `json:"name"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.ChatroomID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !integrationNamePattern.MatchString(req.Name) {
+			http.Error(w, "Invalid name, use up to 64 letters, digits, '_', '.' or '-'", http.StatusBadRequest)
+			return
+		}
+		if !requireMember(w, r, req.ChatroomID, userID) {
+			return
+		}
+
+		token, err := newIncomingWebhookToken()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		created, err := incomingWebhookRepo.CreateIncomingWebhook(r.Context(), req.ChatroomID, userID, req.Name, auth.HashAPIToken(token))
+		if errors.Is(err, repository.ErrIntegrationNameTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(incomingWebhookResponse{
+			IncomingWebhook: created,
+			URL:             incomingWebhookPath + token,
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodDelete:
+		chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+		if err != nil || chatroomID <= 0 {
+			http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+			return
+		}
+		webhookID, err := utils.Atoi(r.URL.Query().Get("webhook_id"))
+		if err != nil || webhookID <= 0 {
+			http.Error(w, "Invalid webhook_id", http.StatusBadRequest)
+			return
+		}
+		isAdmin, ok := requireMemberOrAdmin(w, r, chatroomID, userID)
+		if !ok {
+			return
+		}
+
+		err = incomingWebhookRepo.RevokeIncomingWebhook(r.Context(), chatroomID, webhookID, webhookCreatorFilter(userID, isAdmin))
+		if errors.Is(err, repository.ErrIncomingWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleIncomingWebhookPost posts {"content": "..."} to the webhook's chatroom as its integration.
+// The secret in the URL is the only credential. "text" is accepted in place of "content" for tools that send it.
+func handleIncomingWebhookPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, incomingWebhookPath)
+	if token == "" || strings.Contains(token, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Text    string `json:"text"`
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxIncomingWebhookBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Content == "" {
+		req.Content = req.Text
+	}
+
+	hook, err := incomingWebhookRepo.LookupIncomingWebhook(r.Context(), auth.HashAPIToken(token))
+	if errors.Is(err, repository.ErrIncomingWebhookNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	input, err := newMessage(r.Context(), hook.ChatroomID, hook.BotUserID, req.Content, nil)
+	if isInvalidContent(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, repository.ErrChatroomArchived) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msg, err := messageRepo.AddMessage(r.Context(), input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chat.BroadcastMessageToChatroom(hook.ChatroomID, msg)
+	messagePosted(r.Context(), msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]int{
+		"message_id": msg.ID,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,116 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/ratelimit"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// loginKey is the account a login attempt targets, whether it exists or not. The name is hashed, login requests are
+// not limited in length and the key has to fit the throttle table whatever was typed.
+func loginKey(username string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(username)))
+	return "account:" + hex.EncodeToString(sum[:])
+}
+
+// loginLocked answers 429 when the account or the client address is locked out, before the password is checked
+func loginLocked(w http.ResponseWriter, r *http.Request, username string) bool {
+	wait, err := loginThrottleRepo.LockedFor(r.Context(), []string{loginKey(username), ratelimit.ClientIP(r)})
+	if err != nil {
+		slog.Error("Failed to check login lockout", "error", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(wait)))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+// recordLoginFailure counts the failure against the account and the client address, locking them out as their policy says
+func recordLoginFailure(ctx context.Context, r *http.Request, username string) {
+	keys := []struct {
+		key    string
+		policy auth.LockoutPolicy
+	}{
+		{loginKey(username), auth.AccountLockout},
+		{ratelimit.ClientIP(r), auth.AddressLockout},
+	}
+
+	for _, k := range keys {
+		failures, err := loginThrottleRepo.RecordFailure(ctx, k.key, k.policy.Window)
+		if err != nil {
+			slog.Error("Failed to record login failure", "error", err)
+			continue
+		}
+		if delay := k.policy.Delay(failures); delay > 0 {
+			if err := loginThrottleRepo.Lock(ctx, k.key, delay); err != nil {
+				slog.Error("Failed to lock login", "error", err)
+			}
+		}
+	}
+}
+
+// recordLoginSuccess forgets the account's failures. Those of the address are kept, a single valid account must
+// not let a client keep guessing the passwords of others.
+func recordLoginSuccess(ctx context.Context, username string) {
+	if _, err := loginThrottleRepo.Clear(ctx, []string{loginKey(username)}); err != nil {
+		slog.Error("Failed to clear login failures", "error", err)
+	}
+}
+
+// handleUnlockLogin lets an administrator lift the lockout of an account, a client address, or both
+func handleUnlockLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+	if !requireAdmin(w, r, userID) {
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		IP       string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "" && req.IP == "") {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var keys []string
+	if req.Username != "" {
+		keys = append(keys, loginKey(req.Username))
+	}
+	if req.IP != "" {
+		keys = append(keys, "ip:"+req.IP)
+	}
+
+	unlocked, err := loginThrottleRepo.Clear(r.Context(), keys)
+	if err != nil {
+		http.Error(w, "Failed to unlock login", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]bool{"unlocked": unlocked}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
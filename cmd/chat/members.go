@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/webhook"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// joinChatroom records the user as a member of the chatroom, membership is what grants read access to features
+// such as search. Users join implicitly when they create a room, connect to it or post into it.
+func joinChatroom(ctx context.Context, chatroomID, userID int) error {
+	newlyJoined, err := chatroomRepo.AddMember(ctx, chatroomID, userID)
+	if err != nil {
+		return err
+	}
+
+	if newlyJoined {
+		emitWebhookEvent(ctx, chatroomID, webhook.EventMemberJoined, map[string]int{
+			"chatroom_id": chatroomID,
+			"user_id":     userID,
+		})
+	}
+
+	return nil
+}
+
+func handleJoinChatroom(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChatroomID int `json:"chatroom_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.ChatroomID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = joinChatroom(r.Context(), req.ChatroomID, userID)
+	if errors.Is(err, repository.ErrChatroomNotFound) {
+		http.Error(w, "Chatroom not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to join chatroom", "chatroom_id", req.ChatroomID, "error", err)
+		http.Error(w, "Failed to join chatroom", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
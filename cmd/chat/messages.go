@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/bot"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"chat-app/internal/webhook"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// messagePosted runs everything that follows a new message or reply once it is stored:
+// notifications, outgoing webhooks and link previews
+func messagePosted(ctx context.Context, msg repository.Message) {
+	notifyForMessage(ctx, msg)
+	emitWebhookEvent(ctx, msg.ChatroomID, webhook.EventMessageCreated, msg)
+	bot.SendLinkPreviewRequestToQueue(ctx, chatRabbitMQ, msg)
+}
+
+// handleDeleteMessage lets the author delete one of their messages, a thread root goes with its replies
+func handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+		return
+	}
+	messageID, err := utils.Atoi(r.URL.Query().Get("message_id"))
+	if err != nil || messageID <= 0 {
+		http.Error(w, "Invalid message_id", http.StatusBadRequest)
+		return
+	}
+
+	msg, blobKeys, err := messageRepo.DeleteMessage(r.Context(), chatroomID, messageID, userID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, key := range blobKeys {
+		if err := blobStore.Delete(r.Context(), key); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to delete attachment blob", "key", key, "error", err)
+		}
+	}
+
+	payload := chat.MessageDeletedPayload{
+		ChatroomID: chatroomID,
+		MessageID:  msg.ID,
+		ParentID:   msg.ParentID,
+		UserID:     userID,
+	}
+	chat.BroadcastEventToChatroom(chatroomID, chat.Event{
+		Type:    chat.EventMessageDeleted,
+		Payload: payload,
+	})
+	emitWebhookEvent(r.Context(), chatroomID, webhook.EventMessageDeleted, payload)
+
+	w.WriteHeader(http.StatusNoContent)
+}
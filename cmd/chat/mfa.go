@@ -0,0 +1,370 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// totpIssuer names the app in authenticator apps
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "chat-app"
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code, each only once
+func verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	state, err := mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !state.Enabled {
+		return false, nil
+	}
+
+	if step, ok := auth.VerifyTOTP(state.Secret, code, time.Now(), state.LastUsedStep); ok {
+		return mfaRepo.UseTOTPStep(ctx, userID, step)
+	}
+
+	return mfaRepo.UseRecoveryCode(ctx, userID, auth.HashRecoveryCode(code))
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// writeMFAChallenge answers a correct password of a user with TOTP enabled, the client then posts the pending token
+// and a code to /login/mfa
+func writeMFAChallenge(w http.ResponseWriter, userID int, username string) {
+	mfaToken, err := auth.GenerateMFAPendingToken(userID, username)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+		"expires_in":   int(auth.MFAPendingTTL.Seconds()),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleLoginMFA is the second step of a login with TOTP enabled, it trades the pending token and a code for a session
+func handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := auth.ValidateMFAPendingToken(req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA token, log in again", http.StatusUnauthorized)
+		return
+	}
+
+	// Codes are short, guessing them is throttled just like passwords
+	if loginLocked(w, r, claims.Username) {
+		return
+	}
+
+	ctx := r.Context()
+	ok, err := verifySecondFactor(ctx, claims.UserID, req.Code)
+	if err != nil {
+		slog.Error("Failed to verify second factor", "error", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		recordLoginFailure(ctx, r, claims.Username)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	recordLoginSuccess(ctx, claims.Username)
+	if accountDisabled(ctx, w, claims.UserID) {
+		return
+	}
+
+	token, err := auth.GenerateJWT(claims.UserID, claims.Username)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{"token": token}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleMFA reports whether the user has TOTP enabled and how many recovery codes they have left
+func handleMFA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	enabled, err := mfaRepo.IsTOTPEnabled(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch MFA status", http.StatusInternalServerError)
+		return
+	}
+
+	var recoveryCodes int
+	if enabled {
+		if recoveryCodes, err = mfaRepo.CountRecoveryCodes(r.Context(), userID); err != nil {
+			http.Error(w, "Failed to fetch MFA status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"totp_enabled":        enabled,
+		"recovery_codes_left": recoveryCodes,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleTOTP starts an enrollment on POST, returning the secret and its otpauth URI, and disables TOTP on DELETE
+// given a valid code
+func handleTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		username, err := userRepo.GetUsername(r.Context(), userID)
+		if err != nil {
+			http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+			return
+		}
+
+		secret, err := auth.NewTOTPSecret()
+		if err != nil {
+			http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+			return
+		}
+
+		err = mfaRepo.StartTOTPEnrollment(r.Context(), userID, secret)
+		if errors.Is(err, repository.ErrTOTPAlreadyEnabled) {
+			http.Error(w, "TOTP is already enabled", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]string{
+			"secret":      secret,
+			"otpauth_uri": auth.TOTPURI(totpIssuer(), username, secret),
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodDelete:
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !checkSecondFactor(w, r, userID, req.Code) {
+			return
+		}
+
+		if err := mfaRepo.DisableTOTP(r.Context(), userID); err != nil {
+			http.Error(w, "Failed to disable TOTP", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// checkSecondFactor verifies the code of a signed-in user under the same lockout as handleLoginMFA, so a stolen
+// session cannot be used to guess codes. It answers the request unless the code is right.
+func checkSecondFactor(w http.ResponseWriter, r *http.Request, userID int, code string) bool {
+	ctx := r.Context()
+	username, err := userRepo.GetUsername(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch username", "error", err)
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return false
+	}
+	if loginLocked(w, r, username) {
+		return false
+	}
+
+	ok, err := verifySecondFactor(ctx, userID, code)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to verify second factor", "error", err)
+		http.Error(w, "Failed to verify code", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		recordLoginFailure(ctx, r, username)
+		http.Error(w, "Invalid code", http.StatusForbidden)
+		return false
+	}
+	recordLoginSuccess(ctx, username)
+	return true
+}
+
+// handleConfirmTOTP enables TOTP once the user proves their app produces valid codes, the response holds the
+// recovery codes, which are never shown again
+func handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	state, err := mfaRepo.GetTOTP(r.Context(), userID)
+	if errors.Is(err, repository.ErrTOTPNotFound) {
+		http.Error(w, "No TOTP enrollment in progress", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to confirm TOTP", http.StatusInternalServerError)
+		return
+	}
+	if state.Enabled {
+		http.Error(w, "TOTP is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := auth.VerifyTOTP(state.Secret, req.Code, time.Now(), state.LastUsedStep)
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to confirm TOTP", http.StatusInternalServerError)
+		return
+	}
+
+	err = mfaRepo.EnableTOTP(r.Context(), userID, step, hashes)
+	if errors.Is(err, repository.ErrTOTPAlreadyEnabled) {
+		http.Error(w, "TOTP is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to confirm TOTP", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleRegenerateRecoveryCodes replaces all recovery codes given a valid code, e.g. when they are running out
+func handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !checkSecondFactor(w, r, userID, req.Code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if err := mfaRepo.ReplaceRecoveryCodes(r.Context(), userID, hashes); err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
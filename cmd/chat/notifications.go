@@ -0,0 +1,197 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/markup"
+	"chat-app/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	defaultNotificationPageSize = 50
+	maxNotificationPageSize     = 200
+)
+
+// notifyForMessage stores the notifications a new message triggers and pushes each one to all connections of its recipient.
+// Failures are only logged, the message itself was already posted.
+func notifyForMessage(ctx context.Context, msg repository.Message) {
+	var doc markup.Document
+	if len(msg.Formatted) > 0 {
+		if err := json.Unmarshal(msg.Formatted, &doc); err != nil {
+			slog.Error("Failed to decode formatted message", "error", err)
+		}
+	}
+	if len(doc.Mentions) == 0 && msg.Content == "" {
+		return
+	}
+
+	notifications, err := notificationRepo.CreateForMessage(ctx, msg, doc.Mentions)
+	if err != nil {
+		slog.Error("Failed to create notifications", "error", err)
+		return
+	}
+
+	for _, notification := range notifications {
+		chat.SendEventToUser(notification.UserID, chat.Event{
+			Type:    chat.EventNotification,
+			Payload: notification,
+		})
+	}
+}
+
+// handleListNotifications is the user's inbox, newest first, optionally limited to unread notifications
+func handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	unreadOnly := query.Get("unread") == "true"
+
+	limit := defaultNotificationPageSize
+	var err error
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = utils.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxNotificationPageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	before := 0
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		before, err = utils.Atoi(beforeStr)
+		if err != nil || before < 0 {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+	}
+
+	notifications, err := notificationRepo.ListNotifications(r.Context(), userID, unreadOnly, before, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	unreadCount, err := notificationRepo.CountUnread(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread_count":  unreadCount,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleMarkNotificationsRead marks the listed notifications as read, or every notification with "all"
+func handleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		IDs []int `json:"ids"`
+		All bool  `json:"all"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || (len(req.IDs) == 0 && !req.All) || (len(req.IDs) > 0 && req.All) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := notificationRepo.MarkRead(r.Context(), userID, req.IDs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	unreadCount, err := notificationRepo.CountUnread(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"unread_count": unreadCount,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleNotificationKeywords returns (GET) or replaces (PUT) the keywords the user is notified about
+func handleNotificationKeywords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Keywords []string `json:"keywords"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		keywords, err := repository.NormalizeKeywords(req.Keywords)
+		if errors.Is(err, repository.ErrInvalidKeyword) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := notificationRepo.SetKeywords(r.Context(), userID, keywords); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	keywords, err := notificationRepo.ListKeywords(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"keywords": keywords,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
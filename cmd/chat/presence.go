@@ -0,0 +1,35 @@
+package chat
+
+import (
+	"chat-app/internal/chat"
+	"chat-app/internal/utils"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const presenceSweepInterval = 30 * time.Second
+
+// handleChatroomPresence lists who is connected to a chatroom along with their online/away status
+func handleChatroomPresence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"chatroom_id": chatroomID,
+		"presence":    chat.GetChatroomPresence(chatroomID),
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
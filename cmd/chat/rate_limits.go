@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/ratelimit"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes of the WebSocket error frames
+const (
+	errorRateLimited      = "rate_limited"
+	errorInvalidMessage   = "invalid_message"
+	errorChatroomArchived = "chatroom_archived"
+)
+
+// Limits per route class, each can be overridden with an environment variable such as RATE_LIMIT_WRITE=30/m:10
+var (
+	authLimiter    = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_AUTH", ratelimit.Every(time.Minute, 10, 10)))       // Per client address
+	readLimiter    = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_READ", ratelimit.Every(time.Minute, 300, 60)))      // Per user
+	writeLimiter   = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_WRITE", ratelimit.Every(time.Minute, 60, 20)))      // Per user, REST and WebSocket messages alike
+	stockLimiter   = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_STOCK", ratelimit.Every(time.Minute, 5, 2)))        // Per user
+	wsFrameLimiter = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_WS_FRAMES", ratelimit.Every(time.Minute, 120, 30))) // Per user, any frame
+	hookLimiter    = ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_HOOKS", ratelimit.Every(time.Minute, 60, 20)))      // Per incoming webhook
+)
+
+// userKey keys requests by the authenticated user, falling back to the client address
+func userKey(r *http.Request) string {
+	if userID, ok := r.Context().Value(auth.UserIDKey).(int); ok {
+		return userBucket(userID)
+	}
+	return ratelimit.ClientIP(r)
+}
+
+func userBucket(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// limited applies the user's read limit to GET requests and their write limit to the others.
+// It goes inside the auth middleware, which identifies the user.
+func limited(next http.HandlerFunc) http.Handler {
+	read := ratelimit.Middleware(readLimiter, userKey)(next)
+	write := ratelimit.Middleware(writeLimiter, userKey)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			read.ServeHTTP(w, r)
+			return
+		}
+		write.ServeHTTP(w, r)
+	})
+}
+
+// allowFrame takes a token from the user's bucket in the limiter, a WebSocket client over the limit gets an error frame
+func allowFrame(client *chat.Client, limiter *ratelimit.Limiter) bool {
+	allowed, wait := limiter.Allow(userBucket(client.UserID))
+	if !allowed {
+		sendError(client, errorRateLimited, "Too many requests, slow down", wait)
+	}
+	return allowed
+}
+
+func sendError(client *chat.Client, code, message string, retryAfter time.Duration) {
+	payload := chat.ErrorPayload{Code: code, Message: message}
+	if retryAfter > 0 {
+		payload.RetryAfter = ratelimit.RetryAfterSeconds(retryAfter)
+	}
+
+	// A failing write shows up as a read error in the WebSocket loop, which closes the connection
+	_ = client.WriteJSON(chat.Event{Type: chat.EventError, Payload: payload})
+}
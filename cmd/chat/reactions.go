@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/webhook"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// handleReactions adds (POST) or removes (DELETE) the caller's reaction on a message
+func handleReactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChatroomID int    `json:"chatroom_id"`
+		MessageID  int    `json:"message_id"`
+		Emoji      string `json:"emoji"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.ChatroomID <= 0 || req.MessageID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	added := r.Method == http.MethodPost
+	var count int
+	if added {
+		count, err = reactionRepo.AddReaction(r.Context(), req.ChatroomID, req.MessageID, userID, req.Emoji)
+	} else {
+		count, err = reactionRepo.RemoveReaction(r.Context(), req.ChatroomID, req.MessageID, userID, req.Emoji)
+	}
+	if errors.Is(err, repository.ErrInvalidEmoji) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	payload := chat.ReactionPayload{
+		ChatroomID: req.ChatroomID,
+		MessageID:  req.MessageID,
+		UserID:     userID,
+		Emoji:      req.Emoji,
+		Count:      count,
+		Added:      added,
+	}
+	chat.BroadcastEventToChatroom(req.ChatroomID, chat.Event{
+		Type:    chat.EventReactionUpdated,
+		Payload: payload,
+	})
+
+	eventType := webhook.EventReactionAdded
+	if !added {
+		eventType = webhook.EventReactionRemoved
+	}
+	emitWebhookEvent(r.Context(), req.ChatroomID, eventType, payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(payload)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// markRead moves the user's read marker forward and broadcasts the receipt to the room
+func markRead(ctx context.Context, userID, chatroomID, messageID int) error {
+	state, err := readStateRepo.MarkRead(ctx, userID, chatroomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	chat.BroadcastEventToChatroom(chatroomID, chat.Event{
+		Type:    chat.EventReadReceipt,
+		Payload: state,
+	})
+
+	return nil
+}
+
+func handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChatroomID int `json:"chatroom_id"`
+		MessageID  int `json:"message_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.ChatroomID <= 0 || req.MessageID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = markRead(r.Context(), userID, req.ChatroomID, req.MessageID)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListReadReceipts returns how far each user has read in a chatroom, so clients can render receipts on load
+func handleListReadReceipts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+		return
+	}
+
+	states, err := readStateRepo.ListReadStates(r.Context(), chatroomID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"read_receipts": states,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	maxSearchQueryLength  = 256
+)
+
+// handleSearch runs a full-text search over the rooms the caller has joined.
+// Optional filters: chatroom_id, author_id, from and to (RFC 3339), paginated with limit and before.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	query := repository.SearchQuery{
+		UserID: userID,
+		Text:   strings.TrimSpace(params.Get("q")),
+		Limit:  defaultSearchPageSize,
+	}
+	if query.Text == "" || len(query.Text) > maxSearchQueryLength {
+		http.Error(w, "Invalid q", http.StatusBadRequest)
+		return
+	}
+
+	intParams := []struct {
+		name  string
+		value *int
+		max   int
+	}{
+		{"chatroom_id", &query.ChatroomID, 0},
+		{"author_id", &query.AuthorID, 0},
+		{"before", &query.Before, 0},
+		{"limit", &query.Limit, maxSearchPageSize},
+	}
+	for _, param := range intParams {
+		raw := params.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := utils.Atoi(raw)
+		if err != nil || value <= 0 || (param.max > 0 && value > param.max) {
+			http.Error(w, "Invalid "+param.name, http.StatusBadRequest)
+			return
+		}
+		*param.value = value
+	}
+
+	timeParams := []struct {
+		name  string
+		value **time.Time
+	}{
+		{"from", &query.From},
+		{"to", &query.To},
+	}
+	for _, param := range timeParams {
+		raw := params.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		value, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid "+param.name+", expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+		*param.value = &value
+	}
+
+	results, err := messageRepo.SearchMessages(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Results are ordered by ID descending, the client passes next_cursor back as 'before'
+	var nextCursor *int
+	if len(results) == query.Limit {
+		nextCursor = &results[len(results)-1].MessageID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"results":     results,
+		"next_cursor": nextCursor,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,250 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/oidc"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	oidcPathPrefix = "/auth/oidc/"
+	// How long a user may spend at their identity provider before the sign-in has to start over
+	oidcLoginStateTTL = 10 * time.Minute
+	// oidcStateCookie ties a sign-in to the browser that started it, it holds the hash of the state
+	oidcStateCookie = "oidc_state"
+)
+
+// oidcClients holds the configured identity providers by name
+var oidcClients = make(map[string]*oidc.Client)
+
+func setupOIDCProviders() error {
+	providers, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		return err
+	}
+
+	for _, provider := range providers {
+		oidcClients[provider.Name] = oidc.NewClient(provider)
+	}
+	return nil
+}
+
+// handleListOIDCProviders lists the providers users can sign in with, so clients can show a button for each
+func handleListOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	names := make([]string, 0, len(oidcClients))
+	for name := range oidcClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string][]string{"providers": names}); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleOIDC serves /auth/oidc/<provider>/login, which sends the browser to the provider, and
+// /auth/oidc/<provider>/callback, where the provider sends it back
+func handleOIDC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, oidcPathPrefix), "/")
+	client, ok := oidcClients[name]
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "login":
+		startOIDCLogin(w, r, client)
+	case "callback":
+		finishOIDCLogin(w, r, client)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startOIDCLogin(w http.ResponseWriter, r *http.Request, client *oidc.Client) {
+	state, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := client.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		slog.Error("Failed to build authorization URL", "error", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	err = identityRepo.SaveLoginState(r.Context(), repository.OIDCLoginState{
+		State:        state,
+		Provider:     client.Provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, newOIDCStateCookie(r, hashOIDCState(state), int(oidcLoginStateTTL.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// newOIDCStateCookie is sent back on the provider's redirect to the callback (SameSite=Lax allows top-level GETs)
+// but never to a page that links there from another site's sign-in. A negative maxAge deletes the cookie.
+func newOIDCStateCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcPathPrefix,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+func finishOIDCLogin(w http.ResponseWriter, r *http.Request, client *oidc.Client) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		http.Error(w, "Sign-in was refused by the identity provider: "+providerError, http.StatusUnauthorized)
+		return
+	}
+	if query.Get("state") == "" || query.Get("code") == "" {
+		http.Error(w, "Missing state or code", http.StatusBadRequest)
+		return
+	}
+
+	// Without this check, anyone could start a sign-in of their own and have a victim's browser finish it, which
+	// would log the victim into the attacker's account
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(hashOIDCState(query.Get("state")))) != 1 {
+		http.Error(w, "Sign-in was not started in this browser, start over", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, newOIDCStateCookie(r, "", -1))
+
+	ctx := r.Context()
+	state, err := identityRepo.ConsumeLoginState(ctx, query.Get("state"), client.Provider.Name, oidcLoginStateTTL)
+	if errors.Is(err, repository.ErrLoginStateNotFound) {
+		http.Error(w, "Sign-in expired or was already used, start over", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to finish sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	identity, err := client.Exchange(ctx, query.Get("code"), state.CodeVerifier, state.Nonce)
+	if errors.Is(err, oidc.ErrInvalidIDToken) || errors.Is(err, oidc.ErrExchangeFailed) {
+		slog.Error("Rejected sign-in", "error", err)
+		http.Error(w, "Sign-in failed", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.Error("Failed to finish sign-in", "error", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	userID, username, created, err := identityRepo.FindOrProvisionUser(ctx, repository.ExternalIdentity{
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	}, auth.SuggestUsernames(identity.PreferredUsername, identity.Name, identity.Email))
+	if err != nil {
+		slog.Error("Failed to provision user", "error", err)
+		http.Error(w, "Failed to finish sign-in", http.StatusInternalServerError)
+		return
+	}
+	if created {
+		slog.InfoContext(ctx, "Provisioned user", "username", username, "provider", client.Provider.Name, "subject", identity.Subject)
+	}
+	if accountDisabled(ctx, w, userID) {
+		return
+	}
+
+	mfaEnabled, err := mfaRepo.IsTOTPEnabled(ctx, userID)
+	if err != nil {
+		http.Error(w, "Failed to finish sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	var result map[string]string
+	if mfaEnabled {
+		mfaToken, err := auth.GenerateMFAPendingToken(userID, username)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		result = map[string]string{"mfa_token": mfaToken}
+	} else {
+		token, err := auth.GenerateJWT(userID, username)
+		if err != nil {
+			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		result = map[string]string{"token": token}
+	}
+
+	writeSignInResult(w, r, result)
+}
+
+// writeSignInResult hands the token to the web client through the fragment of OIDC_SUCCESS_REDIRECT, which never
+// reaches a server. Without it the token is returned as JSON, like /login does.
+func writeSignInResult(w http.ResponseWriter, r *http.Request, result map[string]string) {
+	if redirect := os.Getenv("OIDC_SUCCESS_REDIRECT"); redirect != "" {
+		fragment := url.Values{}
+		for key, value := range result {
+			fragment.Set(key, value)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, redirect+"#"+fragment.Encode(), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const (
+	defaultThreadPageSize = 50
+	maxThreadPageSize     = 200
+)
+
+// postReply stores a thread reply and lets every client in the chatroom know about it,
+// so open threads get the new reply and room views can bump the root's reply counter.
+func postReply(ctx context.Context, parentID int, input repository.NewMessage) (repository.Message, error) {
+	reply, thread, err := messageRepo.AddReply(ctx, parentID, input)
+	if err != nil {
+		return repository.Message{}, err
+	}
+
+	chat.BroadcastEventToChatroom(input.ChatroomID, chat.Event{
+		Type: chat.EventThreadReply,
+		Payload: chat.ThreadReplyPayload{
+			Reply:  reply,
+			Thread: thread,
+		},
+	})
+
+	return reply, nil
+}
+
+func handleGetThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	messageID, err := utils.Atoi(r.URL.Query().Get("message_id"))
+	if err != nil || messageID <= 0 {
+		http.Error(w, "Invalid message_id", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultThreadPageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = utils.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxThreadPageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	after := 0
+	if afterStr := r.URL.Query().Get("after"); afterStr != "" {
+		after, err = utils.Atoi(afterStr)
+		if err != nil || after < 0 {
+			http.Error(w, "Invalid after cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	root, replies, err := messageRepo.GetThread(r.Context(), messageID, after, limit)
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, repository.ErrInvalidParent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A full page means there may be more replies, the client passes next_cursor back as 'after'
+	var nextCursor *int
+	if len(replies) == limit {
+		nextCursor = &replies[len(replies)-1].ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"root":        root,
+		"replies":     replies,
+		"next_cursor": nextCursor,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
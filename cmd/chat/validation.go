@@ -0,0 +1,18 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"encoding/json"
+	"net/http"
+)
+
+// writeValidationError answers with the rejected fields as JSON, e.g.
+// {"error": "Validation failed", "fields": [{"field": "password", "code": "too_short", "message": "..."}]}
+func writeValidationError(w http.ResponseWriter, status int, fields ...auth.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Validation failed",
+		"fields": fields,
+	})
+}
@@ -0,0 +1,314 @@
+package chat
+
+import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/utils"
+	"chat-app/internal/webhook"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookDispatchInterval    = 5 * time.Second
+	defaultDeliveryLogPageSize = 50
+	maxDeliveryLogPageSize     = 200
+)
+
+// emitWebhookEvent queues the event for the chatroom's subscribed webhooks, the dispatcher sends it in the background.
+// Failures are only logged, the action that triggered the event already happened.
+func emitWebhookEvent(ctx context.Context, chatroomID int, eventType string, data interface{}) {
+	payload, err := webhook.NewEnvelope(eventType, chatroomID, data)
+	if err != nil {
+		slog.Error("Failed to encode webhook event", "error", err)
+		return
+	}
+
+	if _, err := webhookRepo.EnqueueEvent(ctx, chatroomID, eventType, payload); err != nil {
+		slog.Error("Failed to queue webhook event", "error", err)
+	}
+}
+
+// requireMember answers 403 and returns false when the user has not joined the chatroom
+func requireMember(w http.ResponseWriter, r *http.Request, chatroomID, userID int) bool {
+	isMember, err := chatroomRepo.IsMember(r.Context(), chatroomID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !isMember {
+		http.Error(w, "Not a member of the chatroom", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// webhookCreatorFilter limits the webhooks a user sees and manages to their own, administrators have all of them
+func webhookCreatorFilter(userID int, isAdmin bool) int {
+	if isAdmin {
+		return 0
+	}
+	return userID
+}
+
+// requireMemberOrAdmin answers 403 unless the user has joined the chatroom or is an administrator,
+// it reports whether the user is an administrator
+func requireMemberOrAdmin(w http.ResponseWriter, r *http.Request, chatroomID, userID int) (bool, bool) {
+	isAdmin, err := userRepo.IsAdmin(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return false, false
+	}
+	if isAdmin {
+		return true, true
+	}
+	return false, requireMember(w, r, chatroomID, userID)
+}
+
+// requireWebhookManager answers 403 unless the user created the webhook or is an administrator.
+// Other members of the chatroom can list its webhooks but not change them or read their deliveries.
+func requireWebhookManager(w http.ResponseWriter, r *http.Request, chatroomID, webhookID, userID int) bool {
+	isAdmin, ok := requireMemberOrAdmin(w, r, chatroomID, userID)
+	if !ok {
+		return false
+	}
+
+	webhook, err := webhookRepo.GetWebhook(r.Context(), chatroomID, webhookID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !isAdmin && webhook.CreatedBy != userID {
+		http.Error(w, "Only the creator of the webhook or an administrator can manage it", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleWebhooks lists (GET), creates (POST) or deletes (DELETE) the outgoing webhooks of a chatroom, members only.
+// Members only see and delete the webhooks they created, administrators all of them. The signing secret is only
+// returned by the creation.
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+		if err != nil || chatroomID <= 0 {
+			http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+			return
+		}
+		// Webhook URLs often carry credentials, so members only see their own
+		isAdmin, ok := requireMemberOrAdmin(w, r, chatroomID, userID)
+		if !ok {
+			return
+		}
+
+		webhooks, err := webhookRepo.ListWebhooks(r.Context(), chatroomID, webhookCreatorFilter(userID, isAdmin))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(map[string]interface{}{
+			"webhooks": webhooks,
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodPost:
+		var req struct {
+			ChatroomID int      `json:"chatroom_id"`
+			URL        string   `json:"url"`
+			Events     []string `json:"events"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.ChatroomID <= 0 {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := webhook.ValidateURL(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := webhook.ValidateEvents(req.Events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !requireMember(w, r, req.ChatroomID, userID) {
+			return
+		}
+
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		created, err := webhookRepo.CreateWebhook(r.Context(), req.ChatroomID, userID, req.URL, secret, req.Events)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(created)
+		if err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodDelete:
+		chatroomID, err := utils.Atoi(r.URL.Query().Get("chatroom_id"))
+		if err != nil || chatroomID <= 0 {
+			http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+			return
+		}
+		webhookID, err := utils.Atoi(r.URL.Query().Get("webhook_id"))
+		if err != nil || webhookID <= 0 {
+			http.Error(w, "Invalid webhook_id", http.StatusBadRequest)
+			return
+		}
+		if !requireWebhookManager(w, r, chatroomID, webhookID, userID) {
+			return
+		}
+
+		err = webhookRepo.DeleteWebhook(r.Context(), chatroomID, webhookID)
+		if errors.Is(err, repository.ErrWebhookNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEnableWebhook turns back on a webhook that was disabled after repeated failures, for its creator or an administrator
+func handleEnableWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChatroomID int `json:"chatroom_id"`
+		WebhookID  int `json:"webhook_id"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.ChatroomID <= 0 || req.WebhookID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !requireWebhookManager(w, r, req.ChatroomID, req.WebhookID, userID) {
+		return
+	}
+
+	enabled, err := webhookRepo.EnableWebhook(r.Context(), req.ChatroomID, req.WebhookID)
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(enabled)
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleWebhookDeliveries is the delivery log of a webhook, newest first, for its creator or an administrator
+func handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	chatroomID, err := utils.Atoi(query.Get("chatroom_id"))
+	if err != nil || chatroomID <= 0 {
+		http.Error(w, "Invalid chatroom_id", http.StatusBadRequest)
+		return
+	}
+	webhookID, err := utils.Atoi(query.Get("webhook_id"))
+	if err != nil || webhookID <= 0 {
+		http.Error(w, "Invalid webhook_id", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultDeliveryLogPageSize
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = utils.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxDeliveryLogPageSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	before := 0
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		before, err = utils.Atoi(beforeStr)
+		if err != nil || before < 0 {
+			http.Error(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !requireWebhookManager(w, r, chatroomID, webhookID, userID) {
+		return
+	}
+
+	deliveries, err := webhookRepo.ListDeliveries(r.Context(), chatroomID, webhookID, before, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"chat-app/cmd/admin"
 	"chat-app/cmd/text"
+	"chat-app/internal/logging"
+	"chat-app/internal/tracing"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 
 	"chat-app/cmd/bot"
@@ -13,34 +18,58 @@ import (
 
 func main() {
 	// Define a CLI flag to choose between chat and bot
-	appType := flag.String("app", "", "Specify the application to run: 'chat' or 'bot'")
+	appType := flag.String("app", "", "Specify the application to run: 'chat', 'bot', 'text' or 'admin'")
 	flag.Parse()
 
 	if *appType == "" {
 		fmt.Println("Usage: go run main.go -app=<application>")
-		fmt.Println("Available applications: 'chat', 'bot'")
+		fmt.Println("Available applications: 'chat', 'bot', 'text', 'admin'")
 		os.Exit(1)
 	}
 
 	// Run the selected application based on the provided flag
 	switch *appType {
 	case "chat":
-		log.Println("Starting Chat Application...")
+		logging.Setup("chat")
+		defer startTracing("chat")()
+		slog.Info("Starting Chat Application...")
 		if err := chat.RunChatServer(); err != nil {
-			log.Fatalf("Failed to run chat server: %v", err)
+			logging.Fatal("Failed to run chat server", "error", err)
 		}
 	case "bot":
-		log.Println("Starting Bot Application...")
+		logging.Setup("bot")
+		defer startTracing("bot")()
+		slog.Info("Starting Bot Application...")
 		if err := bot.RunBotServer(); err != nil {
-			log.Fatalf("Failed to run bot: %v", err)
+			logging.Fatal("Failed to run bot", "error", err)
 		}
 	case "text":
-		log.Println("Starting Text Application...")
+		logging.Setup("text")
+		defer startTracing("text")()
+		slog.Info("Starting Text Application...")
 		if err := text.RunTextServer(); err != nil {
-			log.Fatalf("Failed to run text server: %v", err)
+			logging.Fatal("Failed to run text server", "error", err)
+		}
+	case "admin":
+		if err := admin.RunAdminCommand(flag.Args()); err != nil {
+			log.Fatalf("Admin command failed: %v", err)
 		}
 	default:
-		fmt.Printf("Unknown application '%s'. Available options: 'chat', 'bot', 'text'\n", *appType)
+		fmt.Printf("Unknown application '%s'. Available options: 'chat', 'bot', 'text', 'admin'\n", *appType)
 		os.Exit(1)
 	}
 }
+
+// startTracing sets up tracing for the service, the returned function flushes the spans still buffered
+func startTracing(service string) func() {
+	shutdown, err := tracing.Setup(context.Background(), service)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
+	return func() {
+		if err := shutdown(context.Background()); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}
+}
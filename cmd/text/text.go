@@ -1,10 +1,17 @@
 package text
 
 import (
+	"chat-app/internal/auth"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/health"
+	"chat-app/internal/logging"
+	"chat-app/internal/metrics"
+	"chat-app/internal/ratelimit"
 	"chat-app/internal/storage"
 	"chat-app/internal/text"
+	"chat-app/internal/tracing"
 	"chat-app/internal/utils"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -12,13 +19,37 @@ import (
 func RunTextServer() error {
 	db, err := storage.SetupDatabaseConnection()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logging.Fatal("Failed to connect to database", "error", err)
 	}
 	defer db.Close()
+	metrics.RegisterDB(db.Conn, "chatdb")
 
-	http.HandleFunc("/text/", func(w http.ResponseWriter, r *http.Request) {
+	// Tokens are issued by the chat server, the text server only verifies them against its published keys
+	auth.UseRemoteKeys(utils.GetEnv("JWKS_URL", "http://localhost:8080/.well-known/jwks.json"))
+	// Disabled accounts and revoked sessions are refused here too, the text server shares the chat server's users
+	auth.UseSessionCheck(repository.NewUserRepository(db.Conn).SessionCheck)
+
+	readLimiter := ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_TEXT_READ", ratelimit.Every(time.Minute, 120, 30)))
+	writeLimiter := ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_TEXT_WRITE", ratelimit.Every(time.Minute, 20, 5)))
+	textRoom := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		text.HandleTextRoom(w, r, db)
 	})
+	readTextRoom := ratelimit.Middleware(readLimiter, ratelimit.ClientIP)(textRoom)
+	writeTextRoom := ratelimit.Middleware(writeLimiter, ratelimit.ClientIP)(textRoom)
+	http.Handle("/metrics", metrics.Handler())
+
+	checker := health.NewChecker("text")
+	checker.Add("database", db.Ping)
+	checker.Add("migrations", db.CheckSchema)
+	checker.Register(http.DefaultServeMux)
+
+	http.Handle("/text/", auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			readTextRoom.ServeHTTP(w, r)
+			return
+		}
+		writeTextRoom.ServeHTTP(w, r)
+	})))
 
 	server := &http.Server{
 		Addr:         ":8082",
@@ -26,9 +57,9 @@ func RunTextServer() error {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
 		// TODO: REMOVE THE CORS MIDDLEWARE FOR PROD ENVIRONMENT
-		Handler: utils.CorsMiddleware(http.DefaultServeMux),
+		Handler: utils.CorsMiddleware(logging.Middleware(tracing.Middleware(metrics.Middleware(http.DefaultServeMux)))),
 	}
 
-	log.Println("Text server is running on http://localhost:8082")
+	slog.Info("Text server is running on http://localhost:8082")
 	return server.ListenAndServe()
 }
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token, it tells them apart from JWTs
+const APITokenPrefix = "cat_"
+
+// APITokenKey holds the APIToken of requests authenticated with one, it is absent for user sessions
+const APITokenKey contextKey = "apiToken"
+
+// Scopes an API token can be granted
+const (
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+var Scopes = []string{ScopeMessagesRead, ScopeMessagesWrite}
+
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+// APIToken is what a valid API token grants: acting as its owner, with the given scopes, in the given chatrooms only
+type APIToken struct {
+	ID          int
+	UserID      int
+	Scopes      []string
+	ChatroomIDs []int
+}
+
+// APITokenLookup resolves a presented token, it returns ErrInvalidAPIToken for unknown, revoked or expired tokens
+type APITokenLookup func(ctx context.Context, token string) (APIToken, error)
+
+// NewAPIToken generates a token to hand out once, only its hash is stored
+func NewAPIToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate api token: %w", err)
+	}
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// HashAPIToken is the stored form of a token. Tokens are random, so a plain SHA-256 is enough, unlike passwords.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidScopes reports whether every scope is known, at least one is required
+func ValidScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsChatroom reports whether the request may act in the chatroom: always for user sessions,
+// only for the listed chatrooms for API tokens
+func AllowsChatroom(ctx context.Context, chatroomID int) bool {
+	token, ok := ctx.Value(APITokenKey).(APIToken)
+	return !ok || slices.Contains(token.ChatroomIDs, chatroomID)
+}
+
+// MiddlewareWithAPITokens accepts user sessions like Middleware, as well as API tokens granted the scope
+func MiddlewareWithAPITokens(lookup APITokenLookup, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		jwtMiddleware := Middleware(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || !strings.HasPrefix(tokenString, APITokenPrefix) {
+				jwtMiddleware.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := lookup(r.Context(), tokenString)
+			if errors.Is(err, ErrInvalidAPIToken) {
+				http.Error(w, "Invalid or revoked API token", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if sessionCheck != nil {
+				if err := sessionCheck(r.Context(), token.UserID, time.Time{}); err != nil {
+					writeSessionError(w, err)
+					return
+				}
+			}
+			if !slices.Contains(token.Scopes, scope) {
+				http.Error(w, "API token lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, token.UserID)
+			ctx = context.WithValue(ctx, APITokenKey, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
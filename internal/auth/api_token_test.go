@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	token, err := NewAPIToken()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, APITokenPrefix))
+
+	other, err := NewAPIToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	assert.Len(t, HashAPIToken(token), 64)
+	assert.Equal(t, HashAPIToken(token), HashAPIToken(token))
+}
+
+func TestValidScopes(t *testing.T) {
+	assert.True(t, ValidScopes([]string{ScopeMessagesWrite}))
+	assert.False(t, ValidScopes(nil))
+	assert.False(t, ValidScopes([]string{ScopeMessagesRead, "admin"}))
+}
+
+func TestMiddlewareWithAPITokens(t *testing.T) {
+	valid := "cat_valid"
+	lookup := func(_ context.Context, token string) (APIToken, error) {
+		if token != valid {
+			return APIToken{}, ErrInvalidAPIToken
+		}
+		return APIToken{ID: 1, UserID: 7, Scopes: []string{ScopeMessagesWrite}, ChatroomIDs: []int{3}}, nil
+	}
+
+	var gotUserID int
+	var allowed3, allowed4 bool
+	handler := MiddlewareWithAPITokens(lookup, ScopeMessagesWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = r.Context().Value(UserIDKey).(int)
+		allowed3 = AllowsChatroom(r.Context(), 3)
+		allowed4 = AllowsChatroom(r.Context(), 4)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve("Bearer "+valid))
+	assert.Equal(t, 7, gotUserID)
+	assert.True(t, allowed3)
+	assert.False(t, allowed4)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("Bearer cat_revoked"))
+
+	readOnly := MiddlewareWithAPITokens(lookup, ScopeMessagesRead)(http.NotFoundHandler())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+valid)
+	rec := httptest.NewRecorder()
+	readOnly.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	jwt, err := GenerateJWT(9, "human")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, serve("Bearer "+jwt))
+	assert.Equal(t, 9, gotUserID)
+	assert.True(t, allowed4, "user sessions are not limited to chatrooms")
+}
+
+func TestMiddleware_SessionCheck(t *testing.T) {
+	UseSessionCheck(func(_ context.Context, userID int, issuedAt time.Time) error {
+		switch {
+		case userID == 2:
+			return ErrAccountDisabled
+		case userID == 3 && !issuedAt.IsZero():
+			return ErrSessionRevoked
+		}
+		return nil
+	})
+	defer UseSessionCheck(nil)
+
+	lookup := func(_ context.Context, token string) (APIToken, error) {
+		return APIToken{ID: 1, UserID: 3, Scopes: []string{ScopeMessagesRead}}, nil
+	}
+	handler := MiddlewareWithAPITokens(lookup, ScopeMessagesRead)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(authorization string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	session := func(userID int) string {
+		token, err := GenerateJWT(userID, "someone")
+		require.NoError(t, err)
+		return "Bearer " + token
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(session(1)))
+	assert.Equal(t, http.StatusForbidden, serve(session(2)))
+	assert.Equal(t, http.StatusUnauthorized, serve(session(3)))
+	assert.Equal(t, http.StatusNoContent, serve("Bearer cat_token"), "API tokens are not sessions")
+}
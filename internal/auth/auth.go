@@ -1,17 +1,34 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
+	"chat-app/internal/utils"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 )
 
-var jwtSecret string
+const (
+	// SessionTTL is how long a session token is valid
+	SessionTTL = 1 * time.Hour
+
+	defaultKeyRotation = 7 * 24 * time.Hour
+)
+
+var (
+	keysMutex sync.Mutex
+	keyring   *Keyring    // Signs tokens, nil in services that only verify them
+	resolver  KeyResolver // Finds the key that signed a token
+)
 
 func init() {
 	_, b, _, _ := runtime.Caller(0)
@@ -22,15 +39,69 @@ func init() {
 	if err != nil {
 		panic("Error loading .env file")
 	}
-	jwtSecret = os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		panic("JWT_SECRET not set in .env file")
+}
+
+// KeyringFromEnv opens the keyring in JWT_KEYS_DIR, generating JWT_ALGORITHM keys (EdDSA or RS256) every
+// JWT_KEY_ROTATION. Retired keys keep verifying tokens for twice the session lifetime.
+func KeyringFromEnv() (*Keyring, error) {
+	rotation := defaultKeyRotation
+	if value := os.Getenv("JWT_KEY_ROTATION"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid JWT_KEY_ROTATION %q", value)
+		}
+		rotation = parsed
+	}
+
+	return NewKeyring(
+		utils.GetEnv("JWT_KEYS_DIR", "./data/jwt-keys"),
+		utils.GetEnv("JWT_ALGORITHM", AlgorithmEdDSA),
+		rotation,
+		2*SessionTTL,
+	)
+}
+
+// UseKeyring makes this service sign tokens, and verify them, with its own keys
+func UseKeyring(k *Keyring) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	keyring, resolver = k, k
+}
+
+// UseRemoteKeys makes this service verify tokens with the keys another service publishes, e.g.
+// http://chat:8080/.well-known/jwks.json. It can no longer sign tokens.
+func UseRemoteKeys(jwksURL string) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	keyring, resolver = nil, NewRemoteKeys(jwksURL)
+}
+
+// keys returns the configured keys, falling back to KeyringFromEnv when none were set up
+func keys() (*Keyring, KeyResolver, error) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	if resolver == nil {
+		k, err := KeyringFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		keyring, resolver = k, k
 	}
+	return keyring, resolver, nil
 }
 
+// PurposeMFAPending marks tokens that only prove the password was right, they are traded for a session token
+// once the second factor is verified
+const PurposeMFAPending = "mfa_pending"
+
+// MFAPendingTTL is how long a user has to enter their one-time code after the password
+const MFAPendingTTL = 5 * time.Minute
+
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
+	Purpose  string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -39,19 +110,83 @@ func GenerateJWT(userID int, username string) (string, error) {
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)), // 1-hour expiration
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(SessionTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(jwtSecret))
+	return sign(claims)
 }
 
+// GenerateMFAPendingToken issues a short-lived token that ValidateJWT refuses, only ValidateMFAPendingToken accepts it
+func GenerateMFAPendingToken(userID int, username string) (string, error) {
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  PurposeMFAPending,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAPendingTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return sign(claims)
+}
+
+// sign uses the current key of the keyring and names it in the kid header, so verifiers know which key to check
+func sign(claims Claims) (string, error) {
+	k, _, err := keys()
+	if err != nil {
+		return "", err
+	}
+	if k == nil {
+		return "", errors.New("this service only verifies tokens, it has no signing keys")
+	}
+
+	key, err := k.current()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// ValidateJWT accepts session tokens only
 func ValidateJWT(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
-	})
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token purpose")
+	}
+	return claims, nil
+}
+
+func ValidateMFAPendingToken(tokenString string) (*Claims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFAPending {
+		return nil, errors.New("invalid token purpose")
+	}
+	return claims, nil
+}
+
+func parseJWT(tokenString string) (*Claims, error) {
+	_, r, err := keys()
+	if err != nil {
+		slog.Error("Failed to load signing keys", "error", err)
+		return nil, errors.New("invalid token")
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return r.PublicKey(context.Background(), kid)
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}))
 
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -30,8 +30,8 @@ func TestGenerateJWT(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
-	parsedToken, err := jwt.Parse(token, func(_ *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
+	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return keyring.PublicKey(context.Background(), token.Header["kid"].(string))
 	})
 
 	assert.NoError(t, err)
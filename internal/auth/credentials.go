@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 32
+	MinPasswordLength = 10
+	MaxPasswordBytes  = 72 // bcrypt ignores anything past 72 bytes
+)
+
+// Field error codes, clients can map them to their own messages
+const (
+	CodeRequired = "required"
+	CodeTooShort = "too_short"
+	CodeTooLong  = "too_long"
+	CodeInvalid  = "invalid_characters"
+	CodeTaken    = "taken"
+	CodeWeak     = "too_common"
+	CodeUsername = "contains_username"
+)
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field error of a request, so clients can show them all at once
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+//go:embed breached_passwords.txt
+var defaultBreachedPasswords string
+
+// breachedPasswords returns the lowercase passwords known from breaches. BREACHED_PASSWORDS_FILE can point to a larger
+// list, one password per line, which is used on top of the built-in one. The list is loaded on first use, once .env
+// has been read.
+var breachedPasswords = sync.OnceValue(loadBreachedPasswords)
+
+func loadBreachedPasswords() map[string]bool {
+	passwords := make(map[string]bool)
+	add := func(scanner *bufio.Scanner) {
+		for scanner.Scan() {
+			if password := strings.TrimSpace(scanner.Text()); password != "" && !strings.HasPrefix(password, "#") {
+				passwords[strings.ToLower(password)] = true
+			}
+		}
+	}
+
+	add(bufio.NewScanner(strings.NewReader(defaultBreachedPasswords)))
+
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			slog.Error("Failed to open breached password list", "path", path, "error", err)
+			return passwords
+		}
+		defer file.Close()
+		add(bufio.NewScanner(file))
+	}
+
+	return passwords
+}
+
+// ValidateCredentials checks a new username and password, it returns a *ValidationError listing every problem
+func ValidateCredentials(username, password string) error {
+	fields := append(ValidateUsername(username), ValidatePassword(password, username)...)
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ValidateUsername allows 3 to 32 ASCII letters, digits, '_', '-' and '.', starting and ending with a letter or digit.
+// That keeps usernames free of look-alike characters and lets @mentions pick them out of text.
+func ValidateUsername(username string) []FieldError {
+	invalid := func(code, message string) []FieldError {
+		return []FieldError{{Field: "username", Code: code, Message: message}}
+	}
+
+	switch length := len(username); {
+	case length == 0:
+		return invalid(CodeRequired, "Username is required")
+	case length < MinUsernameLength:
+		return invalid(CodeTooShort, fmt.Sprintf("Username must be at least %d characters", MinUsernameLength))
+	case length > MaxUsernameLength:
+		return invalid(CodeTooLong, fmt.Sprintf("Username must be at most %d characters", MaxUsernameLength))
+	}
+
+	for _, r := range username {
+		if !isAlphanumeric(r) && r != '_' && r != '-' && r != '.' {
+			return invalid(CodeInvalid, "Username may only contain letters, digits, '_', '-' and '.'")
+		}
+	}
+	if !isAlphanumeric(rune(username[0])) || !isAlphanumeric(rune(username[len(username)-1])) {
+		return invalid(CodeInvalid, "Username must start and end with a letter or digit")
+	}
+
+	return nil
+}
+
+// ValidatePassword requires a long enough password that is not derived from the username or known from breaches
+func ValidatePassword(password, username string) []FieldError {
+	invalid := func(code, message string) []FieldError {
+		return []FieldError{{Field: "password", Code: code, Message: message}}
+	}
+
+	switch {
+	case password == "":
+		return invalid(CodeRequired, "Password is required")
+	case utf8.RuneCountInString(password) < MinPasswordLength:
+		return invalid(CodeTooShort, fmt.Sprintf("Password must be at least %d characters", MinPasswordLength))
+	case len(password) > MaxPasswordBytes:
+		return invalid(CodeTooLong, fmt.Sprintf("Password must be at most %d bytes", MaxPasswordBytes))
+	}
+
+	lowered := strings.ToLower(password)
+	if len(username) >= MinUsernameLength && strings.Contains(lowered, strings.ToLower(username)) {
+		return invalid(CodeUsername, "Password must not contain the username")
+	}
+	if breachedPasswords()[lowered] {
+		return invalid(CodeWeak, "Password is too common, it appears in known data breaches")
+	}
+
+	return nil
+}
+
+// NewTemporaryPassword generates a password for administrators to hand out on a reset, four groups of five
+// lowercase letters and digits
+func NewTemporaryPassword() (string, error) {
+	raw := make([]byte, 13)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	encoded := strings.ToLower(base32NoPadding.EncodeToString(raw))[:20]
+	return encoded[:5] + "-" + encoded[5:10] + "-" + encoded[10:15] + "-" + encoded[15:], nil
+}
+
+// SuggestUsernames turns hints such as a display name or an email address into valid usernames, the best first.
+// Numbered variants follow for when those are taken.
+func SuggestUsernames(hints ...string) []string {
+	var bases []string
+	for _, hint := range hints {
+		hint, _, _ = strings.Cut(hint, "@")
+
+		var b strings.Builder
+		for _, r := range strings.ToLower(hint) {
+			switch {
+			case isAlphanumeric(r) || r == '_' || r == '-' || r == '.':
+				b.WriteRune(r)
+			case r == ' ':
+				b.WriteRune('.')
+			}
+		}
+
+		base := strings.Trim(b.String(), "_-.")
+		if len(base) > MaxUsernameLength-3 {
+			base = strings.TrimRight(base[:MaxUsernameLength-3], "_-.") // Leaves room for the numbered variants
+		}
+		if ValidateUsername(base) == nil && !slices.Contains(bases, base) {
+			bases = append(bases, base)
+		}
+	}
+	if len(bases) == 0 {
+		bases = append(bases, "user")
+	}
+
+	suggestions := append([]string(nil), bases...)
+	for i := 2; i < 100; i++ {
+		suggestions = append(suggestions, fmt.Sprintf("%s%d", bases[0], i))
+	}
+	return suggestions
+}
+
+func isAlphanumeric(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateUsername(t *testing.T) {
+	codes := func(fields []FieldError) []string {
+		var codes []string
+		for _, field := range fields {
+			codes = append(codes, field.Code)
+		}
+		return codes
+	}
+
+	assert.Empty(t, ValidateUsername("alice"))
+	assert.Empty(t, ValidateUsername("bob.smith-2_x"))
+	assert.Equal(t, []string{CodeRequired}, codes(ValidateUsername("")))
+	assert.Equal(t, []string{CodeTooShort}, codes(ValidateUsername("ab")))
+	assert.Equal(t, []string{CodeTooLong}, codes(ValidateUsername(strings.Repeat("a", MaxUsernameLength+1))))
+	assert.Equal(t, []string{CodeInvalid}, codes(ValidateUsername("al ice")))
+	assert.Equal(t, []string{CodeInvalid}, codes(ValidateUsername("аlice"))) // Cyrillic a
+	assert.Equal(t, []string{CodeInvalid}, codes(ValidateUsername(".alice")))
+	assert.Equal(t, []string{CodeInvalid}, codes(ValidateUsername("alice-")))
+}
+
+func TestValidatePassword(t *testing.T) {
+	assert.Empty(t, ValidatePassword("correct horse battery", "alice"))
+
+	for password, code := range map[string]string{
+		"":                      CodeRequired,
+		"short":                 CodeTooShort,
+		strings.Repeat("x", 73): CodeTooLong,
+		"Alice-is-the-best":     CodeUsername,
+		"Password123":           CodeWeak,
+		"QWERTYUIOP":            CodeWeak,
+	} {
+		fields := ValidatePassword(password, "alice")
+		require.Len(t, fields, 1, password)
+		assert.Equal(t, "password", fields[0].Field)
+		assert.Equal(t, code, fields[0].Code, password)
+	}
+}
+
+func TestValidateCredentials(t *testing.T) {
+	assert.NoError(t, ValidateCredentials("alice", "correct horse battery"))
+
+	err := ValidateCredentials("", "short")
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Fields, 2)
+	assert.Equal(t, "username", validationErr.Fields[0].Field)
+	assert.Equal(t, "password", validationErr.Fields[1].Field)
+}
+
+func TestSuggestUsernames(t *testing.T) {
+	suggestions := SuggestUsernames("Alice.Smith", "alice@corp.example")
+	assert.Equal(t, []string{"alice.smith", "alice", "alice.smith2", "alice.smith3"}, suggestions[:4])
+
+	suggestions = SuggestUsernames("Jean Dupont", "")
+	assert.Equal(t, "jean.dupont", suggestions[0])
+
+	assert.Equal(t, "mega", SuggestUsernames("Ωmega", "x@y")[0])
+	assert.Equal(t, "user", SuggestUsernames("", "!")[0])
+
+	for _, suggestion := range SuggestUsernames(strings.Repeat("a", 100)) {
+		assert.Empty(t, ValidateUsername(suggestion), suggestion)
+	}
+}
+
+func TestNewTemporaryPassword(t *testing.T) {
+	password, err := NewTemporaryPassword()
+	require.NoError(t, err)
+	assert.Len(t, password, 23)
+	assert.Empty(t, ValidatePassword(password, "alice"))
+
+	other, err := NewTemporaryPassword()
+	require.NoError(t, err)
+	assert.NotEqual(t, password, other)
+}
+
+func TestLoadBreachedPasswords_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nCorrectHorseBattery\n\n"), 0o600))
+	t.Setenv("BREACHED_PASSWORDS_FILE", path)
+
+	passwords := loadBreachedPasswords()
+	assert.True(t, passwords["correcthorsebattery"])
+	assert.False(t, passwords["# comment"])
+}
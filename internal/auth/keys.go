@@ -0,0 +1,422 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-app/internal/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms a Keyring can generate keys for
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const (
+	pemType         = "PRIVATE KEY"
+	pemAlgorithm    = "Algorithm"
+	pemCreatedAt    = "Created-At"
+	rsaKeyBits      = 2048
+	remoteKeysTTL   = 10 * time.Minute
+	remoteKeysRetry = time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeyResolver finds the public key a token was signed with by its kid header
+type KeyResolver interface {
+	PublicKey(ctx context.Context, kid string) (interface{}, error)
+}
+
+type signingKey struct {
+	id        string
+	algorithm string
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+func (k signingKey) method() jwt.SigningMethod {
+	if k.algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Keyring keeps the signing keys of the server in a directory, one PEM file per key. The newest key signs. A new
+// one is generated once it is older than RotateEvery, and retired keys keep verifying tokens for RetainFor, which
+// must outlast the tokens they signed. Servers sharing the directory share the keys.
+type Keyring struct {
+	Dir         string
+	Algorithm   string
+	RotateEvery time.Duration
+	RetainFor   time.Duration
+
+	now func() time.Time
+
+	mutex sync.Mutex
+	keys  []signingKey // Newest first
+}
+
+func NewKeyring(dir, algorithm string, rotateEvery, retainFor time.Duration) (*Keyring, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	k := &Keyring{Dir: dir, Algorithm: algorithm, RotateEvery: rotateEvery, RetainFor: retainFor, now: time.Now}
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// current returns the key to sign with, rotating first when it is due
+func (k *Keyring) current() (signingKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := k.now()
+	if len(k.keys) > 0 && now.Sub(k.keys[0].createdAt) < k.RotateEvery {
+		return k.keys[0], nil
+	}
+
+	// Another server sharing the directory may have rotated already
+	if err := k.loadLocked(); err != nil {
+		return signingKey{}, err
+	}
+	if len(k.keys) > 0 && now.Sub(k.keys[0].createdAt) < k.RotateEvery {
+		return k.keys[0], nil
+	}
+
+	key, err := k.generate(now)
+	if err != nil {
+		return signingKey{}, err
+	}
+	k.keys = append([]signingKey{key}, k.keys...)
+	k.prune(now)
+
+	return key, nil
+}
+
+// PublicKey resolves the keys of the ring, including retired ones still within RetainFor
+func (k *Keyring) PublicKey(_ context.Context, kid string) (interface{}, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if key, ok := k.find(kid); ok {
+		return key.private.Public(), nil
+	}
+
+	// The key may have been generated by another server sharing the directory
+	if err := k.loadLocked(); err != nil {
+		return nil, err
+	}
+	if key, ok := k.find(kid); ok {
+		return key.private.Public(), nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (k *Keyring) find(kid string) (signingKey, bool) {
+	now := k.now()
+	for i, key := range k.keys {
+		// A key is retired once the next one replaced it
+		if i > 0 && now.Sub(k.keys[i-1].createdAt) > k.RetainFor {
+			break
+		}
+		if key.id == kid {
+			return key, true
+		}
+	}
+	return signingKey{}, false
+}
+
+// JWKS is the public key set verifiers fetch from /.well-known/jwks.json
+func (k *Keyring) JWKS() (jwk.Set, error) {
+	if _, err := k.current(); err != nil {
+		return jwk.Set{}, err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	set := jwk.Set{Keys: []jwk.Key{}}
+	now := k.now()
+	for i, key := range k.keys {
+		if i > 0 && now.Sub(k.keys[i-1].createdAt) > k.RetainFor {
+			break
+		}
+		published, err := jwk.FromPublicKey(key.id, key.algorithm, key.private.Public())
+		if err != nil {
+			return jwk.Set{}, err
+		}
+		set.Keys = append(set.Keys, published)
+	}
+	return set, nil
+}
+
+func (k *Keyring) load() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.loadLocked()
+}
+
+func (k *Keyring) loadLocked() error {
+	paths, err := filepath.Glob(filepath.Join(k.Dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to list signing keys: %w", err)
+	}
+
+	keys := make([]signingKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+
+	k.keys = keys
+	return nil
+}
+
+func (k *Keyring) generate(now time.Time) (signingKey, error) {
+	var private crypto.Signer
+	var err error
+	switch k.Algorithm {
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return signingKey{}, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	key := signingKey{id: hex.EncodeToString(id), algorithm: k.Algorithm, private: private, createdAt: now.UTC().Truncate(time.Second)}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	block := &pem.Block{
+		Type:    pemType,
+		Headers: map[string]string{pemAlgorithm: key.algorithm, pemCreatedAt: key.createdAt.Format(time.RFC3339)},
+		Bytes:   der,
+	}
+
+	// Written under a temporary name first, so other servers never read a partial key
+	path := filepath.Join(k.Dir, key.id+".pem")
+	if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(block), 0o600); err != nil {
+		return signingKey{}, fmt.Errorf("failed to store signing key: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return signingKey{}, fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	return key, nil
+}
+
+// prune deletes the keys that are retired for longer than RetainFor
+func (k *Keyring) prune(now time.Time) {
+	for i := 1; i < len(k.keys); i++ {
+		if now.Sub(k.keys[i-1].createdAt) <= k.RetainFor {
+			continue
+		}
+		for _, key := range k.keys[i:] {
+			os.Remove(filepath.Join(k.Dir, key.id+".pem"))
+		}
+		k.keys = k.keys[:i]
+		return
+	}
+}
+
+func readKey(path string) (signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != pemType {
+		return signingKey{}, fmt.Errorf("invalid signing key %s", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("invalid signing key %s: %w", path, err)
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return signingKey{}, fmt.Errorf("invalid signing key %s", path)
+	}
+	createdAt, err := time.Parse(time.RFC3339, block.Headers[pemCreatedAt])
+	if err != nil {
+		return signingKey{}, fmt.Errorf("invalid signing key %s: %w", path, err)
+	}
+
+	return signingKey{
+		id:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+		algorithm: block.Headers[pemAlgorithm],
+		private:   private,
+		createdAt: createdAt,
+	}, nil
+}
+
+// RemoteKeys fetches the public keys of another server's JWKS endpoint, for services that verify tokens
+// without being able to sign them. The set is refetched periodically and when a token names an unknown key.
+// The lock is only held to read or swap the set, one fetch runs at a time and callers that need it wait for it.
+type RemoteKeys struct {
+	URL string
+
+	httpClient *http.Client
+
+	mutex     sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	fetching  chan struct{} // Closed when the fetch in flight is done, nil when there is none
+	fetchErr  error         // Outcome of the last fetch
+}
+
+func NewRemoteKeys(url string) *RemoteKeys {
+	return &RemoteKeys{URL: url, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (r *RemoteKeys) PublicKey(ctx context.Context, kid string) (interface{}, error) {
+	r.mutex.Lock()
+	age := time.Since(r.fetchedAt)
+	key, known := r.keys[kid]
+	if (known && age < remoteKeysTTL) || age < remoteKeysRetry {
+		r.mutex.Unlock()
+		if !known {
+			return nil, ErrUnknownKey
+		}
+		return key, nil
+	}
+
+	done := r.startFetch()
+	r.mutex.Unlock()
+
+	// A known key stays valid while the set is refreshed in the background
+	if known {
+		return key, nil
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if key, known = r.keys[kid]; known {
+		return key, nil
+	}
+	if r.fetchErr != nil {
+		return nil, r.fetchErr
+	}
+	return nil, ErrUnknownKey
+}
+
+// startFetch starts fetching the set unless a fetch is already in flight, and returns the channel closed once it is
+// done. The caller holds the lock. The fetch has its own timeout, a caller giving up does not cancel it for the others.
+func (r *RemoteKeys) startFetch() chan struct{} {
+	if r.fetching != nil {
+		return r.fetching
+	}
+
+	done := make(chan struct{})
+	r.fetching = done
+	go func() {
+		keys, err := r.fetch(context.Background())
+
+		r.mutex.Lock()
+		if err == nil {
+			r.keys = keys
+			r.fetchedAt = time.Now()
+		}
+		r.fetchErr = err
+		r.fetching = nil
+		r.mutex.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (r *RemoteKeys) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing keys: status %d", resp.StatusCode)
+	}
+
+	var set jwk.Set
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode signing keys: %w", err)
+	}
+
+	return set.PublicKeys(), nil
+}
+
+// HandleJWKS serves the public keys of the keyring in use
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	k, _, err := keys()
+	if err != nil || k == nil {
+		http.Error(w, "Signing keys are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	set, err := k.JWKS()
+	if err != nil {
+		http.Error(w, "Failed to load signing keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(set); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
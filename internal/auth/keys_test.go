@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chat-app/internal/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain keeps the keys the tests sign with out of the source tree
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "jwt-keys")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("JWT_KEYS_DIR", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	k, err := NewKeyring(dir, AlgorithmEdDSA, 24*time.Hour, 2*time.Hour)
+	require.NoError(t, err)
+	k.now = func() time.Time { return now }
+
+	first, err := k.current()
+	require.NoError(t, err)
+	again, err := k.current()
+	require.NoError(t, err)
+	assert.Equal(t, first.id, again.id)
+
+	now = now.Add(25 * time.Hour)
+	second, err := k.current()
+	require.NoError(t, err)
+	assert.NotEqual(t, first.id, second.id)
+
+	// The retired key still verifies the tokens it signed, and is still published
+	_, err = k.PublicKey(context.Background(), first.id)
+	assert.NoError(t, err)
+	set, err := k.JWKS()
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 2)
+
+	// Once its tokens have expired it is gone, and deleted on the next rotation
+	now = now.Add(3 * time.Hour)
+	_, err = k.PublicKey(context.Background(), first.id)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	now = now.Add(24 * time.Hour)
+	_, err = k.current()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, first.id+".pem"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestKeyring_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	signer, err := NewKeyring(dir, AlgorithmRS256, time.Hour, time.Hour)
+	require.NoError(t, err)
+	key, err := signer.current()
+	require.NoError(t, err)
+
+	// A second server sharing the directory picks the key up
+	other, err := NewKeyring(dir, AlgorithmRS256, time.Hour, time.Hour)
+	require.NoError(t, err)
+	publicKey, err := other.PublicKey(context.Background(), key.id)
+	require.NoError(t, err)
+	assert.Equal(t, key.private.Public(), publicKey)
+}
+
+func TestRemoteKeys_VerifiesTokens(t *testing.T) {
+	k, err := NewKeyring(t.TempDir(), AlgorithmEdDSA, time.Hour, time.Hour)
+	require.NoError(t, err)
+	key, err := k.current()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		set, err := k.JWKS()
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	remote := NewRemoteKeys(server.URL)
+	publicKey, err := remote.PublicKey(context.Background(), key.id)
+	require.NoError(t, err)
+	assert.Equal(t, key.private.Public(), publicKey)
+
+	_, err = remote.PublicKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestRemoteKeys_FetchesOnceForConcurrentCallers(t *testing.T) {
+	k, err := NewKeyring(t.TempDir(), AlgorithmEdDSA, time.Hour, time.Hour)
+	require.NoError(t, err)
+	key, err := k.current()
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		<-release
+		set, err := k.JWKS()
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	remote := NewRemoteKeys(server.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := remote.PublicKey(context.Background(), key.id)
+			assert.NoError(t, err)
+		}()
+	}
+
+	// A caller that gives up does not wait for the fetch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = remote.PublicKey(ctx, key.id)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestGenerateJWT_NamesItsKey(t *testing.T) {
+	token, err := GenerateJWT(1, "alice")
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	HandleJWKS(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var set jwk.Set
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&set))
+	publicKeys := set.PublicKeys()
+
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return publicKeys[token.Header["kid"].(string)], nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmEdDSA, parsed.Method.Alg())
+}
+
+func TestValidateJWT_RejectsSymmetricTokens(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{UserID: 1}).SignedString([]byte("shared secret"))
+	require.NoError(t, err)
+
+	_, err = ValidateJWT(token)
+	assert.Error(t, err)
+}
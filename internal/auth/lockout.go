@@ -0,0 +1,52 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long logins are refused after a number of consecutive failures
+type LockoutPolicy struct {
+	FreeAttempts    int           // Failures that are not penalized at all
+	BaseDelay       time.Duration // Wait after the first penalized failure, doubled on each further one
+	MaxDelay        time.Duration
+	LockoutAfter    int // Failures after which logins are locked for LockoutDuration
+	LockoutDuration time.Duration
+	Window          time.Duration // Failures older than this are forgotten
+}
+
+var (
+	// AccountLockout applies to a single username, whoever tries it
+	AccountLockout = LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	// AddressLockout applies to a single client address, whichever usernames it tries. It is looser than
+	// AccountLockout since many users can share an address.
+	AddressLockout = LockoutPolicy{
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// Delay returns how long to refuse logins after the given number of consecutive failures
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
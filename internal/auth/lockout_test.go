@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: time.Hour,
+	}
+
+	assert.Zero(t, policy.Delay(0))
+	assert.Zero(t, policy.Delay(3))
+	assert.Equal(t, time.Second, policy.Delay(4))
+	assert.Equal(t, 2*time.Second, policy.Delay(5))
+	assert.Equal(t, 4*time.Second, policy.Delay(6))
+	assert.Equal(t, 5*time.Second, policy.Delay(7))
+	assert.Equal(t, 5*time.Second, policy.Delay(9))
+	assert.Equal(t, time.Hour, policy.Delay(10))
+	assert.Equal(t, time.Hour, policy.Delay(50))
+}
@@ -2,14 +2,60 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
 
+var (
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrSessionRevoked  = errors.New("session was revoked")
+)
+
+// SessionCheck reports whether the user may still act, with ErrAccountDisabled or ErrSessionRevoked when not.
+// issuedAt is zero for API tokens, which are not sessions and are only refused for disabled accounts.
+type SessionCheck func(ctx context.Context, userID int, issuedAt time.Time) error
+
+var sessionCheck SessionCheck
+
+// UseSessionCheck makes every authenticated request run the check, so disabling an account or resetting its
+// password takes effect before the tokens already handed out expire
+func UseSessionCheck(check SessionCheck) {
+	sessionCheck = check
+}
+
+// CheckSession runs the registered SessionCheck, services that did not register one accept every valid token
+func CheckSession(ctx context.Context, claims *Claims) error {
+	if sessionCheck == nil {
+		return nil
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return sessionCheck(ctx, claims.UserID, issuedAt)
+}
+
+// writeSessionError answers requests of disabled accounts and revoked sessions
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrAccountDisabled):
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+	case errors.Is(err, ErrSessionRevoked):
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+	default:
+		slog.Error("Failed to check session", "error", err)
+		http.Error(w, "Failed to check session", http.StatusInternalServerError)
+	}
+}
+
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -32,6 +78,11 @@ func Middleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if err := CheckSession(r.Context(), claims); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The SHA-1 test vectors of RFC 6238, truncated to 6 digits
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+
+	for unix, expected := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+	step := TOTPStep(now)
+	previous, err := TOTPCode(secret, step-1)
+	require.NoError(t, err)
+	old, err := TOTPCode(secret, step-2)
+	require.NoError(t, err)
+
+	matched, ok := VerifyTOTP(secret, previous, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step-1, matched)
+
+	_, ok = VerifyTOTP(secret, previous, now, step-1)
+	assert.False(t, ok, "a used code must not be accepted again")
+
+	_, ok = VerifyTOTP(secret, old, now, 0)
+	assert.False(t, ok)
+
+	_, ok = VerifyTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("chat-app", "alice", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/chat-app:alice", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, "chat-app", uri.Query().Get("issuer"))
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes()
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" "))
+	assert.NotEqual(t, HashRecoveryCode(codes[0]), HashRecoveryCode(codes[1]))
+}
+
+func TestMFAPendingToken_NotASession(t *testing.T) {
+	pending, err := GenerateMFAPendingToken(1, "alice")
+	require.NoError(t, err)
+	session, err := GenerateJWT(1, "alice")
+	require.NoError(t, err)
+
+	_, err = ValidateJWT(pending)
+	assert.Error(t, err)
+	_, err = ValidateMFAPendingToken(session)
+	assert.Error(t, err)
+
+	claims, err := ValidateMFAPendingToken(pending)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.UserID)
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"chat-app/internal/chat"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/logging"
+	"chat-app/internal/messaging"
+	"chat-app/internal/unfurl"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+const linkPreviewTimeout = 15 * time.Second
+
+// LinkPreviewRequest asks the bot to unfurl the links of a freshly posted message
+type LinkPreviewRequest struct {
+	ChatroomID int      `json:"chatroom_id"`
+	MessageID  int      `json:"message_id"`
+	URLs       []string `json:"urls"`
+}
+
+type LinkPreviewResponse struct {
+	ChatroomID int              `json:"chatroom_id"`
+	MessageID  int              `json:"message_id"`
+	Previews   []unfurl.Preview `json:"previews"`
+}
+
+// LinkPreviewPayload is broadcast to the room once the previews of a message are stored
+type LinkPreviewPayload struct {
+	ChatroomID   int              `json:"chatroom_id"`
+	MessageID    int              `json:"message_id"`
+	LinkPreviews []unfurl.Preview `json:"link_previews"`
+}
+
+// SendLinkPreviewRequestToQueue queues the links of a message for unfurling, messages without links are skipped
+func SendLinkPreviewRequestToQueue(ctx context.Context, rabbitMQ *messaging.RabbitMQ, message repository.Message) {
+	urls := unfurl.ExtractURLs(message.Content)
+	if len(urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(LinkPreviewRequest{
+		ChatroomID: message.ChatroomID,
+		MessageID:  message.ID,
+		URLs:       urls,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal link preview request", "error", err)
+		return
+	}
+
+	if err := rabbitMQ.Publish(ctx, "link_preview_requests", body); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish link preview request", "error", err)
+	}
+}
+
+func ConsumeLinkPreviewRequests(rabbitMQ *messaging.RabbitMQ, fetcher *unfurl.Fetcher) {
+	err := rabbitMQ.Consume("link_preview_requests", func(msgCtx context.Context, body []byte) {
+		var request LinkPreviewRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			slog.ErrorContext(msgCtx, "Failed to unmarshal link preview request", "error", err)
+			return
+		}
+
+		if len(request.URLs) > unfurl.MaxURLsPerMessage {
+			request.URLs = request.URLs[:unfurl.MaxURLsPerMessage]
+		}
+
+		ctx, cancel := context.WithTimeout(msgCtx, linkPreviewTimeout)
+		var previews []unfurl.Preview
+		for _, url := range request.URLs {
+			preview, err := fetcher.Fetch(ctx, url)
+			if err != nil {
+				slog.DebugContext(ctx, "No link preview", "url", url, "error", err)
+				continue
+			}
+			previews = append(previews, preview)
+		}
+		cancel()
+
+		if len(previews) == 0 {
+			return
+		}
+
+		PublishLinkPreviewResponse(msgCtx, rabbitMQ, LinkPreviewResponse{
+			ChatroomID: request.ChatroomID,
+			MessageID:  request.MessageID,
+			Previews:   previews,
+		})
+	})
+	if err != nil {
+		logging.Fatal("Failed to consume link preview requests", "error", err)
+	}
+}
+
+func PublishLinkPreviewResponse(ctx context.Context, rabbitMQ *messaging.RabbitMQ, response LinkPreviewResponse) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to marshal link preview response", "error", err)
+		return
+	}
+
+	if err := rabbitMQ.Publish(ctx, "link_preview_responses", body); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish link preview response", "error", err)
+	}
+}
+
+// ConsumeLinkPreviewResponses attaches the previews to their message and pushes them to the room
+func ConsumeLinkPreviewResponses(rabbitMQ *messaging.RabbitMQ, messageRepo *repository.MessageRepository) {
+	err := rabbitMQ.Consume("link_preview_responses", func(ctx context.Context, body []byte) {
+		var response LinkPreviewResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			slog.ErrorContext(ctx, "Failed to unmarshal link preview response", "error", err)
+			return
+		}
+
+		previews, err := json.Marshal(response.Previews)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to marshal link previews", "error", err)
+			return
+		}
+
+		err = messageRepo.SetLinkPreviews(ctx, response.ChatroomID, response.MessageID, previews)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to store link previews", "message_id", response.MessageID, "error", err)
+			return
+		}
+
+		chat.BroadcastEventToChatroom(response.ChatroomID, chat.Event{
+			Type: chat.EventLinkPreviews,
+			Payload: LinkPreviewPayload{
+				ChatroomID:   response.ChatroomID,
+				MessageID:    response.MessageID,
+				LinkPreviews: response.Previews,
+			},
+		})
+	})
+	if err != nil {
+		logging.Fatal("Failed to consume link preview responses", "error", err)
+	}
+}
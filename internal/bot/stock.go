@@ -3,23 +3,31 @@ package bot
 import (
 	"chat-app/internal/chat"
 	"chat-app/internal/chat/repository"
+	"chat-app/internal/logging"
 	"chat-app/internal/messaging"
+	"chat-app/internal/metrics"
+	"chat-app/internal/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
-	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func FetchStockData(stockCode string) string {
+func FetchStockData(ctx context.Context, stockCode string) string {
 	stockCode = strings.ToUpper(strings.TrimSpace(stockCode))
 
+	ctx, span := tracing.Start(ctx, "FetchStockData", trace.WithAttributes(attribute.String("stock_code", stockCode)))
+	defer span.End()
+
 	if !IsValidStockCode(stockCode) {
 		return fmt.Sprintf("Invalid stock code: %s", stockCode)
 	}
@@ -29,20 +37,32 @@ func FetchStockData(stockCode string) string {
 	urlStr := fmt.Sprintf("https://stooq.com/q/l/?s=%s&f=sd2t2ohlcv&h&e=csv", stockCode)
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		log.Println("Failed to parse URL:", err)
+		slog.ErrorContext(ctx, "Failed to parse URL", "error", err)
+		return fmt.Sprintf("Error fetching stock data for %s", stockCode)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsedURL.String(), nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to build stock data request", "error", err)
 		return fmt.Sprintf("Error fetching stock data for %s", stockCode)
 	}
 
-	resp, err := http.Get(parsedURL.String())
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Println("Failed to fetch stock data:", err)
+		metrics.StockFetchErrors.WithLabelValues("request").Inc()
+		tracing.RecordError(span, err)
+		slog.ErrorContext(ctx, "Failed to fetch stock data", "stock_code", stockCode, "error", err)
 		return fmt.Sprintf("Error fetching stock data for %s", stockCode)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
+	metrics.StockFetchDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Println("Failed to read response body:", err)
+		metrics.StockFetchErrors.WithLabelValues("read").Inc()
+		tracing.RecordError(span, err)
+		slog.ErrorContext(ctx, "Failed to read response body", "stock_code", stockCode, "error", err)
 		return fmt.Sprintf("Error reading stock data for %s", stockCode)
 	}
 
@@ -67,33 +87,21 @@ func FetchStockData(stockCode string) string {
 		}
 	}
 
-	log.Println("Unexpected data format received from stock API")
+	metrics.StockFetchErrors.WithLabelValues("format").Inc()
+	slog.WarnContext(ctx, "Unexpected data format received from stock API", "stock_code", stockCode)
 	return fmt.Sprintf("No data available for stock code %s", strings.ToUpper(stockCode))
 }
 
 func ConsumeStockResponses(rabbitMQ *messaging.RabbitMQ) {
-	msgs, err := rabbitMQ.Channel.Consume(
-		"stock_responses",
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		log.Fatal("Failed to start consuming stock_responses:", err)
-	}
-
-	for msg := range msgs {
+	err := rabbitMQ.Consume("stock_responses", func(ctx context.Context, body []byte) {
 		var response struct {
 			ChatroomID int    `json:"chatroom_id"`
 			Content    string `json:"content"`
 		}
 
-		if err := json.Unmarshal(msg.Body, &response); err != nil {
-			log.Println("Failed to unmarshal stock response:", err)
-			continue
+		if err := json.Unmarshal(body, &response); err != nil {
+			slog.ErrorContext(ctx, "Failed to unmarshal stock response", "error", err)
+			return
 		}
 
 		msgToSend := repository.Message{
@@ -103,90 +111,72 @@ func ConsumeStockResponses(rabbitMQ *messaging.RabbitMQ) {
 			Timestamp:  time.Now(),
 		}
 
+		_, span := tracing.Start(ctx, "BroadcastMessageToChatroom", trace.WithAttributes(attribute.Int("chatroom_id", response.ChatroomID)))
 		chat.BroadcastMessageToChatroom(response.ChatroomID, msgToSend)
+		span.End()
+		slog.InfoContext(ctx, "Stock quote delivered", "chatroom_id", response.ChatroomID)
+	})
+	if err != nil {
+		logging.Fatal("Failed to consume stock responses", "error", err)
 	}
 }
 
-func SendStockRequestToQueue(rabbitMQ *messaging.RabbitMQ, request map[string]interface{}) {
+func SendStockRequestToQueue(ctx context.Context, rabbitMQ *messaging.RabbitMQ, request map[string]interface{}) {
+	ctx, span := tracing.Start(ctx, "SendStockRequestToQueue")
+	defer span.End()
+
 	body, err := json.Marshal(request)
 	if err != nil {
-		log.Println("Failed to marshal stock request:", err)
+		slog.ErrorContext(ctx, "Failed to marshal stock request", "error", err)
 		return
 	}
 
-	err = rabbitMQ.Channel.Publish(
-		"",
-		"stock_requests",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		log.Println("Failed to publish stock request:", err)
+	if err := rabbitMQ.Publish(ctx, "stock_requests", body); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish stock request", "error", err)
 	}
 }
 
 func ConsumeStockRequests(rabbitMQ *messaging.RabbitMQ) {
-	msgs, err := rabbitMQ.Channel.Consume(
-		"stock_requests",
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		log.Fatal("Failed to start consuming stock_requests:", err)
-	}
+	slog.Info("Bot is ready to receive messages")
 
-	log.Println("Bot is ready to receive messages...")
-
-	for msg := range msgs {
-		log.Println("Processing stock request:", string(msg.Body))
+	err := rabbitMQ.Consume("stock_requests", func(ctx context.Context, body []byte) {
 		var request struct {
 			ChatroomID int    `json:"chatroom_id"`
 			StockCode  string `json:"stock_code"`
 		}
 
-		if err := json.Unmarshal(msg.Body, &request); err != nil {
-			log.Println("Failed to unmarshal stock request:", err)
-			continue
+		if err := json.Unmarshal(body, &request); err != nil {
+			slog.ErrorContext(ctx, "Failed to unmarshal stock request", "error", err)
+			return
 		}
+		slog.InfoContext(ctx, "Processing stock request", "chatroom_id", request.ChatroomID, "stock_code", request.StockCode)
 
-		stockResponse := FetchStockData(request.StockCode)
+		stockResponse := FetchStockData(ctx, request.StockCode)
 
 		response := map[string]interface{}{
 			"chatroom_id": request.ChatroomID,
 			"content":     stockResponse,
 		}
 
-		PublishStockResponse(rabbitMQ, response)
+		PublishStockResponse(ctx, rabbitMQ, response)
+	})
+	if err != nil {
+		logging.Fatal("Failed to consume stock requests", "error", err)
 	}
 }
 
-func PublishStockResponse(rabbitMQ *messaging.RabbitMQ, response map[string]interface{}) {
+func PublishStockResponse(ctx context.Context, rabbitMQ *messaging.RabbitMQ, response map[string]interface{}) {
+	ctx, span := tracing.Start(ctx, "PublishStockResponse")
+	defer span.End()
+
 	body, err := json.Marshal(response)
 	if err != nil {
-		log.Println("Failed to marshal stock response:", err)
+		slog.ErrorContext(ctx, "Failed to marshal stock response", "error", err)
 		return
 	}
 
-	err = rabbitMQ.Channel.Publish(
-		"",
-		"stock_responses",
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
-	if err != nil {
-		log.Println("Failed to publish stock response:", err)
+	if err := rabbitMQ.Publish(ctx, "stock_responses", body); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish stock response", "error", err)
 	}
 }
 
@@ -203,7 +193,7 @@ func IsValidStockCode(code string) bool {
 	validPattern := `^[A-Z0-9.-]+$`
 	matched, err := regexp.MatchString(validPattern, code)
 	if err != nil {
-		log.Println("Regex validation failed:", err)
+		slog.Error("Regex validation failed", "error", err)
 		return false
 	}
 
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -51,7 +52,7 @@ func TestFetchStockData(t *testing.T) {
 			}))
 			defer server.Close()
 
-			result := FetchStockData(tt.stockCode)
+			result := FetchStockData(context.Background(), tt.stockCode)
 			assert.Equal(t, tt.expectedResult, result)
 		})
 	}
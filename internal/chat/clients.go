@@ -1,34 +1,128 @@
 package chat
 
 import (
+	"chat-app/internal/metrics"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const writeTimeout = 10 * time.Second
+
+// Client is one open WebSocket connection of a user in a chatroom.
+// All writes go through WriteJSON so broadcasts coming from different goroutines never interleave on the socket.
+type Client struct {
+	Conn       *websocket.Conn
+	UserID     int
+	ChatroomID int
+
+	writeMutex    sync.Mutex
+	lastHeartbeat atomic.Int64 // Unix nanoseconds of the last frame received from the client
+
+	// Only touched by the goroutine reading from the connection
+	typing         bool
+	lastTypingSent time.Time
+}
+
 var (
-	Clients      = make(map[int]map[*websocket.Conn]bool) // Chatroom ID => WebSocket connections
+	Clients      = make(map[int]map[*Client]bool) // Chatroom ID => WebSocket clients
 	ClientsMutex = sync.RWMutex{}
+
+	userClients = make(map[int]map[*Client]bool) // User ID => WebSocket clients, guarded by ClientsMutex
 )
 
-func AddClientToChatroom(conn *websocket.Conn, chatroomID int) {
+func (c *Client) WriteJSON(v interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.Conn.WriteJSON(v)
+}
+
+// Heartbeat marks the client as active, any frame received from the client counts as one
+func (c *Client) Heartbeat() {
+	c.lastHeartbeat.Store(time.Now().UnixNano())
+}
+
+func (c *Client) LastHeartbeat() time.Time {
+	return time.Unix(0, c.lastHeartbeat.Load())
+}
+
+func AddClientToChatroom(conn *websocket.Conn, chatroomID, userID int) *Client {
+	client := &Client{
+		Conn:       conn,
+		UserID:     userID,
+		ChatroomID: chatroomID,
+	}
+	client.Heartbeat()
+
 	ClientsMutex.Lock()
 	defer ClientsMutex.Unlock()
 
 	if Clients[chatroomID] == nil {
-		Clients[chatroomID] = make(map[*websocket.Conn]bool)
+		Clients[chatroomID] = make(map[*Client]bool)
 	}
-	Clients[chatroomID][conn] = true
+	Clients[chatroomID][client] = true
+	metrics.WebSocketConnections.WithLabelValues(strconv.Itoa(chatroomID)).Inc()
+
+	if userClients[userID] == nil {
+		userClients[userID] = make(map[*Client]bool)
+	}
+	userClients[userID][client] = true
+
+	return client
 }
 
-func RemoveClientFromChatroom(conn *websocket.Conn, chatroomID int) {
+func RemoveClientFromChatroom(client *Client) {
 	ClientsMutex.Lock()
 	defer ClientsMutex.Unlock()
 
-	if _, ok := Clients[chatroomID]; ok {
-		delete(Clients[chatroomID], conn)
-		if len(Clients[chatroomID]) == 0 {
-			delete(Clients, chatroomID)
+	if _, ok := Clients[client.ChatroomID][client]; ok {
+		room := strconv.Itoa(client.ChatroomID)
+		delete(Clients[client.ChatroomID], client)
+		metrics.WebSocketConnections.WithLabelValues(room).Dec()
+		if len(Clients[client.ChatroomID]) == 0 {
+			delete(Clients, client.ChatroomID)
+			metrics.WebSocketConnections.DeleteLabelValues(room)
+		}
+	}
+
+	if _, ok := userClients[client.UserID]; ok {
+		delete(userClients[client.UserID], client)
+		if len(userClients[client.UserID]) == 0 {
+			delete(userClients, client.UserID)
+		}
+	}
+}
+
+// DisconnectUser closes every WebSocket connection of the user, their read loops then remove the clients
+func DisconnectUser(userID int) {
+	ClientsMutex.RLock()
+	clients := make([]*Client, 0, len(userClients[userID]))
+	for client := range userClients[userID] {
+		clients = append(clients, client)
+	}
+	ClientsMutex.RUnlock()
+
+	for _, client := range clients {
+		if client.Conn != nil {
+			client.Conn.Close()
 		}
 	}
 }
+
+// ConnectionCount returns how many WebSocket connections are open, and how many users they belong to
+func ConnectionCount() (connections, users int) {
+	ClientsMutex.RLock()
+	defer ClientsMutex.RUnlock()
+
+	for _, clients := range userClients {
+		connections += len(clients)
+	}
+	return connections, len(userClients)
+}
@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+var (
+	// PresenceAwayAfter is how long a user may go without a heartbeat on any connection before being reported as away
+	PresenceAwayAfter = 2 * time.Minute
+	// TypingDebounce limits how often the typing notifications of one connection are relayed to the room
+	TypingDebounce = 3 * time.Second
+
+	presenceStatuses = make(map[int]string) // User ID => last status broadcast
+	presenceMutex    sync.Mutex
+)
+
+// UserPresence is derived from a user's open connections, it is never stored
+type UserPresence struct {
+	UserID   int       `json:"user_id"`
+	Status   string    `json:"status"`
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+// TypingPayload tells the other clients of a room that a user started or stopped typing
+type TypingPayload struct {
+	ChatroomID int  `json:"chatroom_id"`
+	UserID     int  `json:"user_id"`
+	Typing     bool `json:"typing"`
+}
+
+// userPresenceLocked must be called with ClientsMutex held
+func userPresenceLocked(userID int, now time.Time) UserPresence {
+	presence := UserPresence{UserID: userID, Status: PresenceOffline}
+	for client := range userClients[userID] {
+		if lastHeartbeat := client.LastHeartbeat(); lastHeartbeat.After(presence.LastSeen) {
+			presence.LastSeen = lastHeartbeat
+		}
+	}
+
+	if len(userClients[userID]) > 0 {
+		presence.Status = PresenceAway
+		if now.Sub(presence.LastSeen) < PresenceAwayAfter {
+			presence.Status = PresenceOnline
+		}
+	}
+
+	return presence
+}
+
+func GetUserPresence(userID int) UserPresence {
+	ClientsMutex.RLock()
+	defer ClientsMutex.RUnlock()
+
+	return userPresenceLocked(userID, time.Now())
+}
+
+// GetChatroomPresence lists the users connected to the chatroom, ordered by user ID
+func GetChatroomPresence(chatroomID int) []UserPresence {
+	ClientsMutex.RLock()
+	defer ClientsMutex.RUnlock()
+
+	now := time.Now()
+	seen := make(map[int]bool)
+	presences := []UserPresence{}
+	for client := range Clients[chatroomID] {
+		if seen[client.UserID] {
+			continue
+		}
+		seen[client.UserID] = true
+		presences = append(presences, userPresenceLocked(client.UserID, now))
+	}
+
+	sort.Slice(presences, func(i, j int) bool {
+		return presences[i].UserID < presences[j].UserID
+	})
+
+	return presences
+}
+
+// RefreshPresence recomputes the user's status and, when it changed, broadcasts it to every room the user is
+// connected to plus the extra rooms given (e.g. the room a connection was just removed from).
+func RefreshPresence(userID int, extraChatroomIDs ...int) {
+	presenceMutex.Lock()
+	defer presenceMutex.Unlock()
+
+	ClientsMutex.RLock()
+	presence := userPresenceLocked(userID, time.Now())
+	chatroomIDs := make(map[int]bool)
+	for client := range userClients[userID] {
+		chatroomIDs[client.ChatroomID] = true
+	}
+	ClientsMutex.RUnlock()
+
+	for _, chatroomID := range extraChatroomIDs {
+		chatroomIDs[chatroomID] = true
+	}
+
+	previous, ok := presenceStatuses[userID]
+	if !ok {
+		previous = PresenceOffline
+	}
+	if previous == presence.Status {
+		return
+	}
+
+	if presence.Status == PresenceOffline {
+		delete(presenceStatuses, userID)
+	} else {
+		presenceStatuses[userID] = presence.Status
+	}
+
+	for chatroomID := range chatroomIDs {
+		broadcastToChatroom(chatroomID, Event{Type: EventPresenceUpdated, Payload: presence}, nil)
+	}
+}
+
+// StartPresenceSweeper periodically refreshes every connected user so idle users are reported as away
+func StartPresenceSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ClientsMutex.RLock()
+		userIDs := make([]int, 0, len(userClients))
+		for userID := range userClients {
+			userIDs = append(userIDs, userID)
+		}
+		ClientsMutex.RUnlock()
+
+		for _, userID := range userIDs {
+			RefreshPresence(userID)
+		}
+	}
+}
+
+// NotifyTyping relays a typing change to the other clients of the room. Repeated 'typing' notifications are
+// debounced, so clients should treat an indicator as stale if it is not renewed within a few seconds.
+func (c *Client) NotifyTyping(typing bool) {
+	if typing {
+		if c.typing && time.Since(c.lastTypingSent) < TypingDebounce {
+			return
+		}
+		c.lastTypingSent = time.Now()
+	} else if !c.typing {
+		return
+	}
+	c.typing = typing
+
+	broadcastToChatroom(c.ChatroomID, Event{
+		Type: EventTyping,
+		Payload: TypingPayload{
+			ChatroomID: c.ChatroomID,
+			UserID:     c.UserID,
+			Typing:     typing,
+		},
+	}, c)
+}
+
+// StoppedTyping resets the typing state without notifying the room, clients clear the indicator on their own
+// once a message from the user arrives
+func (c *Client) StoppedTyping() {
+	c.typing = false
+}
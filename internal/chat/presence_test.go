@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"chat-app/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatroomPresence(t *testing.T) {
+	active := AddClientToChatroom(nil, 1, 10)
+	idle := AddClientToChatroom(nil, 1, 20)
+	otherRoom := AddClientToChatroom(nil, 2, 10)
+	defer func() {
+		RemoveClientFromChatroom(active)
+		RemoveClientFromChatroom(idle)
+		RemoveClientFromChatroom(otherRoom)
+	}()
+
+	idle.lastHeartbeat.Store(time.Now().Add(-PresenceAwayAfter - time.Second).UnixNano())
+
+	presences := GetChatroomPresence(1)
+	assert.Len(t, presences, 2)
+	assert.Equal(t, 10, presences[0].UserID)
+	assert.Equal(t, PresenceOnline, presences[0].Status)
+	assert.Equal(t, 20, presences[1].UserID)
+	assert.Equal(t, PresenceAway, presences[1].Status)
+
+	assert.Empty(t, GetChatroomPresence(3))
+}
+
+func TestUserPresence_OnlineWhileAnyConnectionIsActive(t *testing.T) {
+	stale := AddClientToChatroom(nil, 1, 30)
+	fresh := AddClientToChatroom(nil, 2, 30)
+	defer RemoveClientFromChatroom(fresh)
+
+	stale.lastHeartbeat.Store(time.Now().Add(-time.Hour).UnixNano())
+	assert.Equal(t, PresenceOnline, GetUserPresence(30).Status)
+
+	RemoveClientFromChatroom(stale)
+	fresh.lastHeartbeat.Store(time.Now().Add(-time.Hour).UnixNano())
+	assert.Equal(t, PresenceAway, GetUserPresence(30).Status)
+
+	RemoveClientFromChatroom(fresh)
+	assert.Equal(t, PresenceOffline, GetUserPresence(30).Status)
+}
+
+func TestNotifyTyping_Debounced(t *testing.T) {
+	client := AddClientToChatroom(nil, 5, 40)
+	defer RemoveClientFromChatroom(client)
+
+	client.NotifyTyping(true)
+	firstSent := client.lastTypingSent
+	assert.True(t, client.typing)
+
+	client.NotifyTyping(true)
+	assert.Equal(t, firstSent, client.lastTypingSent)
+
+	client.lastTypingSent = time.Now().Add(-TypingDebounce)
+	client.NotifyTyping(true)
+	assert.True(t, client.lastTypingSent.After(firstSent))
+
+	client.NotifyTyping(false)
+	assert.False(t, client.typing)
+}
+
+func TestConnectionCount(t *testing.T) {
+	connections, users := ConnectionCount()
+
+	first := AddClientToChatroom(nil, 1, 50)
+	second := AddClientToChatroom(nil, 2, 50)
+	other := AddClientToChatroom(nil, 1, 51)
+	defer func() {
+		RemoveClientFromChatroom(first)
+		RemoveClientFromChatroom(second)
+		RemoveClientFromChatroom(other)
+	}()
+
+	nowConnections, nowUsers := ConnectionCount()
+	assert.Equal(t, connections+3, nowConnections)
+	assert.Equal(t, users+2, nowUsers)
+}
+
+func TestConnectionMetrics(t *testing.T) {
+	first := AddClientToChatroom(nil, 900, 60)
+	second := AddClientToChatroom(nil, 900, 61)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.WebSocketConnections.WithLabelValues("900")))
+
+	RemoveClientFromChatroom(first)
+	RemoveClientFromChatroom(first)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.WebSocketConnections.WithLabelValues("900")))
+
+	// The series of a room goes away with its last connection
+	RemoveClientFromChatroom(second)
+	assert.False(t, metrics.WebSocketConnections.DeleteLabelValues("900"))
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SystemStats counts what the database holds, for the admin dashboard
+type SystemStats struct {
+	Users             int   `json:"users"`
+	DisabledUsers     int   `json:"disabled_users"`
+	Admins            int   `json:"admins"`
+	Chatrooms         int   `json:"chatrooms"`
+	ArchivedChatrooms int   `json:"archived_chatrooms"`
+	Messages          int   `json:"messages"`
+	MessagesLastDay   int   `json:"messages_last_day"`
+	Attachments       int   `json:"attachments"`
+	AttachmentBytes   int64 `json:"attachment_bytes"`
+}
+
+type AdminRepository struct {
+	db *sql.DB
+}
+
+func NewAdminRepository(db *sql.DB) *AdminRepository {
+	return &AdminRepository{db: db}
+}
+
+func (repo *AdminRepository) Stats(ctx context.Context) (SystemStats, error) {
+	var stats SystemStats
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT
+            (SELECT COUNT(*) FROM users),
+            (SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+            (SELECT COUNT(*) FROM users WHERE role = 'admin'),
+            (SELECT COUNT(*) FROM chatrooms),
+            (SELECT COUNT(*) FROM chatrooms WHERE archived_at IS NOT NULL),
+            (SELECT COUNT(*) FROM messages),
+            (SELECT COUNT(*) FROM messages WHERE timestamp > CURRENT_TIMESTAMP - INTERVAL '1 day'),
+            (SELECT COUNT(*) FROM attachments),
+            (SELECT COALESCE(SUM(size_bytes), 0) FROM attachments)
+    `).Scan(&stats.Users, &stats.DisabledUsers, &stats.Admins, &stats.Chatrooms, &stats.ArchivedChatrooms,
+		&stats.Messages, &stats.MessagesLastDay, &stats.Attachments, &stats.AttachmentBytes)
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to fetch stats: %w", err)
+	}
+
+	return stats, nil
+}
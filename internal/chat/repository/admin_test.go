@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminRepository_Stats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAdminRepository(db)
+
+	mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM users\\),").
+		WillReturnRows(sqlmock.NewRows([]string{"users", "disabled", "admins", "chatrooms", "archived", "messages", "last_day", "attachments", "bytes"}).
+			AddRow(10, 1, 2, 4, 1, 300, 25, 7, 4096))
+
+	stats, err := repo.Stats(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, SystemStats{
+		Users:             10,
+		DisabledUsers:     1,
+		Admins:            2,
+		Chatrooms:         4,
+		ArchivedChatrooms: 1,
+		Messages:          300,
+		MessagesLastDay:   25,
+		Attachments:       7,
+		AttachmentBytes:   4096,
+	}, stats)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+// APIToken lets scripts act as its owner in a few chatrooms. Only a hash of the token is stored,
+// Token is only filled in right after creation.
+type APIToken struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Token       string     `json:"token,omitempty"`
+	Scopes      []string   `json:"scopes"`
+	ChatroomIDs []int      `json:"chatroom_ids"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+type APITokenRepository struct {
+	db *sql.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+const apiTokenColumns = `id, user_id, name, token_prefix, scopes, chatroom_ids, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var token APIToken
+	var chatroomIDs pq.Int64Array
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, pq.Array(&token.Scopes), &chatroomIDs,
+		&token.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt)
+
+	token.ChatroomIDs = make([]int, len(chatroomIDs))
+	for i, id := range chatroomIDs {
+		token.ChatroomIDs[i] = int(id)
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, err
+}
+
+// CreateAPIToken stores a new token by its hash, prefix is the start of the token shown to tell tokens apart
+func (repo *APITokenRepository) CreateAPIToken(ctx context.Context, userID int, name, tokenHash, prefix string, scopes []string, chatroomIDs []int, expiresAt *time.Time) (APIToken, error) {
+	token, err := scanAPIToken(repo.db.QueryRowContext(ctx, `
+        INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, chatroom_ids, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING `+apiTokenColumns,
+		userID, name, tokenHash, prefix, pq.Array(scopes), pq.Array(chatroomIDs), expiresAt))
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (repo *APITokenRepository) ListAPITokens(ctx context.Context, userID int) ([]APIToken, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT `+apiTokenColumns+`
+        FROM api_tokens
+        WHERE user_id = $1
+        ORDER BY id
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken disables one of the user's tokens for good
+func (repo *APITokenRepository) RevokeAPIToken(ctx context.Context, userID, tokenID int) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE api_tokens
+        SET revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+    `, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+	if affected == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
+
+// LookupAPIToken returns the live token with the given hash and records its use.
+// Revoked and expired tokens are reported as ErrAPITokenNotFound.
+func (repo *APITokenRepository) LookupAPIToken(ctx context.Context, tokenHash string) (APIToken, error) {
+	token, err := scanAPIToken(repo.db.QueryRowContext(ctx, `
+        UPDATE api_tokens
+        SET last_used_at = CURRENT_TIMESTAMP
+        WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+        RETURNING `+apiTokenColumns,
+		tokenHash))
+	if err == sql.ErrNoRows {
+		return APIToken{}, ErrAPITokenNotFound
+	} else if err != nil {
+		return APIToken{}, fmt.Errorf("failed to look up api token: %w", err)
+	}
+
+	return token, nil
+}
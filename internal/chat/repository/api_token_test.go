@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiTokenRowColumns = []string{"id", "user_id", "name", "token_prefix", "scopes", "chatroom_ids", "created_at", "expires_at", "last_used_at", "revoked_at"}
+
+func TestAPITokenRepository_CreateAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAPITokenRepository(db)
+
+	scopes := []string{"messages:write"}
+	timestamp := time.Now()
+
+	mock.ExpectQuery("INSERT INTO api_tokens \\(user_id, name, token_hash, token_prefix, scopes, chatroom_ids, expires_at\\)").
+		WithArgs(7, "deploy script", "hash", "cat_abcd", pq.Array(scopes), pq.Array([]int{1, 3}), nil).
+		WillReturnRows(sqlmock.NewRows(apiTokenRowColumns).
+			AddRow(2, 7, "deploy script", "cat_abcd", "{messages:write}", "{1,3}", timestamp, nil, nil, nil))
+
+	token, err := repo.CreateAPIToken(context.Background(), 7, "deploy script", "hash", "cat_abcd", scopes, []int{1, 3}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, token.ID)
+	assert.Equal(t, scopes, token.Scopes)
+	assert.Equal(t, []int{1, 3}, token.ChatroomIDs)
+	assert.Nil(t, token.ExpiresAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPITokenRepository_LookupAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAPITokenRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = \\$1 AND revoked_at IS NULL AND \\(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP\\)").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(apiTokenRowColumns).
+			AddRow(2, 7, "deploy script", "cat_abcd", "{messages:read,messages:write}", "{3}", timestamp, timestamp.Add(time.Hour), timestamp, nil))
+	mock.ExpectQuery("UPDATE api_tokens SET last_used_at").
+		WithArgs("revoked").
+		WillReturnError(sql.ErrNoRows)
+
+	token, err := repo.LookupAPIToken(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, token.UserID)
+	assert.Equal(t, []string{"messages:read", "messages:write"}, token.Scopes)
+	assert.Equal(t, []int{3}, token.ChatroomIDs)
+	assert.NotNil(t, token.ExpiresAt)
+
+	_, err = repo.LookupAPIToken(context.Background(), "revoked")
+	assert.ErrorIs(t, err, ErrAPITokenNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPITokenRepository_RevokeAPIToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAPITokenRepository(db)
+
+	mock.ExpectExec("UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = \\$1 AND user_id = \\$2 AND revoked_at IS NULL").
+		WithArgs(2, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_tokens SET revoked_at").
+		WithArgs(2, 8).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.RevokeAPIToken(context.Background(), 7, 2))
+	assert.ErrorIs(t, repo.RevokeAPIToken(context.Background(), 8, 2), ErrAPITokenNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrInvalidAttachments = errors.New("attachments must be unused uploads of the same user and chatroom")
+)
+
+// Attachment is the metadata of an uploaded file, the content itself lives in the blob store under StorageKey
+type Attachment struct {
+	ID           int       `json:"id"`
+	ChatroomID   int       `json:"chatroom_id"`
+	UploaderID   int       `json:"uploader_id"`
+	MessageID    *int      `json:"message_id,omitempty"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	HasThumbnail bool      `json:"has_thumbnail"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const attachmentColumns = `id, chatroom_id, uploader_id, message_id, filename, content_type, size_bytes,
+            width, height, storage_key, thumbnail_key, created_at`
+
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// CreateAttachment stores the metadata of a new upload, it is linked to a message later when the message is posted
+func (repo *AttachmentRepository) CreateAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	err := repo.db.QueryRowContext(ctx, `
+        INSERT INTO attachments (chatroom_id, uploader_id, filename, content_type, size_bytes, width, height, storage_key, thumbnail_key)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), $8, NULLIF($9, ''))
+        RETURNING id, created_at
+    `, attachment.ChatroomID, attachment.UploaderID, attachment.Filename, attachment.ContentType, attachment.SizeBytes,
+		attachment.Width, attachment.Height, attachment.StorageKey, attachment.ThumbnailKey).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	attachment.HasThumbnail = attachment.ThumbnailKey != ""
+	return attachment, nil
+}
+
+func (repo *AttachmentRepository) GetAttachment(ctx context.Context, id int) (Attachment, error) {
+	row := repo.db.QueryRowContext(ctx, `
+        SELECT `+attachmentColumns+`
+        FROM attachments
+        WHERE id = $1
+    `, id)
+
+	attachment, err := scanAttachment(row)
+	if err == sql.ErrNoRows {
+		return Attachment{}, ErrAttachmentNotFound
+	} else if err != nil {
+		return Attachment{}, fmt.Errorf("failed to fetch attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var attachment Attachment
+	var messageID sql.NullInt64
+	var width, height sql.NullInt64
+	var thumbnailKey sql.NullString
+	err := row.Scan(&attachment.ID, &attachment.ChatroomID, &attachment.UploaderID, &messageID, &attachment.Filename,
+		&attachment.ContentType, &attachment.SizeBytes, &width, &height, &attachment.StorageKey, &thumbnailKey, &attachment.CreatedAt)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	if messageID.Valid {
+		id := int(messageID.Int64)
+		attachment.MessageID = &id
+	}
+	attachment.Width = int(width.Int64)
+	attachment.Height = int(height.Int64)
+	attachment.ThumbnailKey = thumbnailKey.String
+	attachment.HasThumbnail = thumbnailKey.Valid
+
+	return attachment, nil
+}
+
+// attachToMessage links pending uploads to a freshly inserted message, inside the transaction that inserted it.
+// Every ID must be an unused upload of the message author in the same chatroom.
+func attachToMessage(ctx context.Context, tx *sql.Tx, messageID, chatroomID, uploaderID int, attachmentIDs []int) ([]Attachment, error) {
+	unique := make(map[int]bool)
+	for _, id := range attachmentIDs {
+		unique[id] = true
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        UPDATE attachments
+        SET message_id = $1
+        WHERE id = ANY($4) AND chatroom_id = $2 AND uploader_id = $3 AND message_id IS NULL
+        RETURNING `+attachmentColumns, messageID, chatroomID, uploaderID, pq.Array(attachmentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to link attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if len(attachments) != len(unique) {
+		return nil, ErrInvalidAttachments
+	}
+
+	return attachments, nil
+}
+
+// deleteMessageAttachments deletes the attachments of the messages selected by the messageIDs subquery, inside the
+// transaction that deletes the messages, and returns their blob keys. Attachments would otherwise only be unlinked
+// (ON DELETE SET NULL) and look like pending uploads again.
+func deleteMessageAttachments(ctx context.Context, tx *sql.Tx, messageIDs string, args ...interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `
+        DELETE FROM attachments
+        WHERE message_id IN (`+messageIDs+`)
+        RETURNING storage_key, thumbnail_key
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var blobKeys []string
+	for rows.Next() {
+		var storageKey string
+		var thumbnailKey sql.NullString
+		if err := rows.Scan(&storageKey, &thumbnailKey); err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		blobKeys = append(blobKeys, storageKey)
+		if thumbnailKey.Valid {
+			blobKeys = append(blobKeys, thumbnailKey.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete attachments: %w", err)
+	}
+
+	return blobKeys, nil
+}
+
+// listMessageAttachments fetches the attachments of the given messages, keyed by message ID
+func listMessageAttachments(ctx context.Context, db *sql.DB, messageIDs []int) (map[int][]Attachment, error) {
+	attachments := make(map[int][]Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT `+attachmentColumns+`
+        FROM attachments
+        WHERE message_id = ANY($1)
+        ORDER BY id
+    `, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments[*attachment.MessageID] = append(attachments[*attachment.MessageID], attachment)
+	}
+
+	return attachments, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var attachmentRowColumns = []string{"id", "chatroom_id", "uploader_id", "message_id", "filename", "content_type",
+	"size_bytes", "width", "height", "storage_key", "thumbnail_key", "created_at"}
+
+func TestAttachmentRepository_CreateAttachment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAttachmentRepository(db)
+
+	timestamp := time.Now()
+	attachment := Attachment{
+		ChatroomID:   1,
+		UploaderID:   2,
+		Filename:     "photo.jpg",
+		ContentType:  "image/jpeg",
+		SizeBytes:    4096,
+		Width:        800,
+		Height:       600,
+		StorageKey:   "attachments/photo",
+		ThumbnailKey: "attachments/photo-thumb",
+	}
+
+	mock.ExpectQuery("INSERT INTO attachments \\(chatroom_id, uploader_id, filename, content_type, size_bytes, width, height, storage_key, thumbnail_key\\)").
+		WithArgs(1, 2, "photo.jpg", "image/jpeg", int64(4096), 800, 600, "attachments/photo", "attachments/photo-thumb").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(5, timestamp))
+
+	created, err := repo.CreateAttachment(context.Background(), attachment)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, created.ID)
+	assert.True(t, created.HasThumbnail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAttachmentRepository_GetAttachment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewAttachmentRepository(db)
+
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE id = \\$1").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(attachmentRowColumns).
+			AddRow(5, 1, 2, nil, "notes.txt", "text/plain", 12, nil, nil, "attachments/notes", nil, time.Now()))
+
+	attachment, err := repo.GetAttachment(context.Background(), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "notes.txt", attachment.Filename)
+	assert.Nil(t, attachment.MessageID)
+	assert.False(t, attachment.HasThumbnail)
+
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE id = \\$1").
+		WithArgs(6).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.GetAttachment(context.Background(), 6)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,15 +3,28 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+
+	"github.com/lib/pq"
 )
 
 // Chatroom represents a basic structure for a chatroom with ID and Name
 type Chatroom struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Archived bool   `json:"archived"` // Archived rooms stay readable but take no new messages
+	// Activity as seen by the user listing the chatrooms, only rooms the user joined have unread messages
+	UnreadCount   int      `json:"unread_count"`
+	LatestMessage *Message `json:"latest_message,omitempty"`
 }
 
+var (
+	ErrChatroomNotFound  = errors.New("chatroom not found")
+	ErrChatroomNameTaken = errors.New("chatroom name is already taken")
+	ErrChatroomArchived  = errors.New("chatroom is archived")
+)
+
 type ChatroomRepository struct {
 	db *sql.DB
 }
@@ -35,11 +48,108 @@ func (repo *ChatroomRepository) CreateChatroom(ctx context.Context, name string)
 	return id, nil
 }
 
-func (repo *ChatroomRepository) ListChatrooms(ctx context.Context) ([]Chatroom, error) {
+// RenameChatroom returns ErrChatroomNameTaken when another chatroom has the name
+func (repo *ChatroomRepository) RenameChatroom(ctx context.Context, chatroomID int, name string) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE chatrooms
+        SET name = $2
+        WHERE id = $1
+    `, chatroomID, name)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrChatroomNameTaken
+	} else if err != nil {
+		return fmt.Errorf("failed to rename chatroom: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to rename chatroom: %w", err)
+	}
+	if affected == 0 {
+		return ErrChatroomNotFound
+	}
+
+	return nil
+}
+
+// SetArchived archives the chatroom or brings it back
+func (repo *ChatroomRepository) SetArchived(ctx context.Context, chatroomID int, archived bool) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE chatrooms
+        SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, CURRENT_TIMESTAMP) END
+        WHERE id = $1
+    `, chatroomID, archived)
+	if err != nil {
+		return fmt.Errorf("failed to archive chatroom: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to archive chatroom: %w", err)
+	}
+	if affected == 0 {
+		return ErrChatroomNotFound
+	}
+
+	return nil
+}
+
+// GetChatroom returns the chatroom without the per-user activity of ListChatrooms
+func (repo *ChatroomRepository) GetChatroom(ctx context.Context, chatroomID int) (Chatroom, error) {
+	chatroom := Chatroom{ID: chatroomID}
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT name, archived_at IS NOT NULL FROM chatrooms WHERE id = $1
+    `, chatroomID).Scan(&chatroom.Name, &chatroom.Archived)
+	if err == sql.ErrNoRows {
+		return Chatroom{}, ErrChatroomNotFound
+	} else if err != nil {
+		return Chatroom{}, fmt.Errorf("failed to fetch chatroom: %w", err)
+	}
+
+	return chatroom, nil
+}
+
+// IsArchived reports whether the chatroom was archived, unknown chatrooms are not
+func (repo *ChatroomRepository) IsArchived(ctx context.Context, chatroomID int) (bool, error) {
+	var archived bool
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM chatrooms WHERE id = $1 AND archived_at IS NOT NULL)
+    `, chatroomID).Scan(&archived)
+	if err != nil {
+		return false, fmt.Errorf("failed to check chatroom: %w", err)
+	}
+
+	return archived, nil
+}
+
+// ListChatrooms returns every chatroom with its latest root message and how many root messages from others the user has
+// not read yet. Thread replies count in neither, like the room's timeline.
+func (repo *ChatroomRepository) ListChatrooms(ctx context.Context, userID int) ([]Chatroom, error) {
 	rows, err := repo.db.QueryContext(ctx, `
-        SELECT id, name
-        FROM chatrooms
-    `)
+        SELECT c.id, c.name, c.archived_at IS NOT NULL, COALESCE(unread.count, 0),
+            latest.id, latest.user_id, latest.content, latest.timestamp
+        FROM chatrooms c
+        LEFT JOIN chatroom_members cm ON cm.chatroom_id = c.id AND cm.user_id = $1
+        LEFT JOIN room_read_state rs ON rs.chatroom_id = c.id AND rs.user_id = $1
+        LEFT JOIN LATERAL (
+            SELECT id, user_id, content, timestamp
+            FROM messages
+            WHERE chatroom_id = c.id AND parent_id IS NULL
+            ORDER BY id DESC
+            LIMIT 1
+        ) latest ON TRUE
+        LEFT JOIN LATERAL (
+            SELECT COUNT(*) AS count
+            FROM messages
+            WHERE cm.user_id IS NOT NULL
+                AND chatroom_id = c.id
+                AND parent_id IS NULL
+                AND id > COALESCE(rs.last_read_message_id, 0)
+                AND user_id <> $1
+        ) unread ON TRUE
+        ORDER BY c.id
+    `, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch chatrooms: %w", err)
 	}
@@ -48,11 +158,90 @@ func (repo *ChatroomRepository) ListChatrooms(ctx context.Context) ([]Chatroom,
 	var chatrooms []Chatroom
 	for rows.Next() {
 		var chatroom Chatroom
-		if err := rows.Scan(&chatroom.ID, &chatroom.Name); err != nil {
+		var latestID, latestUserID sql.NullInt64
+		var latestContent sql.NullString
+		var latestTimestamp sql.NullTime
+		if err := rows.Scan(&chatroom.ID, &chatroom.Name, &chatroom.Archived, &chatroom.UnreadCount,
+			&latestID, &latestUserID, &latestContent, &latestTimestamp); err != nil {
 			return nil, fmt.Errorf("failed to scan chatroom: %w", err)
 		}
+		if latestID.Valid {
+			chatroom.LatestMessage = &Message{
+				ID:         int(latestID.Int64),
+				ChatroomID: chatroom.ID,
+				UserID:     int(latestUserID.Int64),
+				Content:    latestContent.String,
+				Timestamp:  latestTimestamp.Time,
+			}
+		}
 		chatrooms = append(chatrooms, chatroom)
 	}
 
 	return chatrooms, nil
 }
+
+// AddMember makes the user a member of the chatroom, it reports whether the user was not a member before
+func (repo *ChatroomRepository) AddMember(ctx context.Context, chatroomID, userID int) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `
+        INSERT INTO chatroom_members (chatroom_id, user_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING
+    `, chatroomID, userID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return false, ErrChatroomNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("failed to add chatroom member: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to add chatroom member: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// IsMember reports whether the user has joined the chatroom and is therefore allowed to read it
+func (repo *ChatroomRepository) IsMember(ctx context.Context, chatroomID, userID int) (bool, error) {
+	var isMember bool
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM chatroom_members WHERE chatroom_id = $1 AND user_id = $2)
+    `, chatroomID, userID).Scan(&isMember)
+	if err != nil {
+		return false, fmt.Errorf("failed to check chatroom membership: %w", err)
+	}
+
+	return isMember, nil
+}
+
+// GetChatroomIDsByNames resolves chatroom names case-insensitively, the result is keyed by lowercase name.
+// Unknown names are left out.
+func (repo *ChatroomRepository) GetChatroomIDsByNames(ctx context.Context, names []string) (map[string]int, error) {
+	chatroomIDs := make(map[string]int)
+	if len(names) == 0 {
+		return chatroomIDs, nil
+	}
+
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT DISTINCT ON (lower(name)) lower(name), id
+        FROM chatrooms
+        WHERE lower(name) = ANY($1)
+        ORDER BY lower(name), id
+    `, pq.Array(lowercase(names)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up chatrooms: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var id int
+		if err := rows.Scan(&name, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan chatroom: %w", err)
+		}
+		chatroomIDs[name] = id
+	}
+
+	return chatroomIDs, rows.Err()
+}
@@ -3,8 +3,10 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -36,17 +38,155 @@ func TestChatroomRepository_ListChatrooms(t *testing.T) {
 
 	repo := NewChatroomRepository(db)
 
-	rows := sqlmock.NewRows([]string{"id", "name"}).
-		AddRow(1, "Chatroom 1").
-		AddRow(2, "Chatroom 2")
+	timestamp := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "name", "archived", "unread", "latest_id", "latest_user_id", "latest_content", "latest_timestamp"}).
+		AddRow(1, "Chatroom 1", false, 3, 12, 2, "Latest message", timestamp).
+		AddRow(2, "Chatroom 2", true, 0, nil, nil, nil, nil)
 
-	mock.ExpectQuery("SELECT id, name FROM chatrooms").
+	mock.ExpectQuery("SELECT c.id, c.name, c.archived_at IS NOT NULL, COALESCE\\(unread.count, 0\\), latest.id, latest.user_id, latest.content, latest.timestamp FROM chatrooms c").
+		WithArgs(5).
 		WillReturnRows(rows)
 
-	chatrooms, err := repo.ListChatrooms(context.Background())
+	chatrooms, err := repo.ListChatrooms(context.Background(), 5)
 	assert.NoError(t, err)
 	assert.Len(t, chatrooms, 2)
 	assert.Equal(t, "Chatroom 1", chatrooms[0].Name)
 	assert.Equal(t, "Chatroom 2", chatrooms[1].Name)
+	assert.Equal(t, 3, chatrooms[0].UnreadCount)
+	assert.Equal(t, 12, chatrooms[0].LatestMessage.ID)
+	assert.Equal(t, "Latest message", chatrooms[0].LatestMessage.Content)
+	assert.Nil(t, chatrooms[1].LatestMessage)
+	assert.False(t, chatrooms[0].Archived)
+	assert.True(t, chatrooms[1].Archived)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_ListChatrooms_RepliesAreNotUnread(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	// The room's last root message 12 was read, reply 13 came in since
+	timestamp := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "name", "archived", "unread", "latest_id", "latest_user_id", "latest_content", "latest_timestamp"}).
+		AddRow(1, "Chatroom 1", false, 0, 12, 2, "Latest message", timestamp)
+
+	mock.ExpectQuery("SELECT c.id, .* FROM chatrooms c .*" +
+		"WHERE chatroom_id = c.id AND parent_id IS NULL ORDER BY id DESC LIMIT 1 \\) latest ON TRUE .*" +
+		"WHERE cm.user_id IS NOT NULL AND chatroom_id = c.id AND parent_id IS NULL AND id > COALESCE\\(rs.last_read_message_id, 0\\)").
+		WithArgs(5).
+		WillReturnRows(rows)
+
+	chatrooms, err := repo.ListChatrooms(context.Background(), 5)
+	assert.NoError(t, err)
+	require.Len(t, chatrooms, 1)
+	assert.Equal(t, 0, chatrooms[0].UnreadCount)
+	assert.Equal(t, 12, chatrooms[0].LatestMessage.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_RenameChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	mock.ExpectExec("UPDATE chatrooms SET name = \\$2 WHERE id = \\$1").
+		WithArgs(1, "general").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectExec("UPDATE chatrooms SET name = \\$2 WHERE id = \\$1").
+		WithArgs(2, "random").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, repo.RenameChatroom(context.Background(), 1, "general"), ErrChatroomNameTaken)
+	assert.ErrorIs(t, repo.RenameChatroom(context.Background(), 2, "random"), ErrChatroomNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_SetArchived(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	mock.ExpectExec("UPDATE chatrooms SET archived_at = CASE WHEN \\$2 THEN COALESCE\\(archived_at, CURRENT_TIMESTAMP\\) END WHERE id = \\$1").
+		WithArgs(1, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatrooms WHERE id = \\$1 AND archived_at IS NOT NULL\\)").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	assert.NoError(t, repo.SetArchived(context.Background(), 1, true))
+	archived, err := repo.IsArchived(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, archived)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_AddMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	mock.ExpectExec("INSERT INTO chatroom_members \\(chatroom_id, user_id\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT DO NOTHING").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO chatroom_members").
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO chatroom_members").
+		WithArgs(99, 2).
+		WillReturnError(&pq.Error{Code: "23503"})
+
+	joined, err := repo.AddMember(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, joined)
+
+	joined, err = repo.AddMember(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.False(t, joined)
+
+	_, err = repo.AddMember(context.Background(), 99, 2)
+	assert.ErrorIs(t, err, ErrChatroomNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_IsMember(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM chatroom_members WHERE chatroom_id = \\$1 AND user_id = \\$2\\)").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	isMember, err := repo.IsMember(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.True(t, isMember)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChatroomRepository_GetChatroomIDsByNames(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewChatroomRepository(db)
+
+	mock.ExpectQuery("SELECT DISTINCT ON \\(lower\\(name\\)\\) lower\\(name\\), id FROM chatrooms WHERE lower\\(name\\) = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"general", "nowhere"})).
+		WillReturnRows(sqlmock.NewRows([]string{"lower", "id"}).AddRow("general", 3))
+
+	chatroomIDs, err := repo.GetChatroomIDsByNames(context.Background(), []string{"General", "nowhere"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"general": 3}, chatroomIDs)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
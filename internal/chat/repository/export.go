@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// exportFetchSize is the number of messages fetched from the export cursor at a time
+const exportFetchSize = 500
+
+// ExportQuery selects the messages of a transcript, From and To are optional bounds on the timestamp
+type ExportQuery struct {
+	ChatroomID int
+	From       *time.Time
+	To         *time.Time
+}
+
+// ExportedMessage is a message of a transcript with its author resolved, replies included
+type ExportedMessage struct {
+	ID          int                  `json:"id"`
+	ParentID    *int                 `json:"parent_id,omitempty"`
+	UserID      int                  `json:"user_id"`
+	Username    string               `json:"username"`
+	IsBot       bool                 `json:"is_bot"`
+	Content     string               `json:"content"`
+	Formatted   json.RawMessage      `json:"formatted,omitempty"`
+	Timestamp   time.Time            `json:"timestamp"`
+	Attachments []ExportedAttachment `json:"attachments,omitempty"`
+}
+
+// ExportedAttachment references an attachment of an exported message, the file itself is not part of the transcript
+type ExportedAttachment struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+	URL         string `json:"url,omitempty"`
+}
+
+// ExportMessages hands every message of the query to emit in chronological order, replies in between root messages.
+// Messages are read through a server-side cursor, so the room never has to fit in memory, and from a single
+// snapshot. An error from emit stops the export and is returned as is.
+func (repo *MessageRepository) ExportMessages(ctx context.Context, query ExportQuery, emit func(ExportedMessage) error) error {
+	tx, err := repo.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	// Read-only, rolling back just closes the cursor
+	defer tx.Rollback()
+
+	args := []interface{}{query.ChatroomID}
+	conditions := []string{"m.chatroom_id = $1"}
+	if query.From != nil {
+		args = append(args, *query.From)
+		conditions = append(conditions, fmt.Sprintf("m.timestamp >= $%d", len(args)))
+	}
+	if query.To != nil {
+		args = append(args, *query.To)
+		conditions = append(conditions, fmt.Sprintf("m.timestamp < $%d", len(args)))
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+        DECLARE export_messages NO SCROLL CURSOR FOR
+        SELECT m.id, m.parent_id, m.user_id, u.username, u.is_bot, m.content, m.formatted, m.timestamp,
+            (SELECT jsonb_agg(jsonb_build_object(
+                'id', a.id, 'filename', a.filename, 'content_type', a.content_type, 'size_bytes', a.size_bytes
+             ) ORDER BY a.id)
+             FROM attachments a WHERE a.message_id = m.id)
+        FROM messages m
+        JOIN users u ON u.id = m.user_id
+        WHERE %s
+        ORDER BY m.timestamp, m.id
+    `, strings.Join(conditions, " AND ")), args...)
+	if err != nil {
+		return fmt.Errorf("failed to open export cursor: %w", err)
+	}
+
+	for {
+		fetched, err := fetchExportBatch(ctx, tx, emit)
+		if err != nil {
+			return err
+		}
+		if fetched < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+func fetchExportBatch(ctx context.Context, tx *sql.Tx, emit func(ExportedMessage) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH FORWARD %d FROM export_messages`, exportFetchSize))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+	defer rows.Close()
+
+	var fetched int
+	for rows.Next() {
+		var msg ExportedMessage
+		var parentID sql.NullInt64
+		var formatted, attachments []byte
+		if err := rows.Scan(&msg.ID, &parentID, &msg.UserID, &msg.Username, &msg.IsBot, &msg.Content, &formatted,
+			&msg.Timestamp, &attachments); err != nil {
+			return fetched, fmt.Errorf("failed to scan message: %w", err)
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			msg.ParentID = &id
+		}
+		msg.Formatted = formatted
+		if len(attachments) > 0 {
+			if err := json.Unmarshal(attachments, &msg.Attachments); err != nil {
+				return fetched, fmt.Errorf("failed to decode attachments: %w", err)
+			}
+		}
+		fetched++
+
+		if err := emit(msg); err != nil {
+			return fetched, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fetched, fmt.Errorf("failed to fetch messages: %w", err)
+	}
+
+	return fetched, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var exportColumns = []string{"id", "parent_id", "user_id", "username", "is_bot", "content", "formatted", "timestamp", "attachments"}
+
+func TestMessageRepository_ExportMessages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	timestamp := from.Add(time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DECLARE export_messages NO SCROLL CURSOR FOR[\\s\\S]+JOIN users u ON u.id = m.user_id\\s+WHERE m.chatroom_id = \\$1 AND m.timestamp >= \\$2\\s+ORDER BY m.timestamp, m.id").
+		WithArgs(3, from).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FETCH FORWARD 500 FROM export_messages").
+		WillReturnRows(sqlmock.NewRows(exportColumns).
+			AddRow(1, nil, 7, "alice", false, "hello", nil, timestamp,
+				[]byte(`[{"id": 4, "filename": "a.png", "content_type": "image/png", "size_bytes": 10}]`)).
+			AddRow(2, 1, 9, "hook", true, "deployed", []byte(`{"nodes":[]}`), timestamp, nil))
+	mock.ExpectRollback()
+
+	var exported []ExportedMessage
+	err = repo.ExportMessages(context.Background(), ExportQuery{ChatroomID: 3, From: &from}, func(msg ExportedMessage) error {
+		exported = append(exported, msg)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	require.Len(t, exported, 2)
+	assert.Equal(t, []ExportedAttachment{{ID: 4, Filename: "a.png", ContentType: "image/png", SizeBytes: 10}}, exported[0].Attachments)
+	assert.Nil(t, exported[0].ParentID)
+	assert.Equal(t, 1, *exported[1].ParentID)
+	assert.True(t, exported[1].IsBot)
+	assert.Equal(t, "hook", exported[1].Username)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_ExportMessages_EmitError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+	rows := sqlmock.NewRows(exportColumns)
+	for id := 1; id <= exportFetchSize; id++ {
+		rows.AddRow(id, nil, 7, "alice", false, "hello", nil, time.Now(), nil)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DECLARE export_messages").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FETCH FORWARD 500 FROM export_messages").WillReturnRows(rows)
+	mock.ExpectRollback()
+
+	errClosed := errors.New("connection closed by client")
+	var emitted int
+	err = repo.ExportMessages(context.Background(), ExportQuery{ChatroomID: 3}, func(ExportedMessage) error {
+		emitted++
+		if emitted == 2 {
+			return errClosed
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, errClosed)
+	assert.Equal(t, 2, emitted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_ExportMessages_FetchesUntilExhausted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+	rows := sqlmock.NewRows(exportColumns)
+	for id := 1; id <= exportFetchSize; id++ {
+		rows.AddRow(id, nil, 7, "alice", false, "hello", nil, time.Now(), nil)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DECLARE export_messages").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FETCH FORWARD 500 FROM export_messages").WillReturnRows(rows)
+	mock.ExpectQuery("FETCH FORWARD 500 FROM export_messages").WillReturnRows(sqlmock.NewRows(exportColumns))
+	mock.ExpectRollback()
+
+	var emitted int
+	err = repo.ExportMessages(context.Background(), ExportQuery{ChatroomID: 3}, func(ExportedMessage) error {
+		emitted++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, exportFetchSize, emitted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrLoginStateNotFound = errors.New("login state not found or expired")
+	ErrNoUsernameLeft     = errors.New("no username candidate is available")
+)
+
+// OIDCLoginState is what the callback of a sign-in needs to finish it, it is used once
+type OIDCLoginState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+}
+
+// ExternalIdentity is a user as known by an identity provider
+type ExternalIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+}
+
+type IdentityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+func (repo *IdentityRepository) SaveLoginState(ctx context.Context, state OIDCLoginState) error {
+	_, err := repo.db.ExecContext(ctx, `
+        INSERT INTO oidc_login_states (state, provider, nonce, code_verifier)
+        VALUES ($1, $2, $3, $4)
+    `, state.State, state.Provider, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		return fmt.Errorf("failed to save login state: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeLoginState deletes and returns the state of a sign-in started less than maxAge ago, so a callback
+// cannot be replayed. Expired states are cleaned up on the way.
+func (repo *IdentityRepository) ConsumeLoginState(ctx context.Context, state, provider string, maxAge time.Duration) (OIDCLoginState, error) {
+	if _, err := repo.db.ExecContext(ctx, `
+        DELETE FROM oidc_login_states
+        WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+    `, maxAge.Seconds()); err != nil {
+		return OIDCLoginState{}, fmt.Errorf("failed to delete expired login states: %w", err)
+	}
+
+	loginState := OIDCLoginState{State: state}
+	err := repo.db.QueryRowContext(ctx, `
+        DELETE FROM oidc_login_states
+        WHERE state = $1 AND provider = $2
+        RETURNING provider, nonce, code_verifier
+    `, state, provider).Scan(&loginState.Provider, &loginState.Nonce, &loginState.CodeVerifier)
+	if err == sql.ErrNoRows {
+		return OIDCLoginState{}, ErrLoginStateNotFound
+	} else if err != nil {
+		return OIDCLoginState{}, fmt.Errorf("failed to consume login state: %w", err)
+	}
+
+	return loginState, nil
+}
+
+// FindOrProvisionUser returns the user linked to the identity, creating one just in time on the first sign-in.
+// The new user gets the first free username among the candidates and no password. Existing local accounts are
+// never linked automatically, a matching username or email does not prove it is the same person.
+func (repo *IdentityRepository) FindOrProvisionUser(ctx context.Context, identity ExternalIdentity, usernameCandidates []string) (int, string, bool, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var username string
+	err = tx.QueryRowContext(ctx, `
+        UPDATE user_identities AS i
+        SET last_login_at = CURRENT_TIMESTAMP, email = $3
+        FROM users AS u
+        WHERE u.id = i.user_id AND i.issuer = $1 AND i.subject = $2
+        RETURNING u.id, u.username
+    `, identity.Issuer, identity.Subject, nullableString(identity.Email)).Scan(&userID, &username)
+	if err == nil {
+		if err := tx.Commit(); err != nil {
+			return 0, "", false, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return userID, username, false, nil
+	} else if err != sql.ErrNoRows {
+		return 0, "", false, fmt.Errorf("failed to look up identity: %w", err)
+	}
+
+	for _, candidate := range usernameCandidates {
+		err = tx.QueryRowContext(ctx, `
+            INSERT INTO users (username, hashed_password)
+            VALUES ($1, '')
+            ON CONFLICT DO NOTHING
+            RETURNING id
+        `, candidate).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return 0, "", false, fmt.Errorf("failed to provision user: %w", err)
+		}
+		username = candidate
+		break
+	}
+	if username == "" {
+		return 0, "", false, ErrNoUsernameLeft
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO user_identities (user_id, issuer, subject, email)
+        VALUES ($1, $2, $3, $4)
+    `, userID, identity.Issuer, identity.Subject, nullableString(identity.Email))
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, username, true, nil
+}
+
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityRepository_ConsumeLoginState(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIdentityRepository(db)
+
+	mock.ExpectExec("DELETE FROM oidc_login_states WHERE created_at < CURRENT_TIMESTAMP - \\$1 \\* INTERVAL '1 second'").
+		WithArgs(float64(600)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("DELETE FROM oidc_login_states WHERE state = \\$1 AND provider = \\$2 RETURNING provider, nonce, code_verifier").
+		WithArgs("state", "corp").
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "nonce", "code_verifier"}).AddRow("corp", "nonce", "verifier"))
+	mock.ExpectExec("DELETE FROM oidc_login_states WHERE created_at").
+		WithArgs(float64(600)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("DELETE FROM oidc_login_states WHERE state = \\$1").
+		WithArgs("state", "corp").
+		WillReturnError(sql.ErrNoRows)
+
+	state, err := repo.ConsumeLoginState(context.Background(), "state", "corp", 10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, OIDCLoginState{State: "state", Provider: "corp", Nonce: "nonce", CodeVerifier: "verifier"}, state)
+
+	_, err = repo.ConsumeLoginState(context.Background(), "state", "corp", 10*time.Minute)
+	assert.ErrorIs(t, err, ErrLoginStateNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdentityRepository_FindOrProvisionUser_Existing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIdentityRepository(db)
+	identity := ExternalIdentity{Issuer: "https://idp.example", Subject: "u-42", Email: "alice@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE user_identities AS i SET last_login_at = CURRENT_TIMESTAMP, email = \\$3 FROM users AS u WHERE u.id = i.user_id AND i.issuer = \\$1 AND i.subject = \\$2 RETURNING u.id, u.username").
+		WithArgs(identity.Issuer, identity.Subject, identity.Email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username"}).AddRow(7, "alice"))
+	mock.ExpectCommit()
+
+	userID, username, created, err := repo.FindOrProvisionUser(context.Background(), identity, []string{"alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, userID)
+	assert.Equal(t, "alice", username)
+	assert.False(t, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdentityRepository_FindOrProvisionUser_Provisions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIdentityRepository(db)
+	identity := ExternalIdentity{Issuer: "https://idp.example", Subject: "u-42"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE user_identities").
+		WithArgs(identity.Issuer, identity.Subject, nil).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO users \\(username, hashed_password\\) VALUES \\(\\$1, ''\\) ON CONFLICT DO NOTHING RETURNING id").
+		WithArgs("alice").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectExec("INSERT INTO user_identities \\(user_id, issuer, subject, email\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs(8, identity.Issuer, identity.Subject, nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	userID, username, created, err := repo.FindOrProvisionUser(context.Background(), identity, []string{"alice", "alice2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, userID)
+	assert.Equal(t, "alice2", username)
+	assert.True(t, created)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrIncomingWebhookNotFound = errors.New("incoming webhook not found")
+	ErrIntegrationNameTaken    = errors.New("integration name is already taken")
+)
+
+// IncomingWebhook lets external systems post into a chatroom through a secret URL. Messages are posted
+// as the webhook's bot user, which is named after the integration and cannot log in.
+type IncomingWebhook struct {
+	ID         int        `json:"id"`
+	ChatroomID int        `json:"chatroom_id"`
+	CreatedBy  int        `json:"created_by"`
+	BotUserID  int        `json:"bot_user_id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type IncomingWebhookRepository struct {
+	db *sql.DB
+}
+
+func NewIncomingWebhookRepository(db *sql.DB) *IncomingWebhookRepository {
+	return &IncomingWebhookRepository{db: db}
+}
+
+const incomingWebhookColumns = `id, chatroom_id, created_by, bot_user_id, name, created_at, last_used_at, revoked_at`
+
+func scanIncomingWebhook(row rowScanner) (IncomingWebhook, error) {
+	var webhook IncomingWebhook
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&webhook.ID, &webhook.ChatroomID, &webhook.CreatedBy, &webhook.BotUserID, &webhook.Name,
+		&webhook.CreatedAt, &lastUsedAt, &revokedAt)
+	if lastUsedAt.Valid {
+		webhook.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		webhook.RevokedAt = &revokedAt.Time
+	}
+	return webhook, err
+}
+
+// CreateIncomingWebhook creates the bot user named after the integration, makes it a member of the chatroom
+// and stores the webhook by the hash of its token
+func (repo *IncomingWebhookRepository) CreateIncomingWebhook(ctx context.Context, chatroomID, userID int, name, tokenHash string) (IncomingWebhook, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// An empty hash never matches a bcrypt comparison, so the bot user cannot log in
+	var botUserID int
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO users (username, hashed_password, is_bot)
+        VALUES ($1, '', TRUE)
+        RETURNING id
+    `, name).Scan(&botUserID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return IncomingWebhook{}, ErrIntegrationNameTaken
+	} else if err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to create integration user: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO chatroom_members (chatroom_id, user_id)
+        VALUES ($1, $2)
+    `, chatroomID, botUserID)
+	if err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to add integration to chatroom: %w", err)
+	}
+
+	webhook, err := scanIncomingWebhook(tx.QueryRowContext(ctx, `
+        INSERT INTO incoming_webhooks (chatroom_id, created_by, bot_user_id, name, token_hash)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING `+incomingWebhookColumns,
+		chatroomID, userID, botUserID, name, tokenHash))
+	if err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to create incoming webhook: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to commit incoming webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// ListIncomingWebhooks returns the incoming webhooks of the chatroom, only those created by createdBy unless it is 0
+func (repo *IncomingWebhookRepository) ListIncomingWebhooks(ctx context.Context, chatroomID, createdBy int) ([]IncomingWebhook, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT `+incomingWebhookColumns+`
+        FROM incoming_webhooks
+        WHERE chatroom_id = $1 AND ($2 = 0 OR created_by = $2)
+        ORDER BY id
+    `, chatroomID, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch incoming webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []IncomingWebhook{}
+	for rows.Next() {
+		webhook, err := scanIncomingWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan incoming webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// RevokeIncomingWebhook revokes the webhook, which must have been created by createdBy unless it is 0.
+// Webhooks of other users are reported as not found.
+func (repo *IncomingWebhookRepository) RevokeIncomingWebhook(ctx context.Context, chatroomID, webhookID, createdBy int) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE incoming_webhooks
+        SET revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND chatroom_id = $2 AND revoked_at IS NULL AND ($3 = 0 OR created_by = $3)
+    `, webhookID, chatroomID, createdBy)
+	if err != nil {
+		return fmt.Errorf("failed to revoke incoming webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke incoming webhook: %w", err)
+	}
+	if affected == 0 {
+		return ErrIncomingWebhookNotFound
+	}
+
+	return nil
+}
+
+// LookupIncomingWebhook returns the live webhook with the given token hash and records its use
+func (repo *IncomingWebhookRepository) LookupIncomingWebhook(ctx context.Context, tokenHash string) (IncomingWebhook, error) {
+	webhook, err := scanIncomingWebhook(repo.db.QueryRowContext(ctx, `
+        UPDATE incoming_webhooks
+        SET last_used_at = CURRENT_TIMESTAMP
+        WHERE token_hash = $1 AND revoked_at IS NULL
+        RETURNING `+incomingWebhookColumns,
+		tokenHash))
+	if err == sql.ErrNoRows {
+		return IncomingWebhook{}, ErrIncomingWebhookNotFound
+	} else if err != nil {
+		return IncomingWebhook{}, fmt.Errorf("failed to look up incoming webhook: %w", err)
+	}
+
+	return webhook, nil
+}
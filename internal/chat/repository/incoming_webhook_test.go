@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var incomingWebhookRowColumns = []string{"id", "chatroom_id", "created_by", "bot_user_id", "name", "created_at", "last_used_at", "revoked_at"}
+
+func TestIncomingWebhookRepository_CreateIncomingWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIncomingWebhookRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users \\(username, hashed_password, is_bot\\) VALUES \\(\\$1, '', TRUE\\) RETURNING id").
+		WithArgs("ci").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(40))
+	mock.ExpectExec("INSERT INTO chatroom_members \\(chatroom_id, user_id\\)").
+		WithArgs(1, 40).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO incoming_webhooks \\(chatroom_id, created_by, bot_user_id, name, token_hash\\)").
+		WithArgs(1, 7, 40, "ci", "hash").
+		WillReturnRows(sqlmock.NewRows(incomingWebhookRowColumns).AddRow(3, 1, 7, 40, "ci", timestamp, nil, nil))
+	mock.ExpectCommit()
+
+	webhook, err := repo.CreateIncomingWebhook(context.Background(), 1, 7, "ci", "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, webhook.ID)
+	assert.Equal(t, 40, webhook.BotUserID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIncomingWebhookRepository_CreateIncomingWebhook_NameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIncomingWebhookRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("alice").
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	_, err = repo.CreateIncomingWebhook(context.Background(), 1, 7, "alice", "hash")
+	assert.ErrorIs(t, err, ErrIntegrationNameTaken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIncomingWebhookRepository_LookupIncomingWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIncomingWebhookRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("UPDATE incoming_webhooks SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = \\$1 AND revoked_at IS NULL").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(incomingWebhookRowColumns).AddRow(3, 1, 7, 40, "ci", timestamp, timestamp, nil))
+
+	webhook, err := repo.LookupIncomingWebhook(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, webhook.ChatroomID)
+	assert.NotNil(t, webhook.LastUsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIncomingWebhookRepository_RevokeIncomingWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewIncomingWebhookRepository(db)
+
+	mock.ExpectExec("UPDATE incoming_webhooks SET revoked_at = CURRENT_TIMESTAMP WHERE id = \\$1 AND chatroom_id = \\$2 AND revoked_at IS NULL AND \\(\\$3 = 0 OR created_by = \\$3\\)").
+		WithArgs(5, 1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.RevokeIncomingWebhook(context.Background(), 1, 5, 7))
+
+	// Created by someone else
+	mock.ExpectExec("UPDATE incoming_webhooks SET revoked_at").
+		WithArgs(6, 1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.RevokeIncomingWebhook(context.Background(), 1, 6, 7), ErrIncomingWebhookNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// LoginThrottleRepository counts failed logins per key, such as an account name or a client address
+type LoginThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewLoginThrottleRepository(db *sql.DB) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db}
+}
+
+// LockedFor returns how much longer logins are refused for any of the keys, zero when none is locked
+func (repo *LoginThrottleRepository) LockedFor(ctx context.Context, keys []string) (time.Duration, error) {
+	var seconds float64
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - CURRENT_TIMESTAMP), 0)::float8
+        FROM login_throttle
+        WHERE key = ANY($1) AND locked_until > CURRENT_TIMESTAMP
+    `, pq.Array(keys)).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lockout: %w", err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecordFailure counts a failed login for the key and returns the number of consecutive failures.
+// The count starts over when the previous failure is older than window.
+func (repo *LoginThrottleRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures int
+	err := repo.db.QueryRowContext(ctx, `
+        INSERT INTO login_throttle (key, failures, last_failed_at)
+        VALUES ($1, 1, CURRENT_TIMESTAMP)
+        ON CONFLICT (key) DO UPDATE SET
+            failures = CASE
+                WHEN login_throttle.last_failed_at < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second' THEN 1
+                ELSE login_throttle.failures + 1
+            END,
+            last_failed_at = CURRENT_TIMESTAMP
+        RETURNING failures
+    `, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	return failures, nil
+}
+
+// Lock refuses logins for the key during the given duration
+func (repo *LoginThrottleRepository) Lock(ctx context.Context, key string, duration time.Duration) error {
+	_, err := repo.db.ExecContext(ctx, `
+        UPDATE login_throttle
+        SET locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+        WHERE key = $1
+    `, key, duration.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+}
+
+// Clear forgets the failures and lifts the lockouts of the keys, it returns whether any key was tracked
+func (repo *LoginThrottleRepository) Clear(ctx context.Context, keys []string) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `
+        DELETE FROM login_throttle
+        WHERE key = ANY($1)
+    `, pq.Array(keys))
+	if err != nil {
+		return false, fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	cleared, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	return cleared > 0, nil
+}
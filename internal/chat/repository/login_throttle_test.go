@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottleRepository_LockedFor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewLoginThrottleRepository(db)
+	keys := []string{"account:alice", "ip:10.0.0.1"}
+
+	mock.ExpectQuery("SELECT COALESCE\\(EXTRACT\\(EPOCH FROM MAX\\(locked_until\\) - CURRENT_TIMESTAMP\\), 0\\)::float8 FROM login_throttle WHERE key = ANY\\(\\$1\\) AND locked_until > CURRENT_TIMESTAMP").
+		WithArgs(pq.Array(keys)).
+		WillReturnRows(sqlmock.NewRows([]string{"seconds"}).AddRow(1.5))
+
+	wait, err := repo.LockedFor(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, wait)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginThrottleRepository_RecordFailureAndLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewLoginThrottleRepository(db)
+
+	mock.ExpectQuery("INSERT INTO login_throttle \\(key, failures, last_failed_at\\) VALUES \\(\\$1, 1, CURRENT_TIMESTAMP\\) ON CONFLICT \\(key\\) DO UPDATE SET").
+		WithArgs("account:alice", float64(3600)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(4))
+	mock.ExpectExec("UPDATE login_throttle SET locked_until = CURRENT_TIMESTAMP \\+ \\$2 \\* INTERVAL '1 second' WHERE key = \\$1").
+		WithArgs("account:alice", float64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	failures, err := repo.RecordFailure(context.Background(), "account:alice", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, failures)
+
+	assert.NoError(t, repo.Lock(context.Background(), "account:alice", 2*time.Second))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginThrottleRepository_Clear(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewLoginThrottleRepository(db)
+
+	mock.ExpectExec("DELETE FROM login_throttle WHERE key = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"account:alice"})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM login_throttle WHERE key = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"ip:10.0.0.1"})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cleared, err := repo.Clear(context.Background(), []string{"account:alice"})
+	assert.NoError(t, err)
+	assert.True(t, cleared)
+
+	cleared, err = repo.Clear(context.Background(), []string{"ip:10.0.0.1"})
+	assert.NoError(t, err)
+	assert.False(t, cleared)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
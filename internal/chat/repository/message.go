@@ -3,16 +3,40 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidParent   = errors.New("replies can only be made to root messages")
+)
+
 type Message struct {
-	ID         int       `json:"id"`
-	ChatroomID int       `json:"chatroom_id"`
-	UserID     int       `json:"user_id"`
-	Content    string    `json:"content"`
-	Timestamp  time.Time `json:"timestamp"`
+	ID          int               `json:"id"`
+	ChatroomID  int               `json:"chatroom_id"`
+	UserID      int               `json:"user_id"`
+	Content     string            `json:"content"`
+	Timestamp   time.Time         `json:"timestamp"`
+	ParentID    *int              `json:"parent_id,omitempty"`
+	ReplyCount  int               `json:"reply_count"`
+	LastReplyAt *time.Time        `json:"last_reply_at,omitempty"`
+	Reactions   []ReactionSummary `json:"reactions,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	// Formatted is the parsed representation of Content (see package markup), clients render it instead of the raw text
+	Formatted json.RawMessage `json:"formatted,omitempty"`
+	// LinkPreviews is filled in asynchronously by the link preview worker, it is stored as JSON and passed through as is
+	LinkPreviews json.RawMessage `json:"link_previews,omitempty"`
+}
+
+// ThreadSummary carries the reply counters of a root message after a new reply was added
+type ThreadSummary struct {
+	ParentID    int       `json:"parent_id"`
+	ChatroomID  int       `json:"chatroom_id"`
+	ReplyCount  int       `json:"reply_count"`
+	LastReplyAt time.Time `json:"last_reply_at"`
 }
 
 type MessageRepository struct {
@@ -23,23 +47,139 @@ func NewMessageRepository(db *sql.DB) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
-func (repo *MessageRepository) AddMessage(ctx context.Context, chatroomID, userID int, content string) error {
-	_, err := repo.db.ExecContext(ctx, `
-        INSERT INTO messages (chatroom_id, user_id, content)
-        VALUES ($1, $2, $3)
-    `, chatroomID, userID, content)
+// NewMessage is a message or reply about to be stored
+type NewMessage struct {
+	ChatroomID int
+	UserID     int
+	Content    string
+	// Formatted is the parsed, sanitized representation of Content, stored as JSON next to it
+	Formatted json.RawMessage
+	// Pending uploads to link to the message
+	AttachmentIDs []int
+}
+
+// AddMessage stores a root message, pending uploads listed in AttachmentIDs are linked to it in the same transaction
+func (repo *MessageRepository) AddMessage(ctx context.Context, input NewMessage) (Message, error) {
+	msg := Message{
+		ChatroomID: input.ChatroomID,
+		UserID:     input.UserID,
+		Content:    input.Content,
+		Formatted:  input.Formatted,
+	}
+
+	if len(input.AttachmentIDs) == 0 {
+		err := repo.db.QueryRowContext(ctx, `
+        INSERT INTO messages (chatroom_id, user_id, content, formatted)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, timestamp
+    `, input.ChatroomID, input.UserID, input.Content, nullableJSON(input.Formatted)).Scan(&msg.ID, &msg.Timestamp)
+		if err != nil {
+			return Message{}, fmt.Errorf("failed to save message: %w", err)
+		}
+
+		return msg, nil
+	}
+
+	tx, err := repo.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+		return Message{}, fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	return nil
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO messages (chatroom_id, user_id, content, formatted)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, timestamp
+    `, input.ChatroomID, input.UserID, input.Content, nullableJSON(input.Formatted)).Scan(&msg.ID, &msg.Timestamp)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to save message: %w", err)
+	}
+
+	msg.Attachments, err = attachToMessage(ctx, tx, msg.ID, input.ChatroomID, input.UserID, input.AttachmentIDs)
+	if err != nil {
+		return Message{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Message{}, fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	return msg, nil
 }
 
-func (repo *MessageRepository) GetLastMessages(ctx context.Context, chatroomID int, limit int) ([]Message, error) {
+// AddReply stores a reply to a root message of the input's chatroom and bumps the parent's reply counters in the same transaction.
+// Pending uploads listed in AttachmentIDs are linked to the reply as well.
+func (repo *MessageRepository) AddReply(ctx context.Context, parentID int, input NewMessage) (Message, ThreadSummary, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, ThreadSummary{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var grandparentID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+        SELECT parent_id
+        FROM messages
+        WHERE id = $1 AND chatroom_id = $2
+        FOR UPDATE
+    `, parentID, input.ChatroomID).Scan(&grandparentID)
+	if err == sql.ErrNoRows {
+		return Message{}, ThreadSummary{}, ErrMessageNotFound
+	} else if err != nil {
+		return Message{}, ThreadSummary{}, fmt.Errorf("failed to fetch parent message: %w", err)
+	}
+	if grandparentID.Valid {
+		return Message{}, ThreadSummary{}, ErrInvalidParent
+	}
+
+	reply := Message{
+		ChatroomID: input.ChatroomID,
+		UserID:     input.UserID,
+		Content:    input.Content,
+		Formatted:  input.Formatted,
+		ParentID:   &parentID,
+	}
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO messages (chatroom_id, user_id, content, formatted, parent_id)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, timestamp
+    `, input.ChatroomID, input.UserID, input.Content, nullableJSON(input.Formatted), parentID).Scan(&reply.ID, &reply.Timestamp)
+	if err != nil {
+		return Message{}, ThreadSummary{}, fmt.Errorf("failed to save reply: %w", err)
+	}
+
+	if len(input.AttachmentIDs) > 0 {
+		reply.Attachments, err = attachToMessage(ctx, tx, reply.ID, input.ChatroomID, input.UserID, input.AttachmentIDs)
+		if err != nil {
+			return Message{}, ThreadSummary{}, err
+		}
+	}
+
+	summary := ThreadSummary{ParentID: parentID, ChatroomID: input.ChatroomID}
+	err = tx.QueryRowContext(ctx, `
+        UPDATE messages
+        SET reply_count = reply_count + 1, last_reply_at = $2
+        WHERE id = $1
+        RETURNING reply_count, last_reply_at
+    `, parentID, reply.Timestamp).Scan(&summary.ReplyCount, &summary.LastReplyAt)
+	if err != nil {
+		return Message{}, ThreadSummary{}, fmt.Errorf("failed to update thread counters: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Message{}, ThreadSummary{}, fmt.Errorf("failed to commit reply: %w", err)
+	}
+
+	return reply, summary, nil
+}
+
+// GetLastMessages returns the most recent root messages of a chatroom, replies are fetched through GetThread.
+// Reactions are aggregated per emoji, flagged with whether viewerID is one of the reactors.
+func (repo *MessageRepository) GetLastMessages(ctx context.Context, chatroomID, viewerID, limit int) ([]Message, error) {
 	rows, err := repo.db.QueryContext(ctx, `
-        SELECT id, chatroom_id, user_id, content, timestamp
+        SELECT id, chatroom_id, user_id, content, formatted, timestamp, reply_count, last_reply_at, link_previews
         FROM messages
-        WHERE chatroom_id = $1
+        WHERE chatroom_id = $1 AND parent_id IS NULL
         ORDER BY timestamp DESC
         LIMIT $2
     `, chatroomID, limit)
@@ -51,11 +191,185 @@ func (repo *MessageRepository) GetLastMessages(ctx context.Context, chatroomID i
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.ChatroomID, &msg.UserID, &msg.Content, &msg.Timestamp); err != nil {
+		var lastReplyAt sql.NullTime
+		var formatted, linkPreviews []byte
+		if err := rows.Scan(&msg.ID, &msg.ChatroomID, &msg.UserID, &msg.Content, &formatted, &msg.Timestamp, &msg.ReplyCount, &lastReplyAt, &linkPreviews); err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
+		if lastReplyAt.Valid {
+			msg.LastReplyAt = &lastReplyAt.Time
+		}
+		msg.Formatted = formatted
+		msg.LinkPreviews = linkPreviews
 		messages = append(messages, msg)
 	}
 
+	messageIDs := make([]int, len(messages))
+	for i, msg := range messages {
+		messageIDs[i] = msg.ID
+	}
+
+	reactions, err := summarizeReactions(ctx, repo.db, messageIDs, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := listMessageAttachments(ctx, repo.db, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+
 	return messages, nil
 }
+
+// GetThread returns a root message and a page of its replies in chronological order.
+// Replies are paginated by ID: pass the last reply ID of the previous page as afterID (0 for the first page).
+func (repo *MessageRepository) GetThread(ctx context.Context, parentID, afterID, limit int) (Message, []Message, error) {
+	var root Message
+	var rootParentID sql.NullInt64
+	var lastReplyAt sql.NullTime
+	var rootFormatted, rootLinkPreviews []byte
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT id, chatroom_id, user_id, content, formatted, timestamp, parent_id, reply_count, last_reply_at, link_previews
+        FROM messages
+        WHERE id = $1
+    `, parentID).Scan(&root.ID, &root.ChatroomID, &root.UserID, &root.Content, &rootFormatted, &root.Timestamp, &rootParentID, &root.ReplyCount, &lastReplyAt, &rootLinkPreviews)
+	if err == sql.ErrNoRows {
+		return Message{}, nil, ErrMessageNotFound
+	} else if err != nil {
+		return Message{}, nil, fmt.Errorf("failed to fetch thread root: %w", err)
+	}
+	if rootParentID.Valid {
+		return Message{}, nil, ErrInvalidParent
+	}
+	if lastReplyAt.Valid {
+		root.LastReplyAt = &lastReplyAt.Time
+	}
+	root.Formatted = rootFormatted
+	root.LinkPreviews = rootLinkPreviews
+
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT id, chatroom_id, user_id, content, formatted, timestamp, link_previews
+        FROM messages
+        WHERE parent_id = $1 AND id > $2
+        ORDER BY id ASC
+        LIMIT $3
+    `, parentID, afterID, limit)
+	if err != nil {
+		return Message{}, nil, fmt.Errorf("failed to fetch replies: %w", err)
+	}
+	defer rows.Close()
+
+	var replies []Message
+	for rows.Next() {
+		reply := Message{ParentID: &root.ID}
+		var formatted, linkPreviews []byte
+		if err := rows.Scan(&reply.ID, &reply.ChatroomID, &reply.UserID, &reply.Content, &formatted, &reply.Timestamp, &linkPreviews); err != nil {
+			return Message{}, nil, fmt.Errorf("failed to scan reply: %w", err)
+		}
+		reply.Formatted = formatted
+		reply.LinkPreviews = linkPreviews
+		replies = append(replies, reply)
+	}
+
+	messageIDs := []int{root.ID}
+	for _, reply := range replies {
+		messageIDs = append(messageIDs, reply.ID)
+	}
+
+	attachments, err := listMessageAttachments(ctx, repo.db, messageIDs)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	root.Attachments = attachments[root.ID]
+	for i := range replies {
+		replies[i].Attachments = attachments[replies[i].ID]
+	}
+
+	return root, replies, nil
+}
+
+// SetLinkPreviews stores the unfurled previews of a message, previews is a JSON array
+func (repo *MessageRepository) SetLinkPreviews(ctx context.Context, chatroomID, messageID int, previews json.RawMessage) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE messages
+        SET link_previews = $3
+        WHERE id = $1 AND chatroom_id = $2
+    `, messageID, chatroomID, []byte(previews))
+	if err != nil {
+		return fmt.Errorf("failed to save link previews: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save link previews: %w", err)
+	}
+	if affected == 0 {
+		return ErrMessageNotFound
+	}
+
+	return nil
+}
+
+// nullableJSON stores an empty document as NULL rather than as invalid JSON
+func nullableJSON(document json.RawMessage) interface{} {
+	if len(document) == 0 {
+		return nil
+	}
+	return []byte(document)
+}
+
+// DeleteMessage removes a message posted by userID, along with its replies when it is a thread root.
+// It returns the deleted message and the blob keys of its attachments, which the caller removes from storage.
+func (repo *MessageRepository) DeleteMessage(ctx context.Context, chatroomID, messageID, userID int) (Message, []string, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Message{}, nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	blobKeys, err := deleteMessageAttachments(ctx, tx, `
+            SELECT id FROM messages
+            WHERE (id = $1 OR parent_id = $1) AND chatroom_id = $2
+              AND EXISTS (SELECT 1 FROM messages WHERE id = $1 AND chatroom_id = $2 AND user_id = $3)
+        `, messageID, chatroomID, userID)
+	if err != nil {
+		return Message{}, nil, err
+	}
+
+	msg := Message{ChatroomID: chatroomID, UserID: userID}
+	var parentID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+        DELETE FROM messages
+        WHERE id = $1 AND chatroom_id = $2 AND user_id = $3
+        RETURNING id, content, timestamp, parent_id
+    `, messageID, chatroomID, userID).Scan(&msg.ID, &msg.Content, &msg.Timestamp, &parentID)
+	if err == sql.ErrNoRows {
+		return Message{}, nil, ErrMessageNotFound
+	} else if err != nil {
+		return Message{}, nil, fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	if parentID.Valid {
+		parent := int(parentID.Int64)
+		msg.ParentID = &parent
+		_, err = tx.ExecContext(ctx, `
+        UPDATE messages
+        SET reply_count = GREATEST(reply_count - 1, 0),
+            last_reply_at = (SELECT MAX(timestamp) FROM messages WHERE parent_id = $1)
+        WHERE id = $1
+    `, parent)
+		if err != nil {
+			return Message{}, nil, fmt.Errorf("failed to update thread counters: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Message{}, nil, fmt.Errorf("failed to commit message deletion: %w", err)
+	}
+
+	return msg, blobKeys, nil
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,14 +21,140 @@ func TestMessageRepository_AddMessage(t *testing.T) {
 
 	chatroomID := 1
 	userID := 1
-	content := "Hello, world!"
+	content := "Hello, **world**!"
+	formatted := []byte(`{"nodes":[{"type":"text","text":"Hello, "}]}`)
 
-	mock.ExpectExec("INSERT INTO messages").
-		WithArgs(chatroomID, userID, content).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	timestamp := time.Now()
+
+	mock.ExpectQuery("INSERT INTO messages \\(chatroom_id, user_id, content, formatted\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\) RETURNING id, timestamp").
+		WithArgs(chatroomID, userID, content, formatted).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "timestamp"}).AddRow(7, timestamp))
 
-	err = repo.AddMessage(context.Background(), chatroomID, userID, content)
+	msg, err := repo.AddMessage(context.Background(), NewMessage{ChatroomID: chatroomID, UserID: userID, Content: content, Formatted: formatted})
 	assert.NoError(t, err)
+	assert.Equal(t, 7, msg.ID)
+	assert.Equal(t, timestamp, msg.Timestamp)
+	assert.Equal(t, content, msg.Content)
+	assert.JSONEq(t, string(formatted), string(msg.Formatted))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_AddMessage_WithAttachments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO messages \\(chatroom_id, user_id, content, formatted\\)").
+		WithArgs(1, 2, "See attached", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "timestamp"}).AddRow(7, timestamp))
+	mock.ExpectQuery("UPDATE attachments SET message_id = \\$1 WHERE id = ANY\\(\\$4\\) AND chatroom_id = \\$2 AND uploader_id = \\$3 AND message_id IS NULL").
+		WithArgs(7, 1, 2, pq.Array([]int{3, 4})).
+		WillReturnRows(sqlmock.NewRows(attachmentRowColumns).
+			AddRow(3, 1, 2, 7, "a.pdf", "application/pdf", 100, nil, nil, "attachments/a", nil, timestamp).
+			AddRow(4, 1, 2, 7, "b.txt", "text/plain", 10, nil, nil, "attachments/b", nil, timestamp))
+	mock.ExpectCommit()
+
+	msg, err := repo.AddMessage(context.Background(), NewMessage{ChatroomID: 1, UserID: 2, Content: "See attached", AttachmentIDs: []int{3, 4}})
+	assert.NoError(t, err)
+	assert.Len(t, msg.Attachments, 2)
+	assert.Equal(t, 7, *msg.Attachments[0].MessageID)
+	assert.False(t, msg.Attachments[0].HasThumbnail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_AddMessage_ForeignAttachment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO messages").
+		WithArgs(1, 2, "Not mine", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "timestamp"}).AddRow(7, time.Now()))
+	mock.ExpectQuery("UPDATE attachments SET message_id").
+		WithArgs(7, 1, 2, pq.Array([]int{9})).
+		WillReturnRows(sqlmock.NewRows(attachmentRowColumns))
+	mock.ExpectRollback()
+
+	_, err = repo.AddMessage(context.Background(), NewMessage{ChatroomID: 1, UserID: 2, Content: "Not mine", AttachmentIDs: []int{9}})
+	assert.ErrorIs(t, err, ErrInvalidAttachments)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_AddReply(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	chatroomID := 1
+	parentID := 5
+	userID := 2
+	content := "Replying in a thread"
+	timestamp := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT parent_id FROM messages WHERE id = \\$1 AND chatroom_id = \\$2 FOR UPDATE").
+		WithArgs(parentID, chatroomID).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(nil))
+	mock.ExpectQuery("INSERT INTO messages \\(chatroom_id, user_id, content, formatted, parent_id\\)").
+		WithArgs(chatroomID, userID, content, nil, parentID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "timestamp"}).AddRow(9, timestamp))
+	mock.ExpectQuery("UPDATE messages SET reply_count = reply_count \\+ 1, last_reply_at = \\$2 WHERE id = \\$1").
+		WithArgs(parentID, timestamp).
+		WillReturnRows(sqlmock.NewRows([]string{"reply_count", "last_reply_at"}).AddRow(3, timestamp))
+	mock.ExpectCommit()
+
+	reply, thread, err := repo.AddReply(context.Background(), parentID, NewMessage{ChatroomID: chatroomID, UserID: userID, Content: content})
+	assert.NoError(t, err)
+	assert.Equal(t, 9, reply.ID)
+	assert.Equal(t, parentID, *reply.ParentID)
+	assert.Equal(t, 3, thread.ReplyCount)
+	assert.Equal(t, timestamp, thread.LastReplyAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_AddReply_ParentIsReply(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT parent_id FROM messages").
+		WithArgs(9, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"parent_id"}).AddRow(5))
+	mock.ExpectRollback()
+
+	_, _, err = repo.AddReply(context.Background(), 9, NewMessage{ChatroomID: 1, UserID: 2, Content: "Nested reply"})
+	assert.ErrorIs(t, err, ErrInvalidParent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_AddReply_ParentNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT parent_id FROM messages").
+		WithArgs(5, 2).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, _, err = repo.AddReply(context.Background(), 5, NewMessage{ChatroomID: 2, UserID: 2, Content: "Wrong room"})
+	assert.ErrorIs(t, err, ErrMessageNotFound)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -38,21 +166,153 @@ func TestMessageRepository_GetLastMessages(t *testing.T) {
 	repo := NewMessageRepository(db)
 
 	chatroomID := 1
+	viewerID := 4
 	limit := 10
 	timestamp := time.Now()
 
-	rows := sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "content", "timestamp"}).
-		AddRow(1, chatroomID, 1, "Hello, world!", timestamp).
-		AddRow(2, chatroomID, 2, "Hi there!", timestamp)
+	rows := sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "content", "formatted", "timestamp", "reply_count", "last_reply_at", "link_previews"}).
+		AddRow(1, chatroomID, 1, "Hello, world!", []byte(`{"nodes":[{"type":"text","text":"Hello, world!"}]}`), timestamp, 2, timestamp, nil).
+		AddRow(2, chatroomID, 2, "Hi there! https://example.com", nil, timestamp, 0, nil, []byte(`[{"url":"https://example.com","title":"Example"}]`))
 
-	mock.ExpectQuery("SELECT id, chatroom_id, user_id, content, timestamp FROM messages WHERE chatroom_id = \\$1 ORDER BY timestamp DESC LIMIT \\$2").
+	mock.ExpectQuery("SELECT id, chatroom_id, user_id, content, formatted, timestamp, reply_count, last_reply_at, link_previews FROM messages WHERE chatroom_id = \\$1 AND parent_id IS NULL ORDER BY timestamp DESC LIMIT \\$2").
 		WithArgs(chatroomID, limit).
 		WillReturnRows(rows)
+	mock.ExpectQuery("SELECT message_id, emoji, COUNT\\(\\*\\), BOOL_OR\\(user_id = \\$2\\) FROM message_reactions WHERE message_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]int{1, 2}), viewerID).
+		WillReturnRows(sqlmock.NewRows([]string{"message_id", "emoji", "count", "bool_or"}).
+			AddRow(1, "👍", 3, true).
+			AddRow(1, "🎉", 1, false))
+	mock.ExpectQuery("SELECT id, chatroom_id, uploader_id, message_id, filename, content_type, size_bytes, width, height, storage_key, thumbnail_key, created_at FROM attachments WHERE message_id = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]int{1, 2})).
+		WillReturnRows(sqlmock.NewRows(attachmentRowColumns).
+			AddRow(3, chatroomID, 2, 2, "chart.png", "image/png", 2048, 640, 480, "attachments/a", "attachments/a-thumb", timestamp))
 
-	messages, err := repo.GetLastMessages(context.Background(), chatroomID, limit)
+	messages, err := repo.GetLastMessages(context.Background(), chatroomID, viewerID, limit)
 	assert.NoError(t, err)
 	assert.Len(t, messages, 2)
 	assert.Equal(t, "Hello, world!", messages[0].Content)
-	assert.Equal(t, "Hi there!", messages[1].Content)
+	assert.Equal(t, "Hi there! https://example.com", messages[1].Content)
+	assert.JSONEq(t, `{"nodes":[{"type":"text","text":"Hello, world!"}]}`, string(messages[0].Formatted))
+	assert.Nil(t, messages[1].Formatted)
+	assert.Nil(t, messages[0].LinkPreviews)
+	assert.JSONEq(t, `[{"url":"https://example.com","title":"Example"}]`, string(messages[1].LinkPreviews))
+	assert.Equal(t, 2, messages[0].ReplyCount)
+	assert.NotNil(t, messages[0].LastReplyAt)
+	assert.Nil(t, messages[1].LastReplyAt)
+	assert.Equal(t, []ReactionSummary{
+		{Emoji: "👍", Count: 3, ReactedByMe: true},
+		{Emoji: "🎉", Count: 1, ReactedByMe: false},
+	}, messages[0].Reactions)
+	assert.Empty(t, messages[1].Reactions)
+	assert.Empty(t, messages[0].Attachments)
+	assert.Len(t, messages[1].Attachments, 1)
+	assert.Equal(t, "chart.png", messages[1].Attachments[0].Filename)
+	assert.True(t, messages[1].Attachments[0].HasThumbnail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_GetThread(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	parentID := 5
+	timestamp := time.Now()
+
+	mock.ExpectQuery("SELECT id, chatroom_id, user_id, content, formatted, timestamp, parent_id, reply_count, last_reply_at, link_previews FROM messages WHERE id = \\$1").
+		WithArgs(parentID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "content", "formatted", "timestamp", "parent_id", "reply_count", "last_reply_at", "link_previews"}).
+			AddRow(parentID, 1, 1, "Root message", nil, timestamp, nil, 2, timestamp, nil))
+	mock.ExpectQuery("SELECT id, chatroom_id, user_id, content, formatted, timestamp, link_previews FROM messages WHERE parent_id = \\$1 AND id > \\$2 ORDER BY id ASC LIMIT \\$3").
+		WithArgs(parentID, 0, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "content", "formatted", "timestamp", "link_previews"}).
+			AddRow(6, 1, 2, "First reply", nil, timestamp, nil).
+			AddRow(8, 1, 3, "Second reply", nil, timestamp, nil))
+	mock.ExpectQuery("SELECT (.+) FROM attachments WHERE message_id = ANY").
+		WithArgs(pq.Array([]int{parentID, 6, 8})).
+		WillReturnRows(sqlmock.NewRows(attachmentRowColumns))
+
+	root, replies, err := repo.GetThread(context.Background(), parentID, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "Root message", root.Content)
+	assert.Equal(t, 2, root.ReplyCount)
+	assert.Len(t, replies, 2)
+	assert.Equal(t, "First reply", replies[0].Content)
+	assert.Equal(t, parentID, *replies[1].ParentID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_SetLinkPreviews(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	previews := []byte(`[{"url":"https://example.com","title":"Example"}]`)
+
+	mock.ExpectExec("UPDATE messages SET link_previews = \\$3 WHERE id = \\$1 AND chatroom_id = \\$2").
+		WithArgs(7, 1, previews).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE messages SET link_previews").
+		WithArgs(7, 2, previews).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.SetLinkPreviews(context.Background(), 1, 7, previews))
+	assert.ErrorIs(t, repo.SetLinkPreviews(context.Background(), 2, 7, previews), ErrMessageNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_DeleteMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM attachments WHERE message_id IN").
+		WithArgs(9, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key", "thumbnail_key"}).
+			AddRow("attachments/a", "attachments/a-thumb").
+			AddRow("attachments/b", nil))
+	mock.ExpectQuery("DELETE FROM messages WHERE id = \\$1 AND chatroom_id = \\$2 AND user_id = \\$3 RETURNING id, content, timestamp, parent_id").
+		WithArgs(9, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "content", "timestamp", "parent_id"}).AddRow(9, "Oops", timestamp, 5))
+	mock.ExpectExec("UPDATE messages SET reply_count = GREATEST\\(reply_count - 1, 0\\)").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	msg, blobKeys, err := repo.DeleteMessage(context.Background(), 1, 9, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, msg.ID)
+	assert.Equal(t, 5, *msg.ParentID)
+	assert.Equal(t, []string{"attachments/a", "attachments/a-thumb", "attachments/b"}, blobKeys)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageRepository_DeleteMessage_NotAuthor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM attachments").
+		WithArgs(9, 1, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key", "thumbnail_key"}))
+	mock.ExpectQuery("DELETE FROM messages").
+		WithArgs(9, 1, 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, _, err = repo.DeleteMessage(context.Background(), 1, 9, 3)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTOTPNotFound       = errors.New("totp is not set up")
+	ErrTOTPAlreadyEnabled = errors.New("totp is already enabled")
+)
+
+// TOTPState is a user's TOTP secret, Enabled is false while the enrollment awaits its first code
+type TOTPState struct {
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+}
+
+type MFARepository struct {
+	db *sql.DB
+}
+
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// StartTOTPEnrollment stores a new secret awaiting confirmation, replacing an unconfirmed one.
+// It fails with ErrTOTPAlreadyEnabled once TOTP is enabled, which has to be disabled first.
+func (repo *MFARepository) StartTOTPEnrollment(ctx context.Context, userID int, secret string) error {
+	result, err := repo.db.ExecContext(ctx, `
+        INSERT INTO user_totp (user_id, secret)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+        WHERE user_totp.enabled_at IS NULL
+    `, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if stored == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (repo *MFARepository) GetTOTP(ctx context.Context, userID int) (TOTPState, error) {
+	var state TOTPState
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT secret, enabled_at IS NOT NULL, last_used_step
+        FROM user_totp
+        WHERE user_id = $1
+    `, userID).Scan(&state.Secret, &state.Enabled, &state.LastUsedStep)
+	if err == sql.ErrNoRows {
+		return TOTPState{}, ErrTOTPNotFound
+	} else if err != nil {
+		return TOTPState{}, fmt.Errorf("failed to fetch totp secret: %w", err)
+	}
+
+	return state, nil
+}
+
+// IsTOTPEnabled reports whether logins of the user need a second factor
+func (repo *MFARepository) IsTOTPEnabled(ctx context.Context, userID int) (bool, error) {
+	var enabled bool
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+    `, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to check totp: %w", err)
+	}
+
+	return enabled, nil
+}
+
+// EnableTOTP confirms the enrollment with the period of the first valid code and stores the recovery code hashes
+func (repo *MFARepository) EnableTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+        UPDATE user_totp
+        SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $2
+        WHERE user_id = $1 AND enabled_at IS NULL
+    `, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+	if enabled, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	} else if enabled == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the code of a period was used, it returns false when that period or a later one already was,
+// which makes concurrent logins with the same code fail but one
+func (repo *MFARepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE user_totp
+        SET last_used_step = $2
+        WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2
+    `, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp use: %w", err)
+	}
+
+	used, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp use: %w", err)
+	}
+
+	return used > 0, nil
+}
+
+// UseRecoveryCode spends an unused recovery code, it returns false when the code is unknown or was already used
+func (repo *MFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE mfa_recovery_codes
+        SET used_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    `, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	used, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return used > 0, nil
+}
+
+func (repo *MFARepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM mfa_recovery_codes
+        WHERE user_id = $1 AND used_at IS NULL
+    `, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
+
+// ReplaceRecoveryCodes invalidates every previous recovery code of the user
+func (repo *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	for _, codeHash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO mfa_recovery_codes (user_id, code_hash)
+            VALUES ($1, $2)
+        `, userID, codeHash)
+		if err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the secret and the recovery codes, logins only need the password again
+func (repo *MFARepository) DisableTOTP(ctx context.Context, userID int) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete totp secret: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMFARepository_StartTOTPEnrollment_AlreadyEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMFARepository(db)
+
+	mock.ExpectExec("INSERT INTO user_totp \\(user_id, secret\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(user_id\\) DO UPDATE .* WHERE user_totp.enabled_at IS NULL").
+		WithArgs(1, "SECRET").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO user_totp").
+		WithArgs(1, "OTHER").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.StartTOTPEnrollment(context.Background(), 1, "SECRET"))
+	assert.ErrorIs(t, repo.StartTOTPEnrollment(context.Background(), 1, "OTHER"), ErrTOTPAlreadyEnabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepository_GetTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMFARepository(db)
+
+	mock.ExpectQuery("SELECT secret, enabled_at IS NOT NULL, last_used_step FROM user_totp WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"secret", "enabled", "last_used_step"}).AddRow("SECRET", true, 42))
+	mock.ExpectQuery("SELECT secret, enabled_at IS NOT NULL, last_used_step FROM user_totp WHERE user_id = \\$1").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+
+	state, err := repo.GetTOTP(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, TOTPState{Secret: "SECRET", Enabled: true, LastUsedStep: 42}, state)
+
+	_, err = repo.GetTOTP(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrTOTPNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepository_EnableTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMFARepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP, last_used_step = \\$2 WHERE user_id = \\$1 AND enabled_at IS NULL").
+		WithArgs(1, int64(42)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM mfa_recovery_codes WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO mfa_recovery_codes \\(user_id, code_hash\\) VALUES \\(\\$1, \\$2\\)").
+		WithArgs(1, "hash1").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO mfa_recovery_codes \\(user_id, code_hash\\) VALUES \\(\\$1, \\$2\\)").
+		WithArgs(1, "hash2").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	err = repo.EnableTOTP(context.Background(), 1, 42, []string{"hash1", "hash2"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepository_UseTOTPStepAndRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMFARepository(db)
+
+	mock.ExpectExec("UPDATE user_totp SET last_used_step = \\$2 WHERE user_id = \\$1 AND enabled_at IS NOT NULL AND last_used_step < \\$2").
+		WithArgs(1, int64(43)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = \\$1 AND code_hash = \\$2 AND used_at IS NULL").
+		WithArgs(1, "hash1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	used, err := repo.UseTOTPStep(context.Background(), 1, 43)
+	assert.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = repo.UseRecoveryCode(context.Background(), 1, "hash1")
+	assert.NoError(t, err)
+	assert.True(t, used)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFARepository_DisableTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMFARepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM mfa_recovery_codes WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM user_totp WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.DisableTOTP(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notification kinds
+const (
+	NotificationMention = "mention"
+	NotificationKeyword = "keyword"
+)
+
+// MaxKeywordsPerUser bounds how many keywords a user can watch
+const MaxKeywordsPerUser = 20
+
+var ErrInvalidKeyword = errors.New("keywords must be 2 to 64 letters, digits, '-' or '_'")
+
+// Keywords are matched as whole words with a regular expression, so they are restricted to characters that are not special in it
+var keywordPattern = regexp.MustCompile(`^[\p{L}\p{N}_-]{2,64}$`)
+
+// Notification tells a user about a message that mentioned them or matched one of their keywords
+type Notification struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	ChatroomID int        `json:"chatroom_id"`
+	MessageID  int        `json:"message_id"`
+	ActorID    int        `json:"actor_id"`
+	Kind       string     `json:"kind"`
+	Keyword    string     `json:"keyword,omitempty"`
+	Content    string     `json:"content"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// NormalizeKeywords lowercases and deduplicates keywords, it fails on the first invalid one
+func NormalizeKeywords(keywords []string) ([]string, error) {
+	if len(keywords) > MaxKeywordsPerUser {
+		return nil, fmt.Errorf("%w: at most %d keywords", ErrInvalidKeyword, MaxKeywordsPerUser)
+	}
+
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if !keywordPattern.MatchString(keyword) {
+			return nil, ErrInvalidKeyword
+		}
+		if !seen[keyword] {
+			seen[keyword] = true
+			normalized = append(normalized, keyword)
+		}
+	}
+
+	return normalized, nil
+}
+
+// SetKeywords replaces the user's keywords, they must already be normalized
+func (repo *NotificationRepository) SetKeywords(ctx context.Context, userID int, keywords []string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        DELETE FROM notification_keywords
+        WHERE user_id = $1
+    `, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear keywords: %w", err)
+	}
+
+	if len(keywords) > 0 {
+		_, err = tx.ExecContext(ctx, `
+        INSERT INTO notification_keywords (user_id, keyword)
+        SELECT $1, unnest($2::text[])
+    `, userID, pq.Array(keywords))
+		if err != nil {
+			return fmt.Errorf("failed to save keywords: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit keywords: %w", err)
+	}
+
+	return nil
+}
+
+func (repo *NotificationRepository) ListKeywords(ctx context.Context, userID int) ([]string, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT keyword
+        FROM notification_keywords
+        WHERE user_id = $1
+        ORDER BY keyword
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keywords: %w", err)
+	}
+	defer rows.Close()
+
+	keywords := []string{}
+	for rows.Next() {
+		var keyword string
+		if err := rows.Scan(&keyword); err != nil {
+			return nil, fmt.Errorf("failed to scan keyword: %w", err)
+		}
+		keywords = append(keywords, keyword)
+	}
+
+	return keywords, rows.Err()
+}
+
+// CreateForMessage notifies the mentioned users, and the chatroom members whose keywords appear in the message.
+// Each user gets at most one notification per message, a mention wins over a keyword; the author is never notified.
+func (repo *NotificationRepository) CreateForMessage(ctx context.Context, msg Message, mentionedUserIDs []int) ([]Notification, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        INSERT INTO notifications (user_id, chatroom_id, message_id, actor_id, kind, keyword)
+        SELECT DISTINCT ON (user_id) user_id, $1, $2, $3, kind, keyword
+        FROM (
+            SELECT id AS user_id, 'mention' AS kind, NULL::text AS keyword, 0 AS priority
+            FROM users
+            WHERE id = ANY($5)
+            UNION ALL
+            SELECT k.user_id, 'keyword', k.keyword, 1
+            FROM notification_keywords k
+            JOIN chatroom_members m ON m.user_id = k.user_id AND m.chatroom_id = $1
+            WHERE lower($4) ~ ('\m' || k.keyword || '\M')
+        ) candidates
+        WHERE user_id <> $3
+        ORDER BY user_id, priority, keyword
+        ON CONFLICT (user_id, message_id) DO NOTHING
+        RETURNING id, user_id, kind, keyword, created_at
+    `, msg.ChatroomID, msg.ID, msg.UserID, msg.Content, pq.Array(mentionedUserIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		notification := Notification{
+			ChatroomID: msg.ChatroomID,
+			MessageID:  msg.ID,
+			ActorID:    msg.UserID,
+			Content:    msg.Content,
+		}
+		var keyword sql.NullString
+		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Kind, &keyword, &notification.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notification.Keyword = keyword.String
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// ListNotifications returns the user's notifications, newest first.
+// They are paginated by ID: pass the last ID of the previous page as beforeID (0 for the first page).
+func (repo *NotificationRepository) ListNotifications(ctx context.Context, userID int, unreadOnly bool, beforeID, limit int) ([]Notification, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT n.id, n.user_id, n.chatroom_id, n.message_id, n.actor_id, n.kind, n.keyword, m.content, n.created_at, n.read_at
+        FROM notifications n
+        JOIN messages m ON m.id = n.message_id
+        WHERE n.user_id = $1 AND ($2 = 0 OR n.id < $2) AND (NOT $3 OR n.read_at IS NULL)
+        ORDER BY n.id DESC
+        LIMIT $4
+    `, userID, beforeID, unreadOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		var keyword sql.NullString
+		var readAt sql.NullTime
+		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.ChatroomID, &notification.MessageID, &notification.ActorID,
+			&notification.Kind, &keyword, &notification.Content, &notification.CreatedAt, &readAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notification.Keyword = keyword.String
+		if readAt.Valid {
+			notification.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (repo *NotificationRepository) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM notifications
+        WHERE user_id = $1 AND read_at IS NULL
+    `, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks the given notifications of the user as read, or all of them when ids is empty.
+// It returns how many notifications were unread before.
+func (repo *NotificationRepository) MarkRead(ctx context.Context, userID int, ids []int) (int, error) {
+	if ids == nil {
+		ids = []int{}
+	}
+
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE notifications
+        SET read_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::int[]) = 0 OR id = ANY($2))
+    `, userID, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+
+	return int(affected), nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeKeywords(t *testing.T) {
+	keywords, err := NormalizeKeywords([]string{" Deploy ", "deploy", "on-call", "café"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deploy", "on-call", "café"}, keywords)
+
+	for _, invalid := range []string{"a", "two words", "dot.ted", "(group)"} {
+		_, err = NormalizeKeywords([]string{invalid})
+		assert.ErrorIs(t, err, ErrInvalidKeyword, invalid)
+	}
+
+	_, err = NormalizeKeywords(make([]string, MaxKeywordsPerUser+1))
+	assert.ErrorIs(t, err, ErrInvalidKeyword)
+}
+
+func TestNotificationRepository_SetKeywords(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewNotificationRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM notification_keywords WHERE user_id = \\$1").
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO notification_keywords \\(user_id, keyword\\) SELECT \\$1, unnest\\(\\$2::text\\[\\]\\)").
+		WithArgs(4, pq.Array([]string{"deploy", "outage"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.SetKeywords(context.Background(), 4, []string{"deploy", "outage"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationRepository_CreateForMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewNotificationRepository(db)
+
+	msg := Message{ID: 12, ChatroomID: 1, UserID: 2, Content: "@alice the deploy is done"}
+	timestamp := time.Now()
+
+	mock.ExpectQuery("INSERT INTO notifications \\(user_id, chatroom_id, message_id, actor_id, kind, keyword\\) SELECT DISTINCT ON \\(user_id\\)").
+		WithArgs(1, 12, 2, msg.Content, pq.Array([]int{7})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "kind", "keyword", "created_at"}).
+			AddRow(30, 7, NotificationMention, nil, timestamp).
+			AddRow(31, 9, NotificationKeyword, "deploy", timestamp))
+
+	notifications, err := repo.CreateForMessage(context.Background(), msg, []int{7})
+	assert.NoError(t, err)
+	assert.Equal(t, []Notification{
+		{ID: 30, UserID: 7, ChatroomID: 1, MessageID: 12, ActorID: 2, Kind: NotificationMention, Content: msg.Content, CreatedAt: timestamp},
+		{ID: 31, UserID: 9, ChatroomID: 1, MessageID: 12, ActorID: 2, Kind: NotificationKeyword, Keyword: "deploy", Content: msg.Content, CreatedAt: timestamp},
+	}, notifications)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationRepository_ListNotifications(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewNotificationRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM notifications n JOIN messages m ON m.id = n.message_id WHERE n.user_id = \\$1").
+		WithArgs(7, 40, true, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "chatroom_id", "message_id", "actor_id", "kind", "keyword", "content", "created_at", "read_at"}).
+			AddRow(31, 7, 1, 12, 2, NotificationKeyword, "deploy", "the deploy is done", timestamp, nil))
+
+	notifications, err := repo.ListNotifications(context.Background(), 7, true, 40, 20)
+	assert.NoError(t, err)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, "deploy", notifications[0].Keyword)
+	assert.Nil(t, notifications[0].ReadAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotificationRepository_MarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewNotificationRepository(db)
+
+	mock.ExpectExec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = \\$1 AND read_at IS NULL").
+		WithArgs(7, pq.Array([]int{31})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE notifications SET read_at").
+		WithArgs(7, pq.Array([]int{})).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	marked, err := repo.MarkRead(context.Background(), 7, []int{31})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	marked, err = repo.MarkRead(context.Background(), 7, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, marked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+const maxEmojiLength = 64
+
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// ReactionSummary is the aggregated view of one emoji on a message, as seen by a given user
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+type ReactionRepository struct {
+	db *sql.DB
+}
+
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+// ValidateEmoji accepts a single emoji or a ':shortcode:', anything printable without whitespace up to maxEmojiLength bytes
+func ValidateEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return ErrInvalidEmoji
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return ErrInvalidEmoji
+		}
+	}
+	return nil
+}
+
+// AddReaction adds the user's reaction to a message of the given chatroom and returns the new count for that emoji.
+// Reacting twice with the same emoji is a no-op.
+func (repo *ReactionRepository) AddReaction(ctx context.Context, chatroomID, messageID, userID int, emoji string) (int, error) {
+	if err := ValidateEmoji(emoji); err != nil {
+		return 0, err
+	}
+
+	if err := repo.ensureMessageInChatroom(ctx, chatroomID, messageID); err != nil {
+		return 0, err
+	}
+
+	_, err := repo.db.ExecContext(ctx, `
+        INSERT INTO message_reactions (message_id, user_id, emoji)
+        VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING
+    `, messageID, userID, emoji)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	return repo.countReactions(ctx, messageID, emoji)
+}
+
+// RemoveReaction removes the user's reaction from a message of the given chatroom and returns the new count for that emoji
+func (repo *ReactionRepository) RemoveReaction(ctx context.Context, chatroomID, messageID, userID int, emoji string) (int, error) {
+	if err := ValidateEmoji(emoji); err != nil {
+		return 0, err
+	}
+
+	if err := repo.ensureMessageInChatroom(ctx, chatroomID, messageID); err != nil {
+		return 0, err
+	}
+
+	_, err := repo.db.ExecContext(ctx, `
+        DELETE FROM message_reactions
+        WHERE message_id = $1 AND user_id = $2 AND emoji = $3
+    `, messageID, userID, emoji)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	return repo.countReactions(ctx, messageID, emoji)
+}
+
+func (repo *ReactionRepository) ensureMessageInChatroom(ctx context.Context, chatroomID, messageID int) error {
+	var exists bool
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1 AND chatroom_id = $2)
+    `, messageID, chatroomID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to fetch message: %w", err)
+	}
+	if !exists {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+func (repo *ReactionRepository) countReactions(ctx context.Context, messageID int, emoji string) (int, error) {
+	var count int
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM message_reactions
+        WHERE message_id = $1 AND emoji = $2
+    `, messageID, emoji).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return count, nil
+}
+
+// summarizeReactions aggregates the reactions of the given messages, keyed by message ID, in the order each emoji was first used
+func summarizeReactions(ctx context.Context, db *sql.DB, messageIDs []int, viewerID int) (map[int][]ReactionSummary, error) {
+	summaries := make(map[int][]ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+        SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+        FROM message_reactions
+        WHERE message_id = ANY($1)
+        GROUP BY message_id, emoji
+        ORDER BY message_id, MIN(created_at)
+    `, pq.Array(messageIDs), viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var summary ReactionSummary
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.ReactedByMe); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		summaries[messageID] = append(summaries[messageID], summary)
+	}
+
+	return summaries, nil
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEmoji(t *testing.T) {
+	assert.NoError(t, ValidateEmoji("👍"))
+	assert.NoError(t, ValidateEmoji(":thumbsup:"))
+	assert.ErrorIs(t, ValidateEmoji(""), ErrInvalidEmoji)
+	assert.ErrorIs(t, ValidateEmoji("thumbs up"), ErrInvalidEmoji)
+	assert.ErrorIs(t, ValidateEmoji("\x00"), ErrInvalidEmoji)
+	assert.ErrorIs(t, ValidateEmoji(string(make([]byte, maxEmojiLength+1))), ErrInvalidEmoji)
+}
+
+func TestReactionRepository_AddReaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReactionRepository(db)
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM messages WHERE id = \\$1 AND chatroom_id = \\$2\\)").
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("INSERT INTO message_reactions \\(message_id, user_id, emoji\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT DO NOTHING").
+		WithArgs(10, 2, "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reactions WHERE message_id = \\$1 AND emoji = \\$2").
+		WithArgs(10, "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	count, err := repo.AddReaction(context.Background(), 1, 10, 2, "👍")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReactionRepository_AddReaction_MessageNotInChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReactionRepository(db)
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(10, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	_, err = repo.AddReaction(context.Background(), 2, 10, 2, "👍")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReactionRepository_RemoveReaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReactionRepository(db)
+
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("DELETE FROM message_reactions WHERE message_id = \\$1 AND user_id = \\$2 AND emoji = \\$3").
+		WithArgs(10, 2, "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM message_reactions").
+		WithArgs(10, "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	count, err := repo.RemoveReaction(context.Background(), 1, 10, 2, "👍")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ReadState is the last message a user has read in a chatroom
+type ReadState struct {
+	UserID            int       `json:"user_id"`
+	ChatroomID        int       `json:"chatroom_id"`
+	LastReadMessageID int       `json:"last_read_message_id"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+type ReadStateRepository struct {
+	db *sql.DB
+}
+
+func NewReadStateRepository(db *sql.DB) *ReadStateRepository {
+	return &ReadStateRepository{db: db}
+}
+
+// MarkRead moves the user's read marker in the chatroom forward to messageID, it never moves backwards,
+// so the returned state may point past messageID when a newer message was already marked as read.
+func (repo *ReadStateRepository) MarkRead(ctx context.Context, userID, chatroomID, messageID int) (ReadState, error) {
+	state := ReadState{UserID: userID, ChatroomID: chatroomID}
+
+	err := repo.db.QueryRowContext(ctx, `
+        INSERT INTO room_read_state (user_id, chatroom_id, last_read_message_id)
+        SELECT $1, chatroom_id, id
+        FROM messages
+        WHERE id = $3 AND chatroom_id = $2
+        ON CONFLICT (user_id, chatroom_id) DO UPDATE
+        SET last_read_message_id = GREATEST(room_read_state.last_read_message_id, EXCLUDED.last_read_message_id),
+            updated_at = CURRENT_TIMESTAMP
+        RETURNING last_read_message_id, updated_at
+    `, userID, chatroomID, messageID).Scan(&state.LastReadMessageID, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ReadState{}, ErrMessageNotFound
+	} else if err != nil {
+		return ReadState{}, fmt.Errorf("failed to update read state: %w", err)
+	}
+
+	return state, nil
+}
+
+// ListReadStates returns the read marker of every user who has read something in the chatroom
+func (repo *ReadStateRepository) ListReadStates(ctx context.Context, chatroomID int) ([]ReadState, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT user_id, chatroom_id, last_read_message_id, updated_at
+        FROM room_read_state
+        WHERE chatroom_id = $1
+        ORDER BY user_id
+    `, chatroomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch read states: %w", err)
+	}
+	defer rows.Close()
+
+	var states []ReadState
+	for rows.Next() {
+		var state ReadState
+		if err := rows.Scan(&state.UserID, &state.ChatroomID, &state.LastReadMessageID, &state.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan read state: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
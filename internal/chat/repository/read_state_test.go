@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStateRepository_MarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReadStateRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("INSERT INTO room_read_state \\(user_id, chatroom_id, last_read_message_id\\) SELECT \\$1, chatroom_id, id FROM messages WHERE id = \\$3 AND chatroom_id = \\$2 ON CONFLICT \\(user_id, chatroom_id\\) DO UPDATE").
+		WithArgs(2, 1, 15).
+		WillReturnRows(sqlmock.NewRows([]string{"last_read_message_id", "updated_at"}).AddRow(20, timestamp))
+
+	state, err := repo.MarkRead(context.Background(), 2, 1, 15)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, state.LastReadMessageID)
+	assert.Equal(t, timestamp, state.UpdatedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadStateRepository_MarkRead_MessageNotInChatroom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReadStateRepository(db)
+
+	mock.ExpectQuery("INSERT INTO room_read_state").
+		WithArgs(2, 1, 99).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.MarkRead(context.Background(), 2, 1, 99)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadStateRepository_ListReadStates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewReadStateRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("SELECT user_id, chatroom_id, last_read_message_id, updated_at FROM room_read_state WHERE chatroom_id = \\$1 ORDER BY user_id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "chatroom_id", "last_read_message_id", "updated_at"}).
+			AddRow(2, 1, 20, timestamp).
+			AddRow(3, 1, 18, timestamp))
+
+	states, err := repo.ListReadStates(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, 18, states[1].LastReadMessageID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
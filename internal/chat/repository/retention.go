@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidRetention = errors.New("retention keeps messages either for a number of days or up to a number of messages")
+
+// RetentionPolicy says how long a chatroom keeps its messages, forever when neither limit is set.
+// Threads expire as a whole: with Days once their root and their last reply are older than that, with Messages once
+// the room has that many newer root messages.
+type RetentionPolicy struct {
+	Days     *int `json:"days,omitempty"`
+	Messages *int `json:"messages,omitempty"`
+}
+
+func (p RetentionPolicy) Forever() bool {
+	return p.Days == nil && p.Messages == nil
+}
+
+func (p RetentionPolicy) Validate() error {
+	if (p.Days != nil && *p.Days <= 0) || (p.Messages != nil && *p.Messages <= 0) || (p.Days != nil && p.Messages != nil) {
+		return ErrInvalidRetention
+	}
+	return nil
+}
+
+// RoomRetention is the retention state of a chatroom
+type RoomRetention struct {
+	ChatroomID  int             `json:"chatroom_id"`
+	Policy      RetentionPolicy `json:"policy"`
+	LegalHoldAt *time.Time      `json:"legal_hold_at,omitempty"`
+}
+
+// PurgeResult is what one purge batch removed. BlobKeys are the attachment files to delete from storage, they are
+// only set when the messages were deleted rather than archived.
+type PurgeResult struct {
+	Messages int
+	BlobKeys []string
+}
+
+type RetentionRepository struct {
+	db *sql.DB
+}
+
+func NewRetentionRepository(db *sql.DB) *RetentionRepository {
+	return &RetentionRepository{db: db}
+}
+
+func (repo *RetentionRepository) GetRetention(ctx context.Context, chatroomID int) (RoomRetention, error) {
+	retention := RoomRetention{ChatroomID: chatroomID}
+	var days, messages sql.NullInt64
+	var legalHoldAt sql.NullTime
+	err := repo.db.QueryRowContext(ctx, `
+        SELECT retention_days, retention_messages, legal_hold_at FROM chatrooms WHERE id = $1
+    `, chatroomID).Scan(&days, &messages, &legalHoldAt)
+	if err == sql.ErrNoRows {
+		return RoomRetention{}, ErrChatroomNotFound
+	} else if err != nil {
+		return RoomRetention{}, fmt.Errorf("failed to fetch retention: %w", err)
+	}
+
+	retention.Policy = policyFromColumns(days, messages)
+	if legalHoldAt.Valid {
+		retention.LegalHoldAt = &legalHoldAt.Time
+	}
+	return retention, nil
+}
+
+func (repo *RetentionRepository) SetPolicy(ctx context.Context, chatroomID int, policy RetentionPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE chatrooms SET retention_days = $2, retention_messages = $3 WHERE id = $1
+    `, chatroomID, nullableInt(policy.Days), nullableInt(policy.Messages))
+	if err != nil {
+		return fmt.Errorf("failed to set retention: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set retention: %w", err)
+	}
+	if affected == 0 {
+		return ErrChatroomNotFound
+	}
+
+	return nil
+}
+
+// SetLegalHold places the chatroom under legal hold, which exempts it from purging, or lifts the hold
+func (repo *RetentionRepository) SetLegalHold(ctx context.Context, chatroomID int, held bool) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE chatrooms
+        SET legal_hold_at = CASE WHEN $2 THEN COALESCE(legal_hold_at, CURRENT_TIMESTAMP) END
+        WHERE id = $1
+    `, chatroomID, held)
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set legal hold: %w", err)
+	}
+	if affected == 0 {
+		return ErrChatroomNotFound
+	}
+
+	return nil
+}
+
+// ListPurgeable returns the chatrooms the janitor has to look at: those with a retention limit and no legal hold
+func (repo *RetentionRepository) ListPurgeable(ctx context.Context) ([]int, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT id FROM chatrooms
+        WHERE (retention_days IS NOT NULL OR retention_messages IS NOT NULL) AND legal_hold_at IS NULL
+        ORDER BY id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chatrooms with retention: %w", err)
+	}
+	defer rows.Close()
+
+	var chatroomIDs []int
+	for rows.Next() {
+		var chatroomID int
+		if err := rows.Scan(&chatroomID); err != nil {
+			return nil, fmt.Errorf("failed to scan chatroom: %w", err)
+		}
+		chatroomIDs = append(chatroomIDs, chatroomID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list chatrooms with retention: %w", err)
+	}
+
+	return chatroomIDs, nil
+}
+
+// PurgeBatch removes up to limit expired threads of the chatroom, moving them to archived_messages when archive is
+// set. The chatroom row stays locked for the batch, so a legal hold placed meanwhile is honoured before anything goes.
+func (repo *RetentionRepository) PurgeBatch(ctx context.Context, chatroomID, limit int, archive bool) (PurgeResult, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var days, messages sql.NullInt64
+	var held bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT retention_days, retention_messages, legal_hold_at IS NOT NULL FROM chatrooms WHERE id = $1 FOR UPDATE
+    `, chatroomID).Scan(&days, &messages, &held)
+	if err == sql.ErrNoRows {
+		return PurgeResult{}, ErrChatroomNotFound
+	} else if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to fetch retention: %w", err)
+	}
+	if held || (!days.Valid && !messages.Valid) {
+		return PurgeResult{}, nil
+	}
+
+	var rows *sql.Rows
+	if days.Valid {
+		rows, err = tx.QueryContext(ctx, `
+        SELECT id FROM messages
+        WHERE chatroom_id = $1 AND parent_id IS NULL
+          AND GREATEST(timestamp, COALESCE(last_reply_at, timestamp)) < CURRENT_TIMESTAMP - make_interval(days => $2)
+        ORDER BY id
+        LIMIT $3
+    `, chatroomID, days.Int64, limit)
+	} else {
+		rows, err = tx.QueryContext(ctx, `
+        SELECT id FROM messages
+        WHERE chatroom_id = $1 AND parent_id IS NULL
+        ORDER BY id DESC
+        OFFSET $2
+        LIMIT $3
+    `, chatroomID, messages.Int64, limit)
+	}
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to find expired messages: %w", err)
+	}
+	var rootIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return PurgeResult{}, fmt.Errorf("failed to scan message: %w", err)
+		}
+		rootIDs = append(rootIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to find expired messages: %w", err)
+	}
+	if len(rootIDs) == 0 {
+		return PurgeResult{}, nil
+	}
+
+	if archive {
+		_, err = tx.ExecContext(ctx, `
+        INSERT INTO archived_messages (id, chatroom_id, user_id, parent_id, content, formatted, attachments, timestamp)
+        SELECT m.id, m.chatroom_id, m.user_id, m.parent_id, m.content, m.formatted,
+               (SELECT jsonb_agg(to_jsonb(a) - 'message_id') FROM attachments a WHERE a.message_id = m.id),
+               m.timestamp
+        FROM messages m
+        WHERE m.id = ANY($1) OR m.parent_id = ANY($1)
+        ON CONFLICT (id) DO NOTHING
+    `, pq.Array(rootIDs))
+		if err != nil {
+			return PurgeResult{}, fmt.Errorf("failed to archive messages: %w", err)
+		}
+	}
+
+	blobKeys, err := deleteMessageAttachments(ctx, tx, `
+            SELECT id FROM messages WHERE id = ANY($1) OR parent_id = ANY($1)
+        `, pq.Array(rootIDs))
+	if err != nil {
+		return PurgeResult{}, err
+	}
+	var result PurgeResult
+	if !archive {
+		result.BlobKeys = blobKeys
+	}
+
+	deleted, err := tx.ExecContext(ctx, `
+        DELETE FROM messages WHERE id = ANY($1) OR parent_id = ANY($1)
+    `, pq.Array(rootIDs))
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to delete messages: %w", err)
+	}
+	affected, err := deleted.RowsAffected()
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to delete messages: %w", err)
+	}
+	result.Messages = int(affected)
+
+	if err := tx.Commit(); err != nil {
+		return PurgeResult{}, fmt.Errorf("failed to commit purge: %w", err)
+	}
+
+	return result, nil
+}
+
+func policyFromColumns(days, messages sql.NullInt64) RetentionPolicy {
+	var policy RetentionPolicy
+	if days.Valid {
+		value := int(days.Int64)
+		policy.Days = &value
+	}
+	if messages.Valid {
+		value := int(messages.Int64)
+		policy.Messages = &value
+	}
+	return policy
+}
+
+func nullableInt(value *int) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionRepository_SetPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRetentionRepository(db)
+	days, messages := 30, 0
+
+	mock.ExpectExec("UPDATE chatrooms SET retention_days = \\$2, retention_messages = \\$3 WHERE id = \\$1").
+		WithArgs(1, 30, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.SetPolicy(context.Background(), 1, RetentionPolicy{Days: &days}))
+
+	mock.ExpectExec("UPDATE chatrooms SET retention_days").
+		WithArgs(2, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.SetPolicy(context.Background(), 2, RetentionPolicy{}), ErrChatroomNotFound)
+
+	assert.ErrorIs(t, repo.SetPolicy(context.Background(), 1, RetentionPolicy{Messages: &messages}), ErrInvalidRetention)
+	assert.ErrorIs(t, repo.SetPolicy(context.Background(), 1, RetentionPolicy{Days: &days, Messages: &days}), ErrInvalidRetention)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionRepository_SetLegalHold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRetentionRepository(db)
+
+	mock.ExpectExec("UPDATE chatrooms\\s+SET legal_hold_at = CASE WHEN \\$2 THEN COALESCE\\(legal_hold_at, CURRENT_TIMESTAMP\\) END").
+		WithArgs(1, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.SetLegalHold(context.Background(), 1, true))
+
+	mock.ExpectExec("UPDATE chatrooms\\s+SET legal_hold_at").
+		WithArgs(9, false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.SetLegalHold(context.Background(), 9, false), ErrChatroomNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionRepository_PurgeBatch_LegalHold(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRetentionRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT retention_days, retention_messages, legal_hold_at IS NOT NULL FROM chatrooms WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"retention_days", "retention_messages", "held"}).AddRow(30, nil, true))
+	mock.ExpectRollback()
+
+	result, err := repo.PurgeBatch(context.Background(), 1, 100, false)
+	assert.NoError(t, err)
+	assert.Equal(t, PurgeResult{}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionRepository_PurgeBatch_Delete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRetentionRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT retention_days, retention_messages, legal_hold_at IS NOT NULL FROM chatrooms").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"retention_days", "retention_messages", "held"}).AddRow(nil, 50, false))
+	mock.ExpectQuery("SELECT id FROM messages\\s+WHERE chatroom_id = \\$1 AND parent_id IS NULL\\s+ORDER BY id DESC\\s+OFFSET \\$2").
+		WithArgs(1, int64(50), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4).AddRow(3))
+	mock.ExpectQuery("DELETE FROM attachments").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key", "thumbnail_key"}).
+			AddRow("a.png", "a_thumb.png").
+			AddRow("b.pdf", nil))
+	mock.ExpectExec("DELETE FROM messages WHERE id = ANY\\(\\$1\\) OR parent_id = ANY\\(\\$1\\)").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectCommit()
+
+	result, err := repo.PurgeBatch(context.Background(), 1, 100, false)
+	assert.NoError(t, err)
+	assert.Equal(t, PurgeResult{Messages: 5, BlobKeys: []string{"a.png", "a_thumb.png", "b.pdf"}}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetentionRepository_PurgeBatch_Archive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRetentionRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT retention_days, retention_messages, legal_hold_at IS NOT NULL FROM chatrooms").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"retention_days", "retention_messages", "held"}).AddRow(7, nil, false))
+	mock.ExpectQuery("make_interval\\(days => \\$2\\)").
+		WithArgs(1, int64(7), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("INSERT INTO archived_messages").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("DELETE FROM attachments").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"storage_key", "thumbnail_key"}).AddRow("a.png", nil))
+	mock.ExpectExec("DELETE FROM messages").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	result, err := repo.PurgeBatch(context.Background(), 1, 100, true)
+	assert.NoError(t, err)
+	assert.Equal(t, PurgeResult{Messages: 2}, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
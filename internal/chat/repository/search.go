@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Markers handed to ts_headline, they are swapped for <mark> tags once the snippet has been HTML escaped
+const (
+	highlightStart  = "\x02"
+	highlightStop   = "\x03"
+	headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// SearchQuery describes a full-text search over the messages of the rooms UserID has joined.
+// Zero values disable the optional filters, Before is the cursor returned by the previous page.
+type SearchQuery struct {
+	UserID     int
+	Text       string
+	ChatroomID int
+	AuthorID   int
+	From       *time.Time
+	To         *time.Time
+	Before     int
+	Limit      int
+}
+
+type SearchResult struct {
+	MessageID  int       `json:"message_id"`
+	ChatroomID int       `json:"chatroom_id"`
+	UserID     int       `json:"user_id"`
+	ParentID   *int      `json:"parent_id,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Snippet    string    `json:"snippet"`
+}
+
+// SearchMessages returns matching messages newest first, with an HTML-safe snippet where matches are wrapped in <mark>
+func (repo *MessageRepository) SearchMessages(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	args := []interface{}{query.UserID, query.Text, headlineOptions}
+	conditions := []string{"m.content_tsv @@ q.query"}
+
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if query.ChatroomID > 0 {
+		addCondition("m.chatroom_id = $%d", query.ChatroomID)
+	}
+	if query.AuthorID > 0 {
+		addCondition("m.user_id = $%d", query.AuthorID)
+	}
+	if query.From != nil {
+		addCondition("m.timestamp >= $%d", *query.From)
+	}
+	if query.To != nil {
+		addCondition("m.timestamp < $%d", *query.To)
+	}
+	if query.Before > 0 {
+		addCondition("m.id < $%d", query.Before)
+	}
+	args = append(args, query.Limit)
+
+	rows, err := repo.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT m.id, m.chatroom_id, m.user_id, m.parent_id, m.timestamp,
+            ts_headline('english', m.content, q.query, $3)
+        FROM messages m
+        JOIN chatroom_members cm ON cm.chatroom_id = m.chatroom_id AND cm.user_id = $1
+        CROSS JOIN websearch_to_tsquery('english', $2) AS q(query)
+        WHERE %s
+        ORDER BY m.id DESC
+        LIMIT $%d
+    `, strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var parentID sql.NullInt64
+		if err := rows.Scan(&result.MessageID, &result.ChatroomID, &result.UserID, &parentID, &result.Timestamp, &result.Snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			result.ParentID = &id
+		}
+		result.Snippet = highlightSnippet(result.Snippet)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, highlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, highlightStop, "</mark>")
+}
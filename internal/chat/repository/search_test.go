@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRepository_SearchMessages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewMessageRepository(db)
+
+	timestamp := time.Now()
+	from := timestamp.Add(-24 * time.Hour)
+
+	mock.ExpectQuery("SELECT m.id, m.chatroom_id, m.user_id, m.parent_id, m.timestamp, ts_headline\\('english', m.content, q.query, \\$3\\) "+
+		"FROM messages m JOIN chatroom_members cm ON cm.chatroom_id = m.chatroom_id AND cm.user_id = \\$1 "+
+		"CROSS JOIN websearch_to_tsquery\\('english', \\$2\\) AS q\\(query\\) "+
+		"WHERE m.content_tsv @@ q.query AND m.chatroom_id = \\$4 AND m.timestamp >= \\$5 AND m.id < \\$6 "+
+		"ORDER BY m.id DESC LIMIT \\$7").
+		WithArgs(3, "stock price", headlineOptions, 1, from, 100, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "user_id", "parent_id", "timestamp", "ts_headline"}).
+			AddRow(42, 1, 2, nil, timestamp, "the \x02stock\x03 <b>price</b>").
+			AddRow(40, 1, 2, 38, timestamp, "\x02price\x03 went up"))
+
+	results, err := repo.SearchMessages(context.Background(), SearchQuery{
+		UserID:     3,
+		Text:       "stock price",
+		ChatroomID: 1,
+		From:       &from,
+		Before:     100,
+		Limit:      20,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 42, results[0].MessageID)
+	assert.Equal(t, "the <mark>stock</mark> &lt;b&gt;price&lt;/b&gt;", results[0].Snippet)
+	assert.Nil(t, results[0].ParentID)
+	assert.Equal(t, 38, *results[1].ParentID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
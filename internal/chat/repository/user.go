@@ -1,13 +1,62 @@
 package repository
 
 import (
+	"chat-app/internal/auth"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUsernameTaken is returned when another user has the same username, ignoring case
+var ErrUsernameTaken = errors.New("username is already taken")
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrSessionRevoked  = errors.New("session was revoked")
+)
+
+// Global roles, every user has exactly one
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is an account as administrators see it
+type User struct {
+	ID         int        `json:"id"`
+	Username   string     `json:"username"`
+	Role       string     `json:"role"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// UserQuery filters ListUsers. Search matches part of the username, results are ordered by ID and paginated with After.
+type UserQuery struct {
+	Search string
+	After  int
+	Limit  int
+}
+
+// ErrInvalidCredentials is returned for unknown usernames and wrong passwords alike, so callers cannot tell them apart
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyHash is compared against when the user does not exist, so the response takes as long as for a wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 type UserRepository struct {
 	DB *sql.DB
 }
@@ -26,7 +75,10 @@ func (repo *UserRepository) Register(ctx context.Context, username, password str
         INSERT INTO Users (username, hashed_password)
         VALUES ($1, $2)
     `, username, string(hashedPassword))
-	if err != nil {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrUsernameTaken
+	} else if err != nil {
 		return fmt.Errorf("failed to register user: %w", err)
 	}
 
@@ -39,39 +91,267 @@ func (repo *UserRepository) Login(ctx context.Context, username, password string
 	err := repo.DB.QueryRowContext(ctx, `
         SELECT hashed_password
         FROM Users
-        WHERE username = $1
+        WHERE lower(username) = lower($1)
     `, username).Scan(&hashedPassword)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("user does not exist")
-	} else if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		return fmt.Errorf("database error: %w", err)
 	}
 
+	return checkPassword(hashedPassword, password)
+}
+
+// Authenticate matches usernames case-insensitively, like their uniqueness and the login lockout. It returns the
+// user's ID and the username as stored, whatever spelling was typed.
+func (repo *UserRepository) Authenticate(ctx context.Context, username, password string) (int, string, error) {
+	var hashedPassword, storedUsername string
+	var userID int
+
+	err := repo.DB.QueryRowContext(ctx, `
+        SELECT id, username, hashed_password
+        FROM users
+        WHERE lower(username) = lower($1)
+    `, username).Scan(&userID, &storedUsername, &hashedPassword)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, "", fmt.Errorf("database error: %w", err)
+	}
+
+	if err := checkPassword(hashedPassword, password); err != nil {
+		return 0, "", err
+	}
+
+	return userID, storedUsername, nil
+}
+
+// checkPassword always runs bcrypt, also for unknown users and bot users without a password
+func checkPassword(hashedPassword, password string) error {
+	if hashedPassword == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return ErrInvalidCredentials
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
-		return fmt.Errorf("invalid password")
+		return ErrInvalidCredentials
 	}
 
 	return nil
 }
 
-func (repo *UserRepository) Authenticate(ctx context.Context, username, password string) (int, error) {
-	var hashedPassword string
-	var userID int
+func (repo *UserRepository) GetUsername(ctx context.Context, userID int) (string, error) {
+	var username string
+	err := repo.DB.QueryRowContext(ctx, `
+        SELECT username
+        FROM users
+        WHERE id = $1
+    `, userID).Scan(&username)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch username: %w", err)
+	}
+
+	return username, nil
+}
 
+// IsAdmin reports whether the user has the admin role, disabled administrators have none
+func (repo *UserRepository) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	var isAdmin bool
 	err := repo.DB.QueryRowContext(ctx, `
-        SELECT id, hashed_password
+        SELECT role = 'admin' AND disabled_at IS NULL
         FROM users
-        WHERE username = $1
-    `, username).Scan(&userID, &hashedPassword)
+        WHERE id = $1
+    `, userID).Scan(&isAdmin)
 	if err == sql.ErrNoRows {
-		return 0, fmt.Errorf("user does not exist")
+		return false, nil
 	} else if err != nil {
-		return 0, fmt.Errorf("database error: %w", err)
+		return false, fmt.Errorf("failed to check admin role: %w", err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
-		return 0, fmt.Errorf("invalid password")
+	return isAdmin, nil
+}
+
+// CheckSession returns ErrAccountDisabled for disabled or unknown users, and ErrSessionRevoked when the session was
+// issued before the user's sessions were revoked. A zero issuedAt only checks the account.
+func (repo *UserRepository) CheckSession(ctx context.Context, userID int, issuedAt time.Time) error {
+	var issued sql.NullInt64
+	if !issuedAt.IsZero() {
+		issued = sql.NullInt64{Int64: issuedAt.Unix(), Valid: true}
+	}
+
+	// Tokens carry whole seconds, a session issued within the second of the revocation is kept
+	var disabled, revoked bool
+	err := repo.DB.QueryRowContext(ctx, `
+        SELECT disabled_at IS NOT NULL,
+            COALESCE(date_trunc('second', sessions_revoked_at) > to_timestamp($2::bigint), FALSE)
+        FROM users
+        WHERE id = $1
+    `, userID, issued).Scan(&disabled, &revoked)
+	if err == sql.ErrNoRows {
+		return ErrAccountDisabled
+	} else if err != nil {
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+
+	if disabled {
+		return ErrAccountDisabled
+	}
+	if revoked {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// SessionCheck is CheckSession with the errors package auth expects, the session check of every authenticated request
+// on both servers, see auth.UseSessionCheck
+func (repo *UserRepository) SessionCheck(ctx context.Context, userID int, issuedAt time.Time) error {
+	err := repo.CheckSession(ctx, userID, issuedAt)
+	switch {
+	case errors.Is(err, ErrAccountDisabled):
+		return auth.ErrAccountDisabled
+	case errors.Is(err, ErrSessionRevoked):
+		return auth.ErrSessionRevoked
+	}
+	return err
+}
+
+// ListUsers returns the users matching the query, the search ignores case
+func (repo *UserRepository) ListUsers(ctx context.Context, query UserQuery) ([]User, error) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(query.Search)) + "%"
+
+	rows, err := repo.DB.QueryContext(ctx, `
+        SELECT id, username, role, created_at, disabled_at
+        FROM users
+        WHERE lower(username) LIKE $1 AND id > $2
+        ORDER BY id
+        LIMIT $3
+    `, pattern, query.After, query.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		var disabledAt sql.NullTime
+		if err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt, &disabledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if disabledAt.Valid {
+			user.DisabledAt = &disabledAt.Time
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// likeEscaper makes user input match literally in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (repo *UserRepository) SetRole(ctx context.Context, userID int, role string) error {
+	result, err := repo.DB.ExecContext(ctx, `
+        UPDATE users
+        SET role = $2
+        WHERE id = $1
+    `, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to set role: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set role: %w", err)
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetDisabled disables or re-enables the account. Disabling also revokes every session of the user.
+func (repo *UserRepository) SetDisabled(ctx context.Context, userID int, disabled bool) error {
+	result, err := repo.DB.ExecContext(ctx, `
+        UPDATE users
+        SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, CURRENT_TIMESTAMP) END,
+            sessions_revoked_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP ELSE sessions_revoked_at END
+        WHERE id = $1
+    `, userID, disabled)
+	if err != nil {
+		return fmt.Errorf("failed to update account: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update account: %w", err)
+	}
+	if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetPassword replaces the user's password and revokes their sessions, the caller validates the password
+func (repo *UserRepository) SetPassword(ctx context.Context, userID int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	result, err := repo.DB.ExecContext(ctx, `
+        UPDATE users
+        SET hashed_password = $2, sessions_revoked_at = CURRENT_TIMESTAMP
+        WHERE id = $1
+    `, userID, string(hashedPassword))
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if affected == 0 {
+		return ErrUserNotFound
 	}
 
-	return userID, nil
+	return nil
+}
+
+// GetUserIDsByUsernames resolves usernames case-insensitively, the result is keyed by lowercase username.
+// Unknown usernames are left out.
+func (repo *UserRepository) GetUserIDsByUsernames(ctx context.Context, usernames []string) (map[string]int, error) {
+	userIDs := make(map[string]int)
+	if len(usernames) == 0 {
+		return userIDs, nil
+	}
+
+	rows, err := repo.DB.QueryContext(ctx, `
+        SELECT DISTINCT ON (lower(username)) lower(username), id
+        FROM users
+        WHERE lower(username) = ANY($1)
+        ORDER BY lower(username), id
+    `, pq.Array(lowercase(usernames)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username string
+		var id int
+		if err := rows.Scan(&username, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		userIDs[username] = id
+	}
+
+	return userIDs, rows.Err()
+}
+
+func lowercase(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, value := range values {
+		lowered[i] = strings.ToLower(value)
+	}
+	return lowered
 }
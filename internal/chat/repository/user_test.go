@@ -1,13 +1,17 @@
 package repository
 
 import (
+	"chat-app/internal/auth"
 	"context"
 	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -33,6 +37,22 @@ func TestUserRepository_Register(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUserRepository_Register_UsernameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec("INSERT INTO Users").
+		WithArgs("Alice", sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	err = repo.Register(context.Background(), "Alice", password)
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserRepository_Login(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
@@ -43,7 +63,7 @@ func TestUserRepository_Login(t *testing.T) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	require.NoError(t, err)
 
-	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE username = \\$1").
+	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE lower\\(username\\) = lower\\(\\$1\\)").
 		WithArgs(username).
 		WillReturnRows(sqlmock.NewRows([]string{"hashed_password"}).AddRow(string(hashedPassword)))
 
@@ -61,12 +81,12 @@ func TestUserRepository_Login_UserDoesNotExist(t *testing.T) {
 
 	username = "nonexistentuser"
 
-	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE username = \\$1").
+	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE lower\\(username\\) = lower\\(\\$1\\)").
 		WithArgs(username).
 		WillReturnError(sql.ErrNoRows)
 
 	err = repo.Login(context.Background(), username, password)
-	assert.EqualError(t, err, "user does not exist")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -80,11 +100,228 @@ func TestUserRepository_Login_InvalidPassword(t *testing.T) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("differentpassword"), bcrypt.DefaultCost)
 	require.NoError(t, err)
 
-	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE username = \\$1").
+	mock.ExpectQuery("SELECT hashed_password FROM Users WHERE lower\\(username\\) = lower\\(\\$1\\)").
 		WithArgs(username).
 		WillReturnRows(sqlmock.NewRows([]string{"hashed_password"}).AddRow(string(hashedPassword)))
 
 	err = repo.Login(context.Background(), username, password)
-	assert.EqualError(t, err, "invalid password")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_Authenticate_SameErrorForUnknownUserAndBot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery("SELECT id, username, hashed_password FROM users WHERE lower\\(username\\) = lower\\(\\$1\\)").
+		WithArgs("ghost").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id, username, hashed_password FROM users WHERE lower\\(username\\) = lower\\(\\$1\\)").
+		WithArgs("deploy-bot").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hashed_password"}).AddRow(9, "deploy-bot", ""))
+
+	_, _, err = repo.Authenticate(context.Background(), "ghost", password)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, _, err = repo.Authenticate(context.Background(), "deploy-bot", "")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_Authenticate_ReturnsStoredUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	mock.ExpectQuery("SELECT id, username, hashed_password FROM users WHERE lower\\(username\\) = lower\\(\\$1\\)").
+		WithArgs("ALICE").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "hashed_password"}).AddRow(3, "Alice", string(hashedPassword)))
+
+	userID, storedUsername, err := repo.Authenticate(context.Background(), "ALICE", password)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, userID)
+	assert.Equal(t, "Alice", storedUsername)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_GetUsername(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery("SELECT username FROM users WHERE id = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("alice"))
+
+	name, err := repo.GetUsername(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_IsAdmin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery("SELECT role = 'admin' AND disabled_at IS NULL FROM users WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"is_admin"}).AddRow(true))
+	mock.ExpectQuery("SELECT role = 'admin' AND disabled_at IS NULL FROM users WHERE id = \\$1").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+
+	isAdmin, err := repo.IsAdmin(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, isAdmin)
+
+	isAdmin, err = repo.IsAdmin(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.False(t, isAdmin)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_CheckSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+	issuedAt := time.Unix(1700000000, 0)
+
+	query := "SELECT disabled_at IS NOT NULL, COALESCE\\(date_trunc\\('second', sessions_revoked_at\\) > to_timestamp\\(\\$2::bigint\\), FALSE\\) FROM users WHERE id = \\$1"
+	mock.ExpectQuery(query).
+		WithArgs(1, int64(1700000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled", "revoked"}).AddRow(false, false))
+	mock.ExpectQuery(query).
+		WithArgs(1, int64(1700000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled", "revoked"}).AddRow(false, true))
+	mock.ExpectQuery(query).
+		WithArgs(2, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled", "revoked"}).AddRow(true, false))
+	mock.ExpectQuery(query).
+		WithArgs(3, nil).
+		WillReturnError(sql.ErrNoRows)
+
+	assert.NoError(t, repo.CheckSession(context.Background(), 1, issuedAt))
+	assert.ErrorIs(t, repo.CheckSession(context.Background(), 1, issuedAt), ErrSessionRevoked)
+	assert.ErrorIs(t, repo.CheckSession(context.Background(), 2, time.Time{}), ErrAccountDisabled)
+	assert.ErrorIs(t, repo.CheckSession(context.Background(), 3, time.Time{}), ErrAccountDisabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_SessionCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	query := "SELECT disabled_at IS NOT NULL, .* FROM users WHERE id = \\$1"
+	mock.ExpectQuery(query).
+		WithArgs(1, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled", "revoked"}).AddRow(false, true))
+	mock.ExpectQuery(query).
+		WithArgs(2, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled", "revoked"}).AddRow(true, false))
+	mock.ExpectQuery(query).
+		WithArgs(3, nil).
+		WillReturnError(errors.New("connection reset"))
+
+	assert.ErrorIs(t, repo.SessionCheck(context.Background(), 1, time.Time{}), auth.ErrSessionRevoked)
+	assert.ErrorIs(t, repo.SessionCheck(context.Background(), 2, time.Time{}), auth.ErrAccountDisabled)
+	err = repo.SessionCheck(context.Background(), 3, time.Time{})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, auth.ErrAccountDisabled)
+	assert.NotErrorIs(t, err, auth.ErrSessionRevoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_ListUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	createdAt := time.Now()
+	mock.ExpectQuery("SELECT id, username, role, created_at, disabled_at FROM users WHERE lower\\(username\\) LIKE \\$1 AND id > \\$2 ORDER BY id LIMIT \\$3").
+		WithArgs(`%al\_ice%`, 10, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "role", "created_at", "disabled_at"}).
+			AddRow(11, "al_ice", RoleAdmin, createdAt, nil).
+			AddRow(12, "Al_Ice2", RoleUser, createdAt, createdAt))
+
+	users, err := repo.ListUsers(context.Background(), UserQuery{Search: "AL_ice", After: 10, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, RoleAdmin, users[0].Role)
+	assert.Nil(t, users[0].DisabledAt)
+	assert.NotNil(t, users[1].DisabledAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_SetDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec("UPDATE users SET disabled_at = .* sessions_revoked_at = .* WHERE id = \\$1").
+		WithArgs(4, true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET disabled_at").
+		WithArgs(5, false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.SetDisabled(context.Background(), 4, true))
+	assert.ErrorIs(t, repo.SetDisabled(context.Background(), 5, false), ErrUserNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_SetPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectExec("UPDATE users SET hashed_password = \\$2, sessions_revoked_at = CURRENT_TIMESTAMP WHERE id = \\$1").
+		WithArgs(4, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.SetPassword(context.Background(), 4, "a new long passphrase"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserRepository_GetUserIDsByUsernames(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewUserRepository(db)
+
+	mock.ExpectQuery("SELECT DISTINCT ON \\(lower\\(username\\)\\) lower\\(username\\), id FROM users WHERE lower\\(username\\) = ANY\\(\\$1\\)").
+		WithArgs(pq.Array([]string{"alice", "ghost"})).
+		WillReturnRows(sqlmock.NewRows([]string{"lower", "id"}).AddRow("alice", 7))
+
+	userIDs, err := repo.GetUserIDsByUsernames(context.Background(), []string{"Alice", "ghost"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 7}, userIDs)
+
+	userIDs, err = repo.GetUserIDsByUsernames(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, userIDs)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
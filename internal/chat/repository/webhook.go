@@ -0,0 +1,356 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is an outgoing subscription of a chatroom's events. Secret is only filled in right after creation,
+// it signs the deliveries and is never listed again.
+type Webhook struct {
+	ID           int        `json:"id"`
+	ChatroomID   int        `json:"chatroom_id"`
+	CreatedBy    int        `json:"created_by"`
+	URL          string     `json:"url"`
+	Secret       string     `json:"secret,omitempty"`
+	Events       []string   `json:"events"`
+	FailureCount int        `json:"failure_count"`
+	DisabledAt   *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	WebhookID      int             `json:"webhook_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// Target of a claimed delivery
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// DeliveryAttempt is the outcome of sending a claimed delivery once.
+// A failed attempt with a zero NextAttemptAt gives the delivery up.
+type DeliveryAttempt struct {
+	DeliveryID     int
+	WebhookID      int
+	Succeeded      bool
+	ResponseStatus int
+	Error          string
+	NextAttemptAt  time.Time
+}
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookColumns = `id, chatroom_id, created_by, url, events, failure_count, disabled_at, created_at`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	var disabledAt sql.NullTime
+	err := row.Scan(&webhook.ID, &webhook.ChatroomID, &webhook.CreatedBy, &webhook.URL, pq.Array(&webhook.Events),
+		&webhook.FailureCount, &disabledAt, &webhook.CreatedAt)
+	if disabledAt.Valid {
+		webhook.DisabledAt = &disabledAt.Time
+	}
+	return webhook, err
+}
+
+func (repo *WebhookRepository) CreateWebhook(ctx context.Context, chatroomID, userID int, url, secret string, events []string) (Webhook, error) {
+	webhook, err := scanWebhook(repo.db.QueryRowContext(ctx, `
+        INSERT INTO webhooks (chatroom_id, created_by, url, secret, events)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING `+webhookColumns,
+		chatroomID, userID, url, secret, pq.Array(events)))
+	if err != nil {
+		return Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	webhook.Secret = secret
+	return webhook, nil
+}
+
+// ListWebhooks returns the outgoing webhooks of the chatroom, only those created by createdBy unless it is 0
+func (repo *WebhookRepository) ListWebhooks(ctx context.Context, chatroomID, createdBy int) ([]Webhook, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT `+webhookColumns+`
+        FROM webhooks
+        WHERE chatroom_id = $1 AND ($2 = 0 OR created_by = $2)
+        ORDER BY id
+    `, chatroomID, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (repo *WebhookRepository) GetWebhook(ctx context.Context, chatroomID, webhookID int) (Webhook, error) {
+	webhook, err := scanWebhook(repo.db.QueryRowContext(ctx, `
+        SELECT `+webhookColumns+`
+        FROM webhooks
+        WHERE id = $1 AND chatroom_id = $2
+    `, webhookID, chatroomID))
+	if err == sql.ErrNoRows {
+		return Webhook{}, ErrWebhookNotFound
+	} else if err != nil {
+		return Webhook{}, fmt.Errorf("failed to fetch webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (repo *WebhookRepository) DeleteWebhook(ctx context.Context, chatroomID, webhookID int) error {
+	result, err := repo.db.ExecContext(ctx, `
+        DELETE FROM webhooks
+        WHERE id = $1 AND chatroom_id = $2
+    `, webhookID, chatroomID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if affected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnableWebhook turns a disabled webhook back on with a clean failure count.
+// Deliveries given up while it was disabled are not retried.
+func (repo *WebhookRepository) EnableWebhook(ctx context.Context, chatroomID, webhookID int) (Webhook, error) {
+	webhook, err := scanWebhook(repo.db.QueryRowContext(ctx, `
+        UPDATE webhooks
+        SET disabled_at = NULL, failure_count = 0
+        WHERE id = $1 AND chatroom_id = $2
+        RETURNING `+webhookColumns,
+		webhookID, chatroomID))
+	if err == sql.ErrNoRows {
+		return Webhook{}, ErrWebhookNotFound
+	} else if err != nil {
+		return Webhook{}, fmt.Errorf("failed to enable webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// EnqueueEvent queues a delivery of the event for every enabled webhook of the chatroom subscribed to it,
+// it returns how many were queued
+func (repo *WebhookRepository) EnqueueEvent(ctx context.Context, chatroomID int, eventType string, payload json.RawMessage) (int, error) {
+	result, err := repo.db.ExecContext(ctx, `
+        INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+        SELECT id, $2, $3
+        FROM webhooks
+        WHERE chatroom_id = $1 AND disabled_at IS NULL AND $2 = ANY(events)
+    `, chatroomID, eventType, []byte(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+
+	return int(affected), nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries that are due, and pushes their next attempt 'lease' into the future
+// so that concurrent dispatchers skip them while they are being sent.
+func (repo *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        UPDATE webhook_deliveries d
+        SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+        FROM webhooks w
+        WHERE w.id = d.webhook_id AND d.id IN (
+            SELECT id FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY next_attempt_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, d.created_at, w.url, w.secret
+    `, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		delivery := WebhookDelivery{Status: DeliveryPending}
+		var payload []byte
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Attempts,
+			&delivery.CreatedAt, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt settles or reschedules a delivery and keeps count of the webhook's consecutive failed attempts.
+// Once the count reaches disableAfter the webhook is disabled and its pending deliveries are given up; it reports whether
+// this attempt is the one that disabled it.
+func (repo *WebhookRepository) RecordAttempt(ctx context.Context, attempt DeliveryAttempt, disableAfter int) (bool, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	status := DeliveryPending
+	var nextAttemptAt interface{} = attempt.NextAttemptAt
+	switch {
+	case attempt.Succeeded:
+		status, nextAttemptAt = DeliverySucceeded, nil
+	case attempt.NextAttemptAt.IsZero():
+		status, nextAttemptAt = DeliveryFailed, nil
+	}
+
+	var responseStatus interface{}
+	if attempt.ResponseStatus != 0 {
+		responseStatus = attempt.ResponseStatus
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $2,
+            attempts = attempts + 1,
+            last_attempt_at = CURRENT_TIMESTAMP,
+            next_attempt_at = COALESCE($3, next_attempt_at),
+            response_status = $4,
+            last_error = NULLIF($5, ''),
+            delivered_at = CASE WHEN $2 = 'succeeded' THEN CURRENT_TIMESTAMP END
+        WHERE id = $1
+    `, attempt.DeliveryID, status, nextAttemptAt, responseStatus, attempt.Error)
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	// Only the attempt that disables the webhook reports it, later attempts find it already disabled
+	var disabled bool
+	err = tx.QueryRowContext(ctx, `
+        UPDATE webhooks w
+        SET failure_count = CASE WHEN $2 THEN 0 ELSE w.failure_count + 1 END,
+            disabled_at = CASE WHEN NOT $2 AND w.disabled_at IS NULL AND w.failure_count + 1 >= $3 THEN CURRENT_TIMESTAMP ELSE w.disabled_at END
+        FROM (SELECT id, disabled_at FROM webhooks WHERE id = $1 FOR UPDATE) previous
+        WHERE w.id = previous.id
+        RETURNING previous.disabled_at IS NULL AND w.disabled_at IS NOT NULL
+    `, attempt.WebhookID, attempt.Succeeded, disableAfter).Scan(&disabled)
+	if err == sql.ErrNoRows {
+		// The webhook was deleted while the delivery was in flight
+		return false, tx.Commit()
+	} else if err != nil {
+		return false, fmt.Errorf("failed to update webhook failure count: %w", err)
+	}
+
+	if disabled {
+		_, err = tx.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = 'failed', last_error = 'webhook disabled after repeated failures'
+        WHERE webhook_id = $1 AND status = 'pending'
+    `, attempt.WebhookID)
+		if err != nil {
+			return false, fmt.Errorf("failed to cancel webhook deliveries: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit webhook delivery: %w", err)
+	}
+
+	return disabled, nil
+}
+
+// ListDeliveries is the delivery log of a webhook, newest first.
+// It is paginated by ID: pass the last ID of the previous page as beforeID (0 for the first page).
+func (repo *WebhookRepository) ListDeliveries(ctx context.Context, chatroomID, webhookID, beforeID, limit int) ([]WebhookDelivery, error) {
+	rows, err := repo.db.QueryContext(ctx, `
+        SELECT d.id, d.webhook_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at, d.last_attempt_at,
+               d.response_status, d.last_error, d.created_at, d.delivered_at
+        FROM webhook_deliveries d
+        JOIN webhooks w ON w.id = d.webhook_id
+        WHERE d.webhook_id = $1 AND w.chatroom_id = $2 AND ($3 = 0 OR d.id < $3)
+        ORDER BY d.id DESC
+        LIMIT $4
+    `, webhookID, chatroomID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload []byte
+		var lastAttemptAt, deliveredAt sql.NullTime
+		var responseStatus sql.NullInt64
+		var lastError sql.NullString
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventType, &payload, &delivery.Status, &delivery.Attempts,
+			&delivery.NextAttemptAt, &lastAttemptAt, &responseStatus, &lastError, &delivery.CreatedAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		delivery.Payload = payload
+		if lastAttemptAt.Valid {
+			delivery.LastAttemptAt = &lastAttemptAt.Time
+		}
+		if responseStatus.Valid {
+			status := int(responseStatus.Int64)
+			delivery.ResponseStatus = &status
+		}
+		delivery.LastError = lastError.String
+		if deliveredAt.Valid {
+			delivery.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
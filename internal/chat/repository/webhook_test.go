@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var webhookRowColumns = []string{"id", "chatroom_id", "created_by", "url", "events", "failure_count", "disabled_at", "created_at"}
+
+func TestWebhookRepository_CreateWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	events := []string{"message.created", "member.joined"}
+	timestamp := time.Now()
+
+	mock.ExpectQuery("INSERT INTO webhooks \\(chatroom_id, created_by, url, secret, events\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5\\) RETURNING id").
+		WithArgs(1, 2, "https://hooks.example.com", "s3cret", pq.Array(events)).
+		WillReturnRows(sqlmock.NewRows(webhookRowColumns).
+			AddRow(4, 1, 2, "https://hooks.example.com", "{message.created,member.joined}", 0, nil, timestamp))
+
+	webhook, err := repo.CreateWebhook(context.Background(), 1, 2, "https://hooks.example.com", "s3cret", events)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, webhook.ID)
+	assert.Equal(t, events, webhook.Events)
+	assert.Equal(t, "s3cret", webhook.Secret)
+	assert.Nil(t, webhook.DisabledAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_EnqueueEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	payload := []byte(`{"type":"member.joined"}`)
+
+	mock.ExpectExec("INSERT INTO webhook_deliveries \\(webhook_id, event_type, payload\\) SELECT id, \\$2, \\$3 FROM webhooks WHERE chatroom_id = \\$1 AND disabled_at IS NULL AND \\$2 = ANY\\(events\\)").
+		WithArgs(1, "member.joined", payload).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	queued, err := repo.EnqueueEvent(context.Background(), 1, "member.joined", payload)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, queued)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_ClaimDueDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET next_attempt_at = CURRENT_TIMESTAMP \\+ make_interval\\(secs => \\$2\\) FROM webhooks w (.+) FOR UPDATE SKIP LOCKED").
+		WithArgs(20, float64(60)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_type", "payload", "attempts", "created_at", "url", "secret"}).
+			AddRow(9, 4, "message.created", []byte(`{}`), 1, timestamp, "https://hooks.example.com", "s3cret"))
+
+	deliveries, err := repo.ClaimDueDeliveries(context.Background(), 20, time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "s3cret", deliveries[0].Secret)
+	assert.Equal(t, DeliveryPending, deliveries[0].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_GetWebhook(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	mock.ExpectQuery("SELECT id, chatroom_id, created_by, url, events, failure_count, disabled_at, created_at FROM webhooks WHERE id = \\$1 AND chatroom_id = \\$2").
+		WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chatroom_id", "created_by", "url", "events", "failure_count", "disabled_at", "created_at"}).
+			AddRow(4, 1, 7, "https://example.com/hook", "{message.created}", 0, nil, time.Now()))
+	webhook, err := repo.GetWebhook(context.Background(), 1, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, webhook.CreatedBy)
+
+	mock.ExpectQuery("SELECT id, chatroom_id, created_by").
+		WithArgs(5, 1).
+		WillReturnError(sql.ErrNoRows)
+	_, err = repo.GetWebhook(context.Background(), 1, 5)
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_ListWebhooks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	query := "SELECT id, chatroom_id, created_by, url, events, failure_count, disabled_at, created_at FROM webhooks " +
+		"WHERE chatroom_id = \\$1 AND \\(\\$2 = 0 OR created_by = \\$2\\) ORDER BY id"
+	columns := []string{"id", "chatroom_id", "created_by", "url", "events", "failure_count", "disabled_at", "created_at"}
+	mock.ExpectQuery(query).
+		WithArgs(1, 7).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(4, 1, 7, "https://example.com/hook", "{message.created}", 0, nil, time.Now()))
+	mock.ExpectQuery(query).
+		WithArgs(1, 0).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(4, 1, 7, "https://example.com/hook", "{message.created}", 0, nil, time.Now()).
+			AddRow(5, 1, 8, "https://example.com/other", "{member.joined}", 0, nil, time.Now()))
+
+	webhooks, err := repo.ListWebhooks(context.Background(), 1, 7)
+	assert.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	assert.Equal(t, 7, webhooks[0].CreatedBy)
+
+	webhooks, err = repo.ListWebhooks(context.Background(), 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, webhooks, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_RecordAttempt_Retry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	next := time.Now().Add(time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$2, attempts = attempts \\+ 1").
+		WithArgs(9, DeliveryPending, next, 503, "endpoint responded with 503").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE webhooks w SET failure_count").
+		WithArgs(4, false, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+	mock.ExpectCommit()
+
+	disabled, err := repo.RecordAttempt(context.Background(), DeliveryAttempt{
+		DeliveryID: 9, WebhookID: 4, ResponseStatus: 503, Error: "endpoint responded with 503", NextAttemptAt: next,
+	}, 20)
+	assert.NoError(t, err)
+	assert.False(t, disabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_RecordAttempt_Disables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$2").
+		WithArgs(9, DeliveryFailed, nil, nil, "connection refused").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE webhooks w SET failure_count").
+		WithArgs(4, false, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(true))
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = 'failed', last_error = 'webhook disabled after repeated failures' WHERE webhook_id = \\$1 AND status = 'pending'").
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	disabled, err := repo.RecordAttempt(context.Background(), DeliveryAttempt{DeliveryID: 9, WebhookID: 4, Error: "connection refused"}, 20)
+	assert.NoError(t, err)
+	assert.True(t, disabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_RecordAttempt_AlreadyDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE webhook_deliveries SET status = \\$2").
+		WithArgs(9, DeliveryFailed, nil, nil, "connection refused").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE webhooks w SET failure_count .+ FROM \\(SELECT id, disabled_at FROM webhooks WHERE id = \\$1 FOR UPDATE\\) previous .+ RETURNING previous.disabled_at IS NULL AND w.disabled_at IS NOT NULL").
+		WithArgs(4, false, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"disabled"}).AddRow(false))
+	mock.ExpectCommit()
+
+	disabled, err := repo.RecordAttempt(context.Background(), DeliveryAttempt{DeliveryID: 9, WebhookID: 4, Error: "connection refused"}, 20)
+	assert.NoError(t, err)
+	assert.False(t, disabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhookRepository_ListDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewWebhookRepository(db)
+
+	timestamp := time.Now()
+
+	mock.ExpectQuery("SELECT (.+) FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id WHERE d.webhook_id = \\$1 AND w.chatroom_id = \\$2").
+		WithArgs(4, 1, 0, 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "event_type", "payload", "status", "attempts", "next_attempt_at",
+			"last_attempt_at", "response_status", "last_error", "created_at", "delivered_at"}).
+			AddRow(9, 4, "message.created", []byte(`{}`), DeliverySucceeded, 2, timestamp, timestamp, 200, nil, timestamp, timestamp).
+			AddRow(8, 4, "member.joined", []byte(`{}`), DeliveryFailed, 8, timestamp, timestamp, nil, "timeout", timestamp, nil))
+
+	deliveries, err := repo.ListDeliveries(context.Background(), 1, 4, 0, 50)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, 200, *deliveries[0].ResponseStatus)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+	assert.Nil(t, deliveries[1].ResponseStatus)
+	assert.Equal(t, "timeout", deliveries[1].LastError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,21 +2,103 @@ package chat
 
 import (
 	"chat-app/internal/chat/repository"
-	"log"
+	"chat-app/internal/metrics"
+	"log/slog"
 )
 
+// Event types pushed to chatroom clients alongside plain messages
+const (
+	EventThreadReply     = "thread_reply"
+	EventReactionUpdated = "reaction_updated"
+	EventPresenceUpdated = "presence_updated"
+	EventTyping          = "typing"
+	EventReadReceipt     = "read_receipt"
+	EventLinkPreviews    = "link_previews"
+	EventNotification    = "notification"
+	EventMessageDeleted  = "message_deleted"
+	EventError           = "error"
+)
+
+// Event is a typed WebSocket frame, used for everything that is not a plain chat message
+type Event struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+// ThreadReplyPayload lets clients append a reply to an open thread and update the root's counters
+type ThreadReplyPayload struct {
+	Reply  repository.Message       `json:"reply"`
+	Thread repository.ThreadSummary `json:"thread"`
+}
+
+// ReactionPayload reports the new count of one emoji on a message after UserID added or removed it
+type ReactionPayload struct {
+	ChatroomID int    `json:"chatroom_id"`
+	MessageID  int    `json:"message_id"`
+	UserID     int    `json:"user_id"`
+	Emoji      string `json:"emoji"`
+	Count      int    `json:"count"`
+	Added      bool   `json:"added"`
+}
+
+// ErrorPayload is sent to a single client whose frame was refused, RetryAfter is in seconds
+type ErrorPayload struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// MessageDeletedPayload identifies a deleted message, ParentID is set when it was a thread reply
+type MessageDeletedPayload struct {
+	ChatroomID int  `json:"chatroom_id"`
+	MessageID  int  `json:"message_id"`
+	ParentID   *int `json:"parent_id,omitempty"`
+	UserID     int  `json:"user_id"`
+}
+
 func BroadcastMessageToChatroom(chatroomID int, message repository.Message) {
+	broadcastToChatroom(chatroomID, message, nil)
+}
+
+func BroadcastEventToChatroom(chatroomID int, event Event) {
+	broadcastToChatroom(chatroomID, event, nil)
+}
+
+// SendEventToUser writes the event to every open connection of the user, whatever chatroom it is in
+func SendEventToUser(userID int, event Event) {
+	ClientsMutex.RLock()
+	defer ClientsMutex.RUnlock()
+
+	for client := range userClients[userID] {
+		if err := client.WriteJSON(event); err != nil {
+			slog.Error("WebSocket send error", "error", err)
+			metrics.MessagesDropped.Inc()
+			client.Conn.Close()
+			continue
+		}
+		metrics.MessagesBroadcast.Inc()
+	}
+}
+
+// broadcastToChatroom writes the frame to every client of the chatroom but 'except', which may be nil.
+// Failing clients are closed, their read loop then removes them from the registry.
+func broadcastToChatroom(chatroomID int, frame interface{}, except *Client) {
 	ClientsMutex.RLock()
 	defer ClientsMutex.RUnlock()
 
 	if chatroomClients, ok := Clients[chatroomID]; ok {
 		for client := range chatroomClients {
-			err := client.WriteJSON(message)
+			if client == except {
+				continue
+			}
+			err := client.WriteJSON(frame)
 			if err != nil {
-				log.Println("WebSocket broadcast error:", err)
-				client.Close()
-				delete(chatroomClients, client)
+				slog.Error("WebSocket broadcast error", "error", err)
+				metrics.MessagesDropped.Inc()
+				client.Conn.Close()
+				continue
 			}
+			metrics.MessagesBroadcast.Inc()
 		}
 	}
 }
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusError       = "error"
+	StatusUnavailable = "unavailable"
+
+	checkTimeout = 2 * time.Second
+)
+
+// Check reports whether a dependency the server needs is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check in the /readyz response. It carries no error text, /readyz is served on
+// public ports and failures are logged instead.
+type CheckResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Checker serves the /healthz and /readyz endpoints of a server
+type Checker struct {
+	service   string
+	startedAt time.Time
+
+	mutex  sync.RWMutex
+	checks map[string]Check
+}
+
+func NewChecker(service string) *Checker {
+	return &Checker{
+		service:   service,
+		startedAt: time.Now(),
+		checks:    make(map[string]Check),
+	}
+}
+
+// Add registers a readiness check under the name it is reported with
+func (c *Checker) Add(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks[name] = check
+}
+
+// Register serves /healthz and /readyz on mux
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", c.HandleLiveness)
+	mux.HandleFunc("/readyz", c.HandleReadiness)
+}
+
+// HandleLiveness answers as long as the process serves requests, it checks no dependency so a broken database does
+// not get every server restarted
+func (c *Checker) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         StatusOK,
+		"service":        c.service,
+		"uptime_seconds": int(time.Since(c.startedAt).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+	})
+}
+
+// HandleReadiness runs every check concurrently and answers 503 unless they all pass
+func (c *Checker) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	results := c.Run(r.Context())
+
+	status, code := StatusOK, http.StatusOK
+	for _, result := range results {
+		if result.Status != StatusOK {
+			status, code = StatusUnavailable, http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status":  status,
+		"service": c.service,
+		"checks":  results,
+	})
+}
+
+// Run runs every check, each with its own timeout, and logs the ones that fail
+func (c *Checker) Run(ctx context.Context) map[string]CheckResult {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var (
+		wg          sync.WaitGroup
+		resultMutex sync.Mutex
+		results     = make(map[string]CheckResult, len(c.checks))
+	)
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result := CheckResult{Status: StatusOK}
+			if err := check(ctx); err != nil {
+				result = CheckResult{Status: StatusError}
+				slog.WarnContext(ctx, "Readiness check failed", "service", c.service, "check", name, "error", err)
+			}
+			result.DurationMs = time.Since(start).Milliseconds()
+
+			resultMutex.Lock()
+			results[name] = result
+			resultMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	checker := NewChecker("chat")
+	checker.Add("database", func(context.Context) error { return nil })
+
+	mux := http.NewServeMux()
+	checker.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, StatusOK, body.Status)
+	assert.Equal(t, StatusOK, body.Checks["database"].Status)
+
+	checker.Add("rabbitmq", func(context.Context) error { return errors.New("connection is closed") })
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	assert.NotContains(t, rec.Body.String(), "connection is closed")
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, StatusUnavailable, body.Status)
+	assert.Equal(t, StatusOK, body.Checks["database"].Status)
+	assert.Equal(t, StatusError, body.Checks["rabbitmq"].Status)
+}
+
+func TestChecker_CheckTimesOut(t *testing.T) {
+	checker := NewChecker("bot")
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := checker.Run(ctx)
+	assert.Equal(t, StatusError, results["slow"].Status)
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	checker := NewChecker("text")
+	checker.Add("database", func(context.Context) error { return errors.New("down") })
+
+	rec := httptest.NewRecorder()
+	checker.HandleLiveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"service":"text"`)
+
+	rec = httptest.NewRecorder()
+	checker.HandleLiveness(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,140 @@
+// Package jwk encodes and decodes the public signing keys of JSON Web Key Sets (RFC 7517), as served by identity
+// providers and by our own /.well-known/jwks.json
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Key holds the public parts of an RSA, EC or Ed25519 key
+type Key struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// PublicKeys decodes the signing keys of the set by ID, keys that cannot be used are skipped
+func (s Set) PublicKeys() map[string]interface{} {
+	keys := make(map[string]interface{})
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if publicKey, err := key.PublicKey(); err == nil {
+			keys[key.KeyID] = publicKey
+		}
+	}
+	return keys
+}
+
+// FromPublicKey encodes a signing key for publication
+func FromPublicKey(keyID, algorithm string, publicKey interface{}) (Key, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+	key := Key{KeyID: keyID, Use: "sig", Algorithm: algorithm}
+
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.KeyType = "RSA"
+		key.N = encode(publicKey.N.Bytes())
+		key.E = encode(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		key.KeyType = "EC"
+		key.Curve = publicKey.Curve.Params().Name
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		key.X = encode(publicKey.X.FillBytes(make([]byte, size)))
+		key.Y = encode(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		key.KeyType = "OKP"
+		key.Curve = "Ed25519"
+		key.X = encode(publicKey)
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	return key, nil
+}
+
+// PublicKey decodes the key into an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey
+func (k Key) PublicKey() (interface{}, error) {
+	decode := func(value string) ([]byte, error) {
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(raw) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+		return raw, nil
+	}
+	decodeInt := func(value string) (*big.Int, error) {
+		raw, err := decode(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(raw), nil
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
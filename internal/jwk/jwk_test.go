@@ -0,0 +1,53 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	publicKeys := map[string]interface{}{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+		"ed":  edPublic,
+	}
+
+	var set Set
+	for id, publicKey := range publicKeys {
+		key, err := FromPublicKey(id, "", publicKey)
+		require.NoError(t, err)
+		set.Keys = append(set.Keys, key)
+	}
+
+	encoded, err := json.Marshal(set)
+	require.NoError(t, err)
+	var decoded Set
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+	assert.Equal(t, publicKeys, decoded.PublicKeys())
+}
+
+func TestPublicKeys_SkipsUnusableKeys(t *testing.T) {
+	set := Set{Keys: []Key{
+		{KeyType: "RSA", KeyID: "enc", Use: "enc", N: "AQAB", E: "AQAB"},
+		{KeyType: "EC", KeyID: "off-curve", Curve: "P-256", X: "AQ", Y: "AQ"},
+		{KeyType: "oct", KeyID: "symmetric"},
+	}}
+
+	assert.Empty(t, set.PublicKeys())
+}
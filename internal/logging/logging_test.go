@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_AddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, "chat", slog.LevelInfo)
+
+	logger.InfoContext(WithRequestID(context.Background(), "abc-123"), "Hello", "user_id", 7)
+	logger.Info("Without context")
+	logger.Debug("Below the level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "Hello", record["msg"])
+	assert.Equal(t, "chat", record["service"])
+	assert.Equal(t, "abc-123", record["request_id"])
+	assert.Equal(t, float64(7), record["user_id"])
+
+	record = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.NotContains(t, record, "request_id")
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel(" WARN "))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+	assert.Equal(t, slog.LevelInfo, ParseLevel("verbose"))
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID(NewRequestID()))
+	assert.True(t, ValidRequestID("trace:1.2_3-4"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID("has space"))
+	assert.False(t, ValidRequestID("line\nbreak"))
+	assert.False(t, ValidRequestID(strings.Repeat("a", maxRequestIDLength+1)))
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "from-client")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, "from-client", seen)
+	assert.Equal(t, "from-client", rec.Header().Get(RequestIDHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "not valid")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+}
+
+func TestMiddleware_LogsRoute(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(New(&buf, "chat", slog.LevelInfo))
+	defer slog.SetDefault(previous)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hooks/", func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hooks/secret-token", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/elsewhere", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.NotContains(t, buf.String(), "secret-token")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "/hooks/", record["route"])
+
+	record = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "unmatched", record["route"])
+}
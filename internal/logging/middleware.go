@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"chat-app/internal/utils"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Middleware gives every request an ID, the one of the X-Request-ID header when it is valid or a new one. The ID is
+// put in the request context and echoed in the response, and every request is logged once it is done. Requests are
+// logged by the ServeMux pattern they matched rather than their path, which can carry secrets such as incoming
+// webhook tokens, so next must pass the request on unchanged for the mux to record it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := WithRequestID(r.Context(), id)
+		recorder := utils.NewStatusRecorder(w)
+		start := time.Now()
+
+		r = r.WithContext(ctx)
+		next.ServeHTTP(recorder, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		if recorder.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "Request handled",
+			"method", r.Method,
+			"route", route,
+			"status", recorder.Status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
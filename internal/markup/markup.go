@@ -0,0 +1,430 @@
+package markup
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxContentLength is the longest message accepted, in characters
+const MaxContentLength = 4000
+
+// Node types of the structured representation
+const (
+	NodeText        = "text"
+	NodeBold        = "bold"
+	NodeItalic      = "italic"
+	NodeStrike      = "strike"
+	NodeCode        = "code"
+	NodeCodeBlock   = "code_block"
+	NodeQuote       = "quote"
+	NodeLink        = "link"
+	NodeLineBreak   = "line_break"
+	NodeMention     = "mention"
+	NodeRoomMention = "room_mention"
+)
+
+// maxDepth bounds how deeply inline styles nest, deeper markers are kept as text
+const maxDepth = 4
+
+var (
+	ErrEmptyContent   = errors.New("message content is empty")
+	ErrContentTooLong = errors.New("message content is too long")
+	ErrInvalidContent = errors.New("message content contains invalid characters")
+)
+
+// Node is one element of a parsed message. Text is always plain text: clients must render it as such,
+// never as HTML, which is what makes the representation safe to display.
+type Node struct {
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	URL        string `json:"url,omitempty"`
+	UserID     int    `json:"user_id,omitempty"`
+	ChatroomID int    `json:"chatroom_id,omitempty"`
+	Children   []Node `json:"children,omitempty"`
+}
+
+// Document is the structured representation stored next to a message's raw content
+type Document struct {
+	Nodes []Node `json:"nodes"`
+	// Mentioned user and chatroom IDs, filled in by Resolve
+	Mentions     []int `json:"mentions,omitempty"`
+	RoomMentions []int `json:"room_mentions,omitempty"`
+}
+
+// Validate rejects content that cannot be stored: empty, too long, invalid UTF-8 or control characters.
+// HTML is not rejected, it is kept as literal text.
+func Validate(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return ErrEmptyContent
+	}
+	if !utf8.ValidString(content) {
+		return ErrInvalidContent
+	}
+	if utf8.RuneCountInString(content) > MaxContentLength {
+		return ErrContentTooLong
+	}
+	for _, r := range content {
+		if (unicode.IsControl(r) && r != '\n' && r != '\t' && r != '\r') || isBidiControl(r) {
+			return ErrInvalidContent
+		}
+	}
+	return nil
+}
+
+// isBidiControl matches the explicit direction overrides that can make text display differently from what it is
+func isBidiControl(r rune) bool {
+	return (r >= '\u202A' && r <= '\u202E') || (r >= '\u2066' && r <= '\u2069')
+}
+
+// Parse turns content written in the restricted markdown dialect into a Document:
+// **bold**, *italic* or _italic_, ~~strike~~, `code`, ```code blocks```, > quotes, [text](url), bare links,
+// @username and #room. Mentions are unresolved until Resolve is called.
+func Parse(content string) Document {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	var nodes []Node
+	parts := strings.Split(content, "```")
+	for i, part := range parts {
+		if i%2 == 1 {
+			// Odd parts sit between fences, unless the last fence is never closed
+			if i == len(parts)-1 {
+				nodes = appendText(nodes, "```"+part)
+				continue
+			}
+			nodes = append(nodes, Node{Type: NodeCodeBlock, Text: strings.TrimPrefix(part, "\n")})
+			continue
+		}
+		nodes = append(nodes, parseLines(part)...)
+	}
+
+	return Document{Nodes: nodes}
+}
+
+func parseLines(text string) []Node {
+	var nodes []Node
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if quoted, ok := strings.CutPrefix(line, "> "); ok {
+			nodes = append(nodes, Node{Type: NodeQuote, Children: parseInline(quoted, 0)})
+		} else {
+			nodes = append(nodes, parseInline(line, 0)...)
+		}
+		if i < len(lines)-1 {
+			nodes = append(nodes, Node{Type: NodeLineBreak})
+		}
+	}
+	return nodes
+}
+
+// delimiters in the order they are tried, longer markers first
+var delimiters = []struct {
+	marker   string
+	nodeType string
+}{
+	{"**", NodeBold},
+	{"~~", NodeStrike},
+	{"*", NodeItalic},
+	{"_", NodeItalic},
+}
+
+func parseInline(text string, depth int) []Node {
+	var nodes []Node
+	var plain strings.Builder
+
+	flush := func() {
+		nodes = appendText(nodes, plain.String())
+		plain.Reset()
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		previous, _ := utf8.DecodeLastRuneInString(text[:i])
+		atWordStart := i == 0 || isBoundary(previous)
+
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_~[]()#@>", rune(rest[1])):
+			plain.WriteByte(rest[1])
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				flush()
+				nodes = append(nodes, Node{Type: NodeCode, Text: rest[1 : end+1]})
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, target, length, ok := parseLink(rest); ok {
+				flush()
+				nodes = append(nodes, Node{Type: NodeLink, URL: target, Children: parseInline(label, depth+1)})
+				i += length
+				continue
+			}
+
+		case atWordStart && (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")):
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			link := strings.TrimRight(rest[:end], ".,;:!?)]}'\"")
+			if safeURL(link) != "" {
+				flush()
+				nodes = append(nodes, Node{Type: NodeLink, URL: link, Children: []Node{{Type: NodeText, Text: link}}})
+				i += len(link)
+				continue
+			}
+
+		case atWordStart && (rest[0] == '@' || rest[0] == '#'):
+			if name := leadingName(rest[1:]); name != "" {
+				flush()
+				nodeType := NodeMention
+				if rest[0] == '#' {
+					nodeType = NodeRoomMention
+				}
+				nodes = append(nodes, Node{Type: nodeType, Text: rest[:len(name)+1]})
+				i += len(name) + 1
+				continue
+			}
+		}
+
+		if depth < maxDepth {
+			if node, length, ok := parseDelimited(rest, atWordStart, depth); ok {
+				flush()
+				nodes = append(nodes, node)
+				i += length
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(rest)
+		plain.WriteRune(r)
+		i += size
+	}
+
+	flush()
+	return nodes
+}
+
+// parseDelimited matches styled spans such as **bold**, the content must not start or end with a space
+func parseDelimited(text string, atWordStart bool, depth int) (Node, int, bool) {
+	for _, delimiter := range delimiters {
+		if !strings.HasPrefix(text, delimiter.marker) {
+			continue
+		}
+		// Underscores inside words (snake_case) are not emphasis
+		if delimiter.marker == "_" && !atWordStart {
+			return Node{}, 0, false
+		}
+
+		inner := text[len(delimiter.marker):]
+		end := strings.Index(inner, delimiter.marker)
+		if end <= 0 || inner[0] == ' ' || inner[end-1] == ' ' {
+			continue
+		}
+		if delimiter.marker == "_" && end+1 < len(inner) {
+			if next, _ := utf8.DecodeRuneInString(inner[end+1:]); !isBoundary(next) {
+				continue
+			}
+		}
+
+		node := Node{Type: delimiter.nodeType, Children: parseInline(inner[:end], depth+1)}
+		return node, len(delimiter.marker)*2 + end, true
+	}
+	return Node{}, 0, false
+}
+
+// parseLink matches [label](url) with an allowed URL scheme
+func parseLink(text string) (string, string, int, bool) {
+	closeLabel := strings.Index(text, "](")
+	if closeLabel <= 1 || strings.ContainsRune(text[1:closeLabel], '\n') {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(text[closeLabel+2:], ')')
+	if closeURL <= 0 {
+		return "", "", 0, false
+	}
+
+	target := safeURL(text[closeLabel+2 : closeLabel+2+closeURL])
+	if target == "" {
+		return "", "", 0, false
+	}
+
+	return text[1:closeLabel], target, closeLabel + 3 + closeURL, true
+}
+
+// safeURL returns the URL if it is absolute with an http, https or mailto scheme, and "" otherwise
+func safeURL(raw string) string {
+	if strings.ContainsAny(raw, " \t\n<>\"") {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return ""
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return ""
+		}
+	default:
+		return ""
+	}
+	return u.String()
+}
+
+// leadingName returns the mention name at the start of text: letters, digits, '_', '-' and inner '.'
+func leadingName(text string) string {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.')
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	return strings.TrimRight(text[:end], ".")
+}
+
+func isBoundary(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) && r != '_'
+}
+
+func appendText(nodes []Node, text string) []Node {
+	if text == "" {
+		return nodes
+	}
+	if n := len(nodes); n > 0 && nodes[n-1].Type == NodeText {
+		nodes[n-1].Text += text
+		return nodes
+	}
+	return append(nodes, Node{Type: NodeText, Text: text})
+}
+
+// MentionNames lists the distinct @usernames and #rooms of the document, without their prefix
+func (d Document) MentionNames() ([]string, []string) {
+	var users, rooms []string
+	seenUsers, seenRooms := make(map[string]bool), make(map[string]bool)
+	walk(d.Nodes, func(node *Node) {
+		name := strings.ToLower(node.Text[min(1, len(node.Text)):])
+		switch node.Type {
+		case NodeMention:
+			if !seenUsers[name] {
+				seenUsers[name] = true
+				users = append(users, name)
+			}
+		case NodeRoomMention:
+			if !seenRooms[name] {
+				seenRooms[name] = true
+				rooms = append(rooms, name)
+			}
+		}
+	})
+	return users, rooms
+}
+
+// Resolve attaches IDs to mentions, keyed by lowercase name, and turns mentions that match nothing into plain text
+func (d *Document) Resolve(userIDs, chatroomIDs map[string]int) {
+	d.Mentions, d.RoomMentions = nil, nil
+	seenUsers, seenRooms := make(map[int]bool), make(map[int]bool)
+
+	walk(d.Nodes, func(node *Node) {
+		name := strings.ToLower(node.Text[min(1, len(node.Text)):])
+		switch node.Type {
+		case NodeMention:
+			if id, ok := userIDs[name]; ok {
+				node.UserID = id
+				if !seenUsers[id] {
+					seenUsers[id] = true
+					d.Mentions = append(d.Mentions, id)
+				}
+			} else {
+				node.Type = NodeText
+			}
+		case NodeRoomMention:
+			if id, ok := chatroomIDs[name]; ok {
+				node.ChatroomID = id
+				if !seenRooms[id] {
+					seenRooms[id] = true
+					d.RoomMentions = append(d.RoomMentions, id)
+				}
+			} else {
+				node.Type = NodeText
+			}
+		}
+	})
+
+	d.Nodes = mergeText(d.Nodes)
+}
+
+func walk(nodes []Node, visit func(node *Node)) {
+	for i := range nodes {
+		visit(&nodes[i])
+		walk(nodes[i].Children, visit)
+	}
+}
+
+func mergeText(nodes []Node) []Node {
+	var merged []Node
+	for _, node := range nodes {
+		node.Children = mergeText(node.Children)
+		if node.Type == NodeText {
+			merged = appendText(merged, node.Text)
+			continue
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// RenderHTML renders a document as HTML where every piece of user text is escaped
+func RenderHTML(nodes []Node) string {
+	var b strings.Builder
+	renderNodes(&b, nodes)
+	return b.String()
+}
+
+func renderNodes(b *strings.Builder, nodes []Node) {
+	wrap := func(tag string, children []Node) {
+		b.WriteString("<" + tag + ">")
+		renderNodes(b, children)
+		b.WriteString("</" + tag + ">")
+	}
+
+	for _, node := range nodes {
+		switch node.Type {
+		case NodeBold:
+			wrap("strong", node.Children)
+		case NodeItalic:
+			wrap("em", node.Children)
+		case NodeStrike:
+			wrap("del", node.Children)
+		case NodeQuote:
+			wrap("blockquote", node.Children)
+		case NodeCode:
+			b.WriteString("<code>" + html.EscapeString(node.Text) + "</code>")
+		case NodeCodeBlock:
+			b.WriteString("<pre><code>" + html.EscapeString(node.Text) + "</code></pre>")
+		case NodeLineBreak:
+			b.WriteString("<br>")
+		case NodeLink:
+			b.WriteString(`<a href="` + html.EscapeString(node.URL) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+			renderNodes(b, node.Children)
+			b.WriteString("</a>")
+		case NodeMention:
+			b.WriteString(`<span class="mention" data-user-id="` + html.EscapeString(strconv.Itoa(node.UserID)) + `">` + html.EscapeString(node.Text) + "</span>")
+		case NodeRoomMention:
+			b.WriteString(`<span class="room-mention" data-chatroom-id="` + html.EscapeString(strconv.Itoa(node.ChatroomID)) + `">` + html.EscapeString(node.Text) + "</span>")
+		default:
+			b.WriteString(html.EscapeString(node.Text))
+		}
+	}
+}
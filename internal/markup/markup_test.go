@@ -0,0 +1,91 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("hello\n\tworld"))
+	assert.ErrorIs(t, Validate("  \n "), ErrEmptyContent)
+	assert.ErrorIs(t, Validate(strings.Repeat("a", MaxContentLength+1)), ErrContentTooLong)
+	assert.ErrorIs(t, Validate("bad\x00byte"), ErrInvalidContent)
+	assert.ErrorIs(t, Validate("evil\u202Etxt.exe"), ErrInvalidContent)
+	assert.ErrorIs(t, Validate(string([]byte{0xff, 0xfe})), ErrInvalidContent)
+}
+
+func TestParse_InlineStyles(t *testing.T) {
+	doc := Parse("**bold** *it* _em_ ~~gone~~ `x < y` snake_case_name")
+	assert.Equal(t, []Node{
+		{Type: NodeBold, Children: []Node{{Type: NodeText, Text: "bold"}}},
+		{Type: NodeText, Text: " "},
+		{Type: NodeItalic, Children: []Node{{Type: NodeText, Text: "it"}}},
+		{Type: NodeText, Text: " "},
+		{Type: NodeItalic, Children: []Node{{Type: NodeText, Text: "em"}}},
+		{Type: NodeText, Text: " "},
+		{Type: NodeStrike, Children: []Node{{Type: NodeText, Text: "gone"}}},
+		{Type: NodeText, Text: " "},
+		{Type: NodeCode, Text: "x < y"},
+		{Type: NodeText, Text: " snake_case_name"},
+	}, doc.Nodes)
+}
+
+func TestParse_MultibyteWordBoundary(t *testing.T) {
+	// The last byte of 'á' would read as '¡', which is punctuation
+	doc := Parse("já_x_ olá@alice _em_é")
+	assert.Equal(t, []Node{{Type: NodeText, Text: "já_x_ olá@alice _em_é"}}, doc.Nodes)
+}
+
+func TestParse_BlocksAndLinks(t *testing.T) {
+	doc := Parse("> quoted\nsee [docs](https://example.com/a) or https://example.org.\n```\n<b>raw</b>\n```")
+	assert.Equal(t, []Node{
+		{Type: NodeQuote, Children: []Node{{Type: NodeText, Text: "quoted"}}},
+		{Type: NodeLineBreak},
+		{Type: NodeText, Text: "see "},
+		{Type: NodeLink, URL: "https://example.com/a", Children: []Node{{Type: NodeText, Text: "docs"}}},
+		{Type: NodeText, Text: " or "},
+		{Type: NodeLink, URL: "https://example.org", Children: []Node{{Type: NodeText, Text: "https://example.org"}}},
+		{Type: NodeText, Text: "."},
+		{Type: NodeLineBreak},
+		{Type: NodeCodeBlock, Text: "<b>raw</b>\n"},
+	}, doc.Nodes)
+}
+
+func TestParse_RejectsUnsafeLinks(t *testing.T) {
+	doc := Parse("[click](javascript:alert(1)) [x](data:text/html,hi)")
+	for _, node := range doc.Nodes {
+		assert.NotEqual(t, NodeLink, node.Type)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	doc := Parse("hi @Alice and @ghost, see #general or #nowhere. mail a@b.com @alice")
+
+	users, rooms := doc.MentionNames()
+	assert.Equal(t, []string{"alice", "ghost"}, users)
+	assert.Equal(t, []string{"general", "nowhere"}, rooms)
+
+	doc.Resolve(map[string]int{"alice": 7}, map[string]int{"general": 3})
+	assert.Equal(t, []int{7}, doc.Mentions)
+	assert.Equal(t, []int{3}, doc.RoomMentions)
+	assert.Equal(t, []Node{
+		{Type: NodeText, Text: "hi "},
+		{Type: NodeMention, Text: "@Alice", UserID: 7},
+		{Type: NodeText, Text: " and @ghost, see "},
+		{Type: NodeRoomMention, Text: "#general", ChatroomID: 3},
+		{Type: NodeText, Text: " or #nowhere. mail a@b.com "},
+		{Type: NodeMention, Text: "@alice", UserID: 7},
+	}, doc.Nodes)
+}
+
+func TestRenderHTML_EscapesText(t *testing.T) {
+	doc := Parse(`<script>alert("x")</script> **<img src=x onerror=alert(1)>** [a"b](https://example.com/?q="><x>)`)
+	rendered := RenderHTML(doc.Nodes)
+
+	assert.NotContains(t, rendered, "<script>")
+	assert.NotContains(t, rendered, "<img")
+	assert.Contains(t, rendered, "&lt;script&gt;")
+	assert.Contains(t, rendered, "<strong>&lt;img src=x onerror=alert(1)&gt;</strong>")
+}
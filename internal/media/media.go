@@ -0,0 +1,116 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Registers the GIF decoder
+	_ "image/jpeg" // Registers the JPEG decoder
+	"image/png"
+	"mime"
+	"net/http"
+)
+
+const (
+	// ThumbnailSize is the maximum width and height of generated thumbnails
+	ThumbnailSize = 256
+	// maxImagePixels guards against decompression bombs, larger images are stored without a thumbnail
+	maxImagePixels = 40_000_000
+)
+
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+// allowedTypes are the content types accepted for attachments, detected from the file content and never from the client
+var allowedTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// DetectContentType sniffs the content type from the first bytes of a file and checks it against the allowed types
+func DetectContentType(head []byte) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !allowedTypes[mediaType] {
+		return "", ErrUnsupportedType
+	}
+	return mediaType, nil
+}
+
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Thumbnail decodes an image and returns a PNG scaled down to fit in ThumbnailSize, along with the original dimensions.
+// Formats without a decoder (e.g. WebP) and oversized images return an error, callers store those without a thumbnail.
+func Thumbnail(data []byte) ([]byte, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read image header: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, 0, 0, fmt.Errorf("image is too large for a thumbnail: %dx%d", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleDown(src, ThumbnailSize)); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), config.Width, config.Height, nil
+}
+
+// scaleDown resizes the image to fit in a maxSize square keeping its aspect ratio, every destination pixel
+// is the average of the source pixels it covers
+func scaleDown(src image.Image, maxSize int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	dstWidth, dstHeight := width, height
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			dstWidth, dstHeight = maxSize, max(1, height*maxSize/width)
+		} else {
+			dstWidth, dstHeight = max(1, width*maxSize/height), maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		srcY0 := bounds.Min.Y + y*height/dstHeight
+		srcY1 := max(srcY0+1, bounds.Min.Y+(y+1)*height/dstHeight)
+		for x := 0; x < dstWidth; x++ {
+			srcX0 := bounds.Min.X + x*width/dstWidth
+			srcX1 := max(srcX0+1, bounds.Min.X+(x+1)*width/dstWidth)
+
+			var r, g, b, a, count uint64
+			for sy := srcY0; sy < srcY1; sy++ {
+				for sx := srcX0; sx < srcX1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count >> 8)
+			dst.Pix[offset+1] = uint8(g / count >> 8)
+			dst.Pix[offset+2] = uint8(b / count >> 8)
+			dst.Pix[offset+3] = uint8(a / count >> 8)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,71 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	contentType, err := DetectContentType(encodePNG(t, 2, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	contentType, err = DetectContentType([]byte("just some notes"))
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+
+	_, err = DetectContentType([]byte("<html><script>alert(1)</script></html>"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	_, err = DetectContentType([]byte{0x4d, 0x5a, 0x90, 0x00, 0x03})
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+}
+
+func TestThumbnail(t *testing.T) {
+	thumbnail, width, height, err := Thumbnail(encodePNG(t, 1024, 512))
+	require.NoError(t, err)
+	assert.Equal(t, 1024, width)
+	assert.Equal(t, 512, height)
+
+	img, err := png.Decode(bytes.NewReader(thumbnail))
+	require.NoError(t, err)
+	assert.Equal(t, ThumbnailSize, img.Bounds().Dx())
+	assert.Equal(t, ThumbnailSize/2, img.Bounds().Dy())
+
+	r, g, b, _ := img.At(10, 10).RGBA()
+	assert.Equal(t, []uint32{200, 100, 50}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestThumbnail_KeepsSmallImagesSize(t *testing.T) {
+	thumbnail, _, _, err := Thumbnail(encodePNG(t, 40, 30))
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(thumbnail))
+	require.NoError(t, err)
+	assert.Equal(t, 40, img.Bounds().Dx())
+	assert.Equal(t, 30, img.Bounds().Dy())
+}
+
+func TestThumbnail_InvalidImage(t *testing.T) {
+	_, _, _, err := Thumbnail([]byte("not an image"))
+	assert.Error(t, err)
+}
@@ -1,19 +1,32 @@
 package messaging
 
 import (
+	"chat-app/internal/logging"
+	"chat-app/internal/metrics"
+	"chat-app/internal/tracing"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// publishedAtHeader holds the publishing time in Unix milliseconds, the AMQP timestamp property only has seconds
+const publishedAtHeader = "X-Published-At"
+
 type RabbitMQ struct {
 	Connection *amqp.Connection
 	Channel    *amqp.Channel
+
+	channelClosed chan *amqp.Error
 }
 
 func SetupRabbitMQ(queueNames ...string) (*RabbitMQ, error) {
@@ -33,7 +46,7 @@ func SetupRabbitMQ(queueNames ...string) (*RabbitMQ, error) {
 
 	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s:%s/", rabbitMQUser, rabbitMQPass, rabbitMQHost, rabbitMQPort))
 	if err != nil {
-		log.Fatal("Failed to connect to RabbitMQ:", err)
+		logging.Fatal("Failed to connect to RabbitMQ", "error", err)
 	}
 
 	channel, err := conn.Channel()
@@ -59,8 +72,9 @@ func SetupRabbitMQ(queueNames ...string) (*RabbitMQ, error) {
 	}
 
 	return &RabbitMQ{
-		Connection: conn,
-		Channel:    channel,
+		Connection:    conn,
+		Channel:       channel,
+		channelClosed: channel.NotifyClose(make(chan *amqp.Error, 1)),
 	}, nil
 }
 
@@ -72,3 +86,122 @@ func (r *RabbitMQ) Close() {
 		r.Connection.Close()
 	}
 }
+
+// Check is the readiness check of the connection and its channel. Neither reconnects, so once one is closed the
+// server stays unready until it is restarted.
+func (r *RabbitMQ) Check(context.Context) error {
+	if r.Connection == nil || r.Connection.IsClosed() {
+		return errors.New("connection is closed")
+	}
+
+	select {
+	case err := <-r.channelClosed:
+		// The notification is only sent once, afterwards the closed Go channel keeps answering nil
+		if err != nil {
+			return fmt.Errorf("channel is closed: %w", err)
+		}
+		return errors.New("channel is closed")
+	default:
+		return nil
+	}
+}
+
+// Publish sends a JSON message to the queue. The request ID and the trace context of ctx go along in the message
+// headers, so the consumer's logs and spans can be tied to the request that caused them.
+func (r *RabbitMQ) Publish(ctx context.Context, queueName string, body []byte) error {
+	ctx, span := tracing.Start(ctx, queueName+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemRabbitmq, semconv.MessagingDestinationName(queueName)),
+	)
+	defer span.End()
+
+	headers := amqp.Table{publishedAtHeader: time.Now().UnixMilli()}
+	if id := logging.RequestID(ctx); id != "" {
+		headers[logging.RequestIDHeader] = id
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
+	err := r.Channel.Publish(
+		"",
+		queueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Headers:     headers,
+			Body:        body,
+		},
+	)
+	if err != nil {
+		tracing.RecordError(span, err)
+		metrics.AMQPPublishErrors.WithLabelValues(queueName).Inc()
+		return err
+	}
+	metrics.AMQPPublished.WithLabelValues(queueName).Inc()
+	return nil
+}
+
+// Consume hands every message of the queue to handle until the channel is closed. Each call gets a context with the
+// request ID and the trace of the publisher, see Publish, and runs inside a consumer span.
+func (r *RabbitMQ) Consume(queueName string, handle func(ctx context.Context, body []byte)) error {
+	msgs, err := r.Channel.Consume(
+		queueName,
+		"",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start consuming %s: %w", queueName, err)
+	}
+
+	for msg := range msgs {
+		ctx, span := tracing.Start(deliveryContext(queueName, msg), queueName+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(semconv.MessagingSystemRabbitmq, semconv.MessagingDestinationName(queueName)),
+		)
+		handle(ctx, msg.Body)
+		span.End()
+	}
+	return nil
+}
+
+// deliveryContext returns a context carrying the request ID and the trace context the message was published with.
+// Messages without a request ID get a new one, so everything that follows from them can still be correlated.
+// It also counts the delivery and how long the message was queued.
+func deliveryContext(queueName string, delivery amqp.Delivery) context.Context {
+	metrics.AMQPConsumed.WithLabelValues(queueName).Inc()
+	if publishedAt, ok := delivery.Headers[publishedAtHeader].(int64); ok {
+		lag := time.Since(time.UnixMilli(publishedAt))
+		metrics.AMQPQueueLag.WithLabelValues(queueName).Observe(max(lag.Seconds(), 0))
+	}
+
+	id, _ := delivery.Headers[logging.RequestIDHeader].(string)
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	ctx := logging.WithRequestID(context.Background(), id)
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier(delivery.Headers))
+}
+
+// headerCarrier lets OpenTelemetry propagators read and write AMQP message headers
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
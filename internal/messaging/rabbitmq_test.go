@@ -0,0 +1,37 @@
+package messaging
+
+import (
+	"chat-app/internal/logging"
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDeliveryContext_CarriesRequestAndTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(logging.WithRequestID(context.Background(), "req-1"), span)
+
+	headers := amqp.Table{logging.RequestIDHeader: logging.RequestID(ctx)}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
+	got := deliveryContext("stock_requests", amqp.Delivery{Headers: headers})
+	assert.Equal(t, "req-1", logging.RequestID(got))
+	assert.Equal(t, span.TraceID(), trace.SpanContextFromContext(got).TraceID())
+	assert.True(t, trace.SpanContextFromContext(got).IsRemote())
+
+	// Messages from older publishers have neither
+	got = deliveryContext("stock_requests", amqp.Delivery{})
+	assert.True(t, logging.ValidRequestID(logging.RequestID(got)))
+	assert.False(t, trace.SpanContextFromContext(got).IsValid())
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Every collector of the services is defined here so the whole catalog can be reviewed in one place. They live in the
+// default registry, next to the Go runtime and process collectors it comes with.
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route pattern, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle HTTP requests, by route pattern and method. WebSocket connections are left out.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	WebSocketConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chat_websocket_connections",
+		Help: "Open WebSocket connections, by chatroom.",
+	}, []string{"chatroom_id"})
+
+	MessagesBroadcast = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_broadcast_total",
+		Help: "Messages and events written to WebSocket clients, one per client.",
+	})
+
+	MessagesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_dropped_total",
+		Help: "Messages and events that could not be written to a WebSocket client, whose connection was then closed.",
+	})
+
+	AMQPPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_published_total",
+		Help: "Messages published to RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	AMQPPublishErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_publish_errors_total",
+		Help: "Messages that failed to publish to RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	AMQPConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_consumed_total",
+		Help: "Messages received from RabbitMQ, by queue.",
+	}, []string{"queue"})
+
+	AMQPQueueLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "amqp_queue_lag_seconds",
+		Help:    "Time messages spent between publishing and delivery, by queue.",
+		Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"queue"})
+
+	StockFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bot_stock_fetch_duration_seconds",
+		Help:    "Time to fetch a quote from the stock API.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	StockFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_stock_fetch_errors_total",
+		Help: "Failed stock quote fetches, by reason: request, read or format.",
+	}, []string{"reason"})
+
+	RetentionMessagesPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retention_messages_purged_total",
+		Help: "Messages removed by the retention janitor, replies included, by action: delete or archive.",
+	}, []string{"action"})
+
+	RetentionBatches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_batches_total",
+		Help: "Purge batches that removed messages.",
+	})
+
+	RetentionErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "retention_errors_total",
+		Help: "Retention janitor runs that failed in at least one chatroom.",
+	})
+
+	RetentionLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "retention_last_success_timestamp_seconds",
+		Help: "Unix time of the last retention janitor run that purged every chatroom without error.",
+	})
+
+	RetentionRunDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "retention_last_run_duration_seconds",
+		Help: "How long the last retention janitor run took.",
+	})
+)
+
+// Handler serves the default registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterDB exports the connection pool statistics of db, labelled with the database name
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
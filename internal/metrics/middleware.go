@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"chat-app/internal/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware counts and times the requests served by mux. Requests are labelled with the pattern they matched rather
+// than their path, which keeps IDs in URLs from creating a series each.
+func Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		recorder := utils.NewStatusRecorder(w)
+		start := time.Now()
+
+		mux.ServeHTTP(recorder, r)
+
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.Status)).Inc()
+		// A WebSocket request lasts as long as its connection, that would only blur the latencies
+		if !recorder.Hijacked {
+			HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+		}
+	})
+}
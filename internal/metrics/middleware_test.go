@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_LabelsByPattern(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+	handler := Middleware(mux)
+
+	for _, path := range []string{"/rooms/1", "/rooms/2", "/rooms/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(HTTPRequests.WithLabelValues("/rooms/{id}", http.MethodGet, "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(HTTPRequests.WithLabelValues("/rooms/{id}", http.MethodGet, "404")))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/elsewhere", nil))
+	assert.Equal(t, float64(1), testutil.ToFloat64(HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404")))
+}
+
+func TestHandler(t *testing.T) {
+	AMQPPublished.WithLabelValues("stock_requests").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.True(t, strings.Contains(body, `amqp_published_total{queue="stock_requests"} 1`))
+	assert.True(t, strings.Contains(body, "go_goroutines"))
+}
@@ -0,0 +1,291 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-app/internal/jwk"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	httpTimeout     = 10 * time.Second
+	maxResponseSize = 1 << 20
+	// Unknown key IDs trigger a JWKS refresh, at most this often, so forged tokens cannot make us hammer the IdP
+	jwksRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Provider is the configuration of an identity provider registered with our client
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Optional, public clients rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity is what we learn about the user from a verified ID token. Issuer and Subject identify them for good,
+// the other claims are informational and may change.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client runs the authorization code flow with PKCE against one provider. Discovery and keys are fetched lazily
+// and cached.
+type Client struct {
+	Provider Provider
+
+	httpClient *http.Client
+
+	mutex         sync.Mutex
+	discovery     *discovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewClient(provider Provider) *Client {
+	if len(provider.Scopes) == 0 {
+		provider.Scopes = []string{"openid", "profile", "email"}
+	}
+	return &Client{
+		Provider:   provider,
+		httpClient: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// NewPKCE returns a code verifier and its S256 challenge
+func NewPKCE() (string, string, error) {
+	verifier, err := RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns 256 random bits, URL safe, for states, nonces and verifiers
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthCodeURL is where the user's browser is sent to sign in
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", c.Provider.ClientID)
+	query.Set("redirect_uri", c.Provider.RedirectURL)
+	query.Set("scope", strings.Join(c.Provider.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange trades the code the provider redirected back with for an ID token, and verifies it
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.Provider.RedirectURL)
+	form.Set("client_id", c.Provider.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.Provider.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.Provider.ClientID), url.QueryEscape(c.Provider.ClientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&tokens); err != nil {
+		return Identity{}, fmt.Errorf("%w: status %d", ErrExchangeFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return Identity{}, fmt.Errorf("%w: %s %s", ErrExchangeFailed, tokens.Error, tokens.ErrorDescription)
+	}
+
+	return c.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// VerifyIDToken checks the signature against the provider's keys, then the issuer, audience, expiry and nonce
+func (c *Client) VerifyIDToken(ctx context.Context, rawToken, nonce string) (Identity, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.key(ctx, d.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(c.Provider.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return Identity{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+func (c *Client) getDiscovery(ctx context.Context) (*discovery, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.discovery != nil {
+		return c.discovery, nil
+	}
+
+	var d discovery
+	wellKnown := strings.TrimSuffix(c.Provider.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := c.getJSON(ctx, wellKnown, &d); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", c.Provider.Name, err)
+	}
+	// The issuer is what ID tokens are checked against, it must be the configured one (OpenID Connect Discovery 4.3)
+	if d.Issuer != c.Provider.Issuer {
+		return nil, fmt.Errorf("failed to discover %s: issuer %q does not match %q", c.Provider.Name, d.Issuer, c.Provider.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("failed to discover %s: incomplete provider metadata", c.Provider.Name)
+	}
+
+	c.discovery = &d
+	return c.discovery, nil
+}
+
+// key returns the verification key with the ID, refetching the key set when the ID is unknown, e.g. after the
+// provider rotated its keys
+func (c *Client) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(c.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	var set jwk.Set
+	if err := c.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	c.keys = set.PublicKeys()
+	c.keysFetchedAt = time.Now()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (c *Client) getJSON(ctx context.Context, rawURL string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d from %s", resp.StatusCode, rawURL)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(target)
+}
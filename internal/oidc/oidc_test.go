@@ -0,0 +1,136 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"chat-app/internal/oidc"
+	"chat-app/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/auth/oidc/corp/callback"
+
+// authorize follows the flow up to the redirect back to us and returns the code
+func authorize(t *testing.T, client *oidc.Client, state, nonce, challenge string) string {
+	t.Helper()
+
+	authURL, err := client.AuthCodeURL(context.Background(), state, nonce, challenge)
+	require.NoError(t, err)
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, state, location.Query().Get("state"))
+	return location.Query().Get("code")
+}
+
+func TestClient_AuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.NewServer("chat-app", redirectURL, oidctest.User{Subject: "u-42", Email: "alice@corp.example", PreferredUsername: "alice"})
+	defer idp.Close()
+
+	client := oidc.NewClient(idp.Provider("corp"))
+	verifier, challenge, err := oidc.NewPKCE()
+	require.NoError(t, err)
+
+	code := authorize(t, client, "state-1", "nonce-1", challenge)
+	identity, err := client.Exchange(context.Background(), code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL, identity.Issuer)
+	assert.Equal(t, "u-42", identity.Subject)
+	assert.Equal(t, "alice", identity.PreferredUsername)
+	assert.True(t, identity.EmailVerified)
+
+	// Codes are single use
+	_, err = client.Exchange(context.Background(), code, verifier, "nonce-1")
+	assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+}
+
+func TestClient_RejectsWrongVerifierAndNonce(t *testing.T) {
+	idp := oidctest.NewServer("chat-app", redirectURL, oidctest.User{Subject: "u-42"})
+	defer idp.Close()
+
+	client := oidc.NewClient(idp.Provider("corp"))
+	_, challenge, err := oidc.NewPKCE()
+	require.NoError(t, err)
+	otherVerifier, _, err := oidc.NewPKCE()
+	require.NoError(t, err)
+
+	code := authorize(t, client, "state", "nonce", challenge)
+	_, err = client.Exchange(context.Background(), code, otherVerifier, "nonce")
+	assert.ErrorIs(t, err, oidc.ErrExchangeFailed)
+
+	verifier, challenge, err := oidc.NewPKCE()
+	require.NoError(t, err)
+	code = authorize(t, client, "state", "nonce", challenge)
+	_, err = client.Exchange(context.Background(), code, verifier, "another-nonce")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestClient_VerifyIDToken(t *testing.T) {
+	idp := oidctest.NewServer("chat-app", redirectURL, oidctest.User{})
+	defer idp.Close()
+
+	client := oidc.NewClient(idp.Provider("corp"))
+	valid := jwt.MapClaims{"iss": idp.URL, "sub": "u-1", "aud": "chat-app", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n"}
+
+	_, err := client.VerifyIDToken(context.Background(), idp.SignIDToken(valid), "n")
+	assert.NoError(t, err)
+
+	for name, change := range map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no subject":     func(c jwt.MapClaims) { delete(c, "sub") },
+	} {
+		claims := jwt.MapClaims{}
+		for key, value := range valid {
+			claims[key] = value
+		}
+		change(claims)
+
+		_, err := client.VerifyIDToken(context.Background(), idp.SignIDToken(claims), "n")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken, name)
+	}
+
+	// Same claims, but signed by a key the provider does not publish
+	other := oidctest.NewServer("chat-app", redirectURL, oidctest.User{})
+	defer other.Close()
+	_, err = client.VerifyIDToken(context.Background(), other.SignIDToken(valid), "n")
+	assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "corp, my-idp")
+	t.Setenv("OIDC_CORP_ISSUER", "https://login.corp.example")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "chat")
+	t.Setenv("OIDC_CORP_REDIRECT_URL", redirectURL)
+	t.Setenv("OIDC_MY_IDP_ISSUER", "https://idp.example")
+	t.Setenv("OIDC_MY_IDP_CLIENT_ID", "chat")
+	t.Setenv("OIDC_MY_IDP_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_MY_IDP_REDIRECT_URL", redirectURL)
+	t.Setenv("OIDC_MY_IDP_SCOPES", "openid email")
+
+	providers, err := oidc.ProvidersFromEnv()
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+	assert.Equal(t, "corp", providers[0].Name)
+	assert.Equal(t, "my-idp", providers[1].Name)
+	assert.Equal(t, "secret", providers[1].ClientSecret)
+	assert.Equal(t, []string{"openid", "email"}, providers[1].Scopes)
+
+	t.Setenv("OIDC_CORP_CLIENT_ID", "")
+	_, err = oidc.ProvidersFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"chat-app/internal/utils"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are dropped, they hold no state worth keeping
+const sweepInterval = time.Minute
+
+var ErrInvalidLimit = errors.New(`invalid rate limit, expected "<count>/<s|m|h>" with an optional ":<burst>"`)
+
+// Limit is a token bucket: Rate tokens per second flow into a bucket holding at most Burst tokens, each event takes one
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Every returns a limit of count events per period, with bursts of up to burst events
+func Every(period time.Duration, count, burst int) Limit {
+	return Limit{Rate: float64(count) / period.Seconds(), Burst: burst}
+}
+
+// ParseLimit reads limits such as "30/m" or "5/s:20", the burst defaults to the count
+func ParseLimit(s string) (Limit, error) {
+	spec, burstStr, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	countStr, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst <= 0 {
+			return Limit{}, ErrInvalidLimit
+		}
+	}
+
+	return Every(period, count, burst), nil
+}
+
+// FromEnv reads a limit from an environment variable, invalid values are logged and replaced by the fallback
+func FromEnv(key string, fallback Limit) Limit {
+	value := utils.GetEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+
+	limit, err := ParseLimit(value)
+	if err != nil {
+		slog.Warn("Invalid rate limit, using the default", "key", key, "error", err)
+		return fallback
+	}
+	return limit
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key, such as a user or a client address
+type Limiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func New(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it returns false
+// and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if l.lastSweep.IsZero() {
+		l.lastSweep = now
+	} else if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	missing := (1 - b.tokens) / l.limit.Rate
+	return false, time.Duration(missing * float64(time.Second))
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// KeyFunc picks the bucket a request draws from
+type KeyFunc func(r *http.Request) string
+
+// ClientIP keys requests by the address they come from. Forwarding headers are ignored since they can be forged.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RetryAfterSeconds rounds a wait up to the whole seconds of a Retry-After header
+func RetryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// Middleware answers 429 with a Retry-After header once the request's bucket is empty
+func Middleware(limiter *Limiter, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if allowed, wait := limiter.Allow(key(r)); !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(wait)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
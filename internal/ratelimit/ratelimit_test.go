@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("30/m")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 30}, limit)
+
+	limit, err = ParseLimit("5/s:20")
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Rate: 5, Burst: 20}, limit)
+
+	for _, invalid := range []string{"", "30", "30/d", "0/m", "-1/s", "10/m:0", "ten/m"} {
+		_, err = ParseLimit(invalid)
+		assert.ErrorIs(t, err, ErrInvalidLimit, invalid)
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := New(Every(time.Minute, 6, 2)) // One token every 10s
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+
+	allowed, wait := limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, wait)
+
+	allowed, _ = limiter.Allow("b")
+	assert.True(t, allowed, "buckets are per key")
+
+	now = now.Add(5 * time.Second)
+	allowed, wait = limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, 5*time.Second, wait)
+
+	now = now.Add(5 * time.Second)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+}
+
+func TestLimiter_SweepsFullBuckets(t *testing.T) {
+	now := time.Now()
+	limiter := New(Every(time.Second, 1, 1))
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("a")
+	assert.Len(t, limiter.buckets, 1)
+
+	now = now.Add(sweepInterval)
+	limiter.Allow("b")
+	assert.Len(t, limiter.buckets, 1)
+	assert.Contains(t, limiter.buckets, "b")
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := New(Every(time.Minute, 1, 1))
+	handler := Middleware(limiter, ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve("203.0.113.1:5000").Code)
+
+	rec := serve("203.0.113.1:5001")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusNoContent, serve("203.0.113.2:5000").Code)
+}
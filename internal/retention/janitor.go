@@ -0,0 +1,149 @@
+package retention
+
+import (
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/metrics"
+	"chat-app/internal/storage"
+	"chat-app/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	ActionDelete  = "delete"
+	ActionArchive = "archive"
+
+	defaultInterval  = time.Hour
+	defaultBatchSize = 500
+)
+
+// Config is how the janitor purges, see ConfigFromEnv
+type Config struct {
+	Action    string
+	Interval  time.Duration
+	BatchSize int
+}
+
+// ConfigFromEnv reads RETENTION_ACTION (delete, the default, or archive), RETENTION_INTERVAL between runs
+// (1h by default) and RETENTION_BATCH_SIZE, the number of threads removed per transaction (500 by default).
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Action:    utils.GetEnv("RETENTION_ACTION", ActionDelete),
+		Interval:  defaultInterval,
+		BatchSize: utils.GetEnvInt("RETENTION_BATCH_SIZE", defaultBatchSize),
+	}
+	if config.Action != ActionDelete && config.Action != ActionArchive {
+		return Config{}, fmt.Errorf("invalid RETENTION_ACTION %q", config.Action)
+	}
+	if config.BatchSize <= 0 {
+		return Config{}, fmt.Errorf("invalid RETENTION_BATCH_SIZE %d", config.BatchSize)
+	}
+	if value := os.Getenv("RETENTION_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return Config{}, fmt.Errorf("invalid RETENTION_INTERVAL %q", value)
+		}
+		config.Interval = parsed
+	}
+	return config, nil
+}
+
+// Store is the part of the retention repository the janitor uses
+type Store interface {
+	ListPurgeable(ctx context.Context) ([]int, error)
+	PurgeBatch(ctx context.Context, chatroomID, limit int, archive bool) (repository.PurgeResult, error)
+}
+
+// Janitor enforces the retention policies of the chatrooms, rooms under legal hold are left alone
+type Janitor struct {
+	store  Store
+	blobs  storage.BlobStore
+	config Config
+}
+
+func NewJanitor(store Store, blobs storage.BlobStore, config Config) *Janitor {
+	return &Janitor{store: store, blobs: blobs, config: config}
+}
+
+// Run purges right away and then every interval, until ctx is cancelled
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		purged, err := j.PurgeExpired(ctx)
+		if err != nil {
+			metrics.RetentionErrors.Inc()
+			slog.ErrorContext(ctx, "Retention purge error", "error", err)
+		} else {
+			metrics.RetentionLastSuccess.SetToCurrentTime()
+		}
+		metrics.RetentionRunDuration.Set(time.Since(start).Seconds())
+		if purged > 0 {
+			slog.InfoContext(ctx, "Purged expired messages", "messages", purged, "action", j.config.Action)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired runs batches in every chatroom with a retention limit until none has expired messages left, and
+// returns how many messages went. A failing chatroom does not hold back the others.
+func (j *Janitor) PurgeExpired(ctx context.Context) (int, error) {
+	chatroomIDs, err := j.store.ListPurgeable(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	var errs []error
+	for _, chatroomID := range chatroomIDs {
+		purged, err := j.purgeChatroom(ctx, chatroomID)
+		total += purged
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chatroom %d: %w", chatroomID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return total, errors.Join(errs...)
+}
+
+func (j *Janitor) purgeChatroom(ctx context.Context, chatroomID int) (int, error) {
+	archive := j.config.Action == ActionArchive
+
+	var total int
+	for ctx.Err() == nil {
+		result, err := j.store.PurgeBatch(ctx, chatroomID, j.config.BatchSize, archive)
+		if err != nil {
+			return total, err
+		}
+		if result.Messages == 0 {
+			break
+		}
+
+		metrics.RetentionBatches.Inc()
+		metrics.RetentionMessagesPurged.WithLabelValues(j.config.Action).Add(float64(result.Messages))
+		total += result.Messages
+
+		// The rows are gone, a file left behind only costs disk space
+		for _, key := range result.BlobKeys {
+			if err := j.blobs.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+				slog.ErrorContext(ctx, "Failed to delete attachment blob", "key", key, "error", err)
+			}
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,95 @@
+package retention
+
+import (
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/storage"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	chatroomIDs []int
+	batches     map[int][]repository.PurgeResult
+	failing     map[int]error
+	archived    []bool
+}
+
+func (s *fakeStore) ListPurgeable(context.Context) ([]int, error) {
+	return s.chatroomIDs, nil
+}
+
+func (s *fakeStore) PurgeBatch(_ context.Context, chatroomID, _ int, archive bool) (repository.PurgeResult, error) {
+	s.archived = append(s.archived, archive)
+	if err := s.failing[chatroomID]; err != nil {
+		return repository.PurgeResult{}, err
+	}
+	if len(s.batches[chatroomID]) == 0 {
+		return repository.PurgeResult{}, nil
+	}
+	result := s.batches[chatroomID][0]
+	s.batches[chatroomID] = s.batches[chatroomID][1:]
+	return result, nil
+}
+
+func TestJanitor_PurgeExpired(t *testing.T) {
+	blobs, err := storage.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, blobs.Put(context.Background(), "a.png", strings.NewReader("a")))
+
+	store := &fakeStore{
+		chatroomIDs: []int{1, 2, 3},
+		batches: map[int][]repository.PurgeResult{
+			1: {{Messages: 3, BlobKeys: []string{"a.png", "missing.png"}}, {Messages: 1}},
+			3: {{Messages: 2}},
+		},
+		failing: map[int]error{2: errors.New("connection reset")},
+	}
+	janitor := NewJanitor(store, blobs, Config{Action: ActionDelete, BatchSize: 10})
+
+	purged, err := janitor.PurgeExpired(context.Background())
+	assert.Equal(t, 6, purged)
+	assert.ErrorContains(t, err, "chatroom 2: connection reset")
+
+	_, err = blobs.Open(context.Background(), "a.png")
+	assert.ErrorIs(t, err, storage.ErrBlobNotFound)
+	assert.NotContains(t, store.archived, true)
+}
+
+func TestJanitor_Archive(t *testing.T) {
+	store := &fakeStore{
+		chatroomIDs: []int{1},
+		batches:     map[int][]repository.PurgeResult{1: {{Messages: 4}}},
+	}
+	janitor := NewJanitor(store, nil, Config{Action: ActionArchive, BatchSize: 10})
+
+	purged, err := janitor.PurgeExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, purged)
+	assert.Equal(t, []bool{true, true}, store.archived)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("RETENTION_ACTION", "archive")
+	t.Setenv("RETENTION_INTERVAL", "15m")
+	t.Setenv("RETENTION_BATCH_SIZE", "200")
+
+	config, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, ActionArchive, config.Action)
+	assert.Equal(t, "15m0s", config.Interval.String())
+	assert.Equal(t, 200, config.BatchSize)
+
+	t.Setenv("RETENTION_ACTION", "shred")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("RETENTION_ACTION", "")
+	t.Setenv("RETENTION_INTERVAL", "soon")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
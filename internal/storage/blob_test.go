@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "attachments/abc123", strings.NewReader("file content")))
+
+	reader, err := store.Open(ctx, "attachments/abc123")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "file content", string(content))
+
+	require.NoError(t, store.Delete(ctx, "attachments/abc123"))
+	_, err = store.Open(ctx, "attachments/abc123")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestLocalBlobStore_RejectsPathTraversal(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"../secret", "attachments/../../secret", "/etc/passwd", "", ".hidden"} {
+		err := store.Put(context.Background(), key, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrInvalidBlobKey, key)
+	}
+}
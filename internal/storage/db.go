@@ -1,14 +1,17 @@
 package storage
 
 import (
+	"chat-app/internal/tracing"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq" // Required for the PostgreSQL driver
+	"github.com/lib/pq"
 )
 
 type DB struct {
@@ -16,10 +19,11 @@ type DB struct {
 }
 
 func NewDB(connStr string) (*DB, error) {
-	conn, err := sql.Open("postgres", connStr)
+	connector, err := pq.NewConnector(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
+	conn := sql.OpenDB(tracing.WrapConnector(connector))
 
 	if err := conn.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping the database: %w", err)
@@ -28,6 +32,11 @@ func NewDB(connStr string) (*DB, error) {
 	return &DB{Conn: conn}, nil
 }
 
+// Ping is the readiness check of the database connection
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Conn.PingContext(ctx)
+}
+
 func (db *DB) Close() error {
 	return db.Conn.Close()
 }
@@ -56,3 +65,27 @@ func SetupDatabaseConnection() (*DB, error) {
 
 	return db, nil
 }
+
+// SchemaVersion is the number of the latest migration the code relies on, bump it with every new migration
+const SchemaVersion = 22
+
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+// CheckSchema fails with ErrSchemaOutdated until every migration up to SchemaVersion is applied
+func (db *DB) CheckSchema(ctx context.Context) error {
+	var version int
+	err := db.Conn.QueryRowContext(ctx, `
+        SELECT COALESCE(MAX(version), 0) FROM schema_migrations
+    `).Scan(&version)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" { // undefined_table, from before migration 020
+		version = 0
+	} else if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	if version < SchemaVersion {
+		return fmt.Errorf("%w: at version %d, expected %d", ErrSchemaOutdated, version, SchemaVersion)
+	}
+	return nil
+}
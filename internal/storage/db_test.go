@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB_CheckSchema(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+	db := &DB{Conn: conn}
+
+	query := regexp.QuoteMeta(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SchemaVersion))
+	assert.NoError(t, db.CheckSchema(context.Background()))
+
+	mock.ExpectQuery(query).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SchemaVersion - 1))
+	assert.ErrorIs(t, db.CheckSchema(context.Background()), ErrSchemaOutdated)
+
+	mock.ExpectQuery(query).WillReturnError(&pq.Error{Code: "42P01"})
+	assert.ErrorIs(t, db.CheckSchema(context.Background()), ErrSchemaOutdated)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,155 @@
+package text
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Sharing modes of a text room. Link modes let in any signed-in user who has the room's link, which carries its
+// link key; private rooms only let in the owner and named collaborators.
+const (
+	SharingPrivate      = "private"
+	SharingLinkReadOnly = "link_read_only"
+	SharingLinkEditable = "link_editable"
+)
+
+// Roles of named collaborators
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+)
+
+// Access is what a user may do in a text room, each level includes the ones below
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+	AccessOwner
+)
+
+func (a Access) String() string {
+	switch a {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+var (
+	ErrRoomNotFound = errors.New("text room not found")
+	ErrRoomHasOwner = errors.New("text room already has an owner")
+)
+
+// roomACL is everything access to a room depends on, as seen by one user
+type roomACL struct {
+	OwnerID int // 0 for rooms from before ownership that nobody claimed
+	Sharing string
+	LinkKey string // Empty for rooms from before ownership that nobody claimed
+	Role    string // The user's collaborator role, if any
+}
+
+// access decides what the user may do, linkKey is the key of the link they came with, if any
+func (acl roomACL) access(userID int, linkKey string) Access {
+	if acl.OwnerID != 0 && acl.OwnerID == userID {
+		return AccessOwner
+	}
+
+	access := AccessNone
+	switch acl.Role {
+	case RoleEditor:
+		access = AccessWrite
+	case RoleViewer:
+		access = AccessRead
+	}
+
+	hasLink := acl.LinkKey == "" || subtle.ConstantTimeCompare([]byte(acl.LinkKey), []byte(linkKey)) == 1
+	if hasLink {
+		switch acl.Sharing {
+		case SharingLinkEditable:
+			access = max(access, AccessWrite)
+		case SharingLinkReadOnly:
+			access = max(access, AccessRead)
+		}
+	}
+
+	return access
+}
+
+// Authorize returns what the user may do in the room, or ErrRoomNotFound. Every way of reaching a room's content,
+// including any future realtime channel, goes through it.
+func Authorize(ctx context.Context, db *sql.DB, roomID string, userID int, linkKey string) (Access, error) {
+	var acl roomACL
+	var ownerID sql.NullInt64
+	var storedKey, role sql.NullString
+	err := db.QueryRowContext(ctx, `
+        SELECT r.owner_id, r.sharing, r.link_key, p.role
+        FROM text_rooms r
+        LEFT JOIN text_room_permissions p ON p.room_id = r.room_id AND p.user_id = $2
+        WHERE r.room_id = $1
+    `, roomID, userID).Scan(&ownerID, &acl.Sharing, &storedKey, &role)
+	if err == sql.ErrNoRows {
+		return AccessNone, ErrRoomNotFound
+	} else if err != nil {
+		return AccessNone, fmt.Errorf("failed to fetch room permissions: %w", err)
+	}
+
+	acl.OwnerID = int(ownerID.Int64)
+	acl.LinkKey = storedKey.String
+	acl.Role = role.String
+	return acl.access(userID, linkKey), nil
+}
+
+// ClaimRoom makes the user the owner of a room from before ownership and gives it a link key, so its links stop
+// letting in everyone. It returns ErrRoomNotFound, or ErrRoomHasOwner when the room already belongs to someone.
+func ClaimRoom(ctx context.Context, db *sql.DB, roomID string, ownerID int) error {
+	linkKey, err := newLinkKey()
+	if err != nil {
+		return err
+	}
+
+	var claimed bool
+	err = db.QueryRowContext(ctx, `
+        UPDATE text_rooms
+        SET owner_id = COALESCE(owner_id, $2),
+            link_key = CASE WHEN owner_id IS NULL THEN COALESCE(link_key, $3) ELSE link_key END
+        WHERE room_id = $1
+        RETURNING owner_id = $2
+    `, roomID, ownerID, linkKey).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return ErrRoomNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to claim text room: %w", err)
+	}
+
+	if !claimed {
+		return ErrRoomHasOwner
+	}
+	return nil
+}
+
+func newLinkKey() (string, error) {
+	raw := make([]byte, 18)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate link key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func validSharing(mode string) bool {
+	return mode == SharingPrivate || mode == SharingLinkReadOnly || mode == SharingLinkEditable
+}
+
+func validRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
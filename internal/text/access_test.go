@@ -0,0 +1,56 @@
+package text
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoomACL_Access(t *testing.T) {
+	tests := []struct {
+		name     string
+		acl      roomACL
+		userID   int
+		linkKey  string
+		expected Access
+	}{
+		{"owner", roomACL{OwnerID: 1, Sharing: SharingPrivate, LinkKey: "k"}, 1, "", AccessOwner},
+		{"stranger in a private room", roomACL{OwnerID: 1, Sharing: SharingPrivate, LinkKey: "k"}, 2, "k", AccessNone},
+		{"viewer", roomACL{OwnerID: 1, Sharing: SharingPrivate, LinkKey: "k", Role: RoleViewer}, 2, "", AccessRead},
+		{"editor", roomACL{OwnerID: 1, Sharing: SharingPrivate, LinkKey: "k", Role: RoleEditor}, 2, "", AccessWrite},
+		{"read-only link", roomACL{OwnerID: 1, Sharing: SharingLinkReadOnly, LinkKey: "k"}, 2, "k", AccessRead},
+		{"read-only link, wrong key", roomACL{OwnerID: 1, Sharing: SharingLinkReadOnly, LinkKey: "k"}, 2, "x", AccessNone},
+		{"editable link", roomACL{OwnerID: 1, Sharing: SharingLinkEditable, LinkKey: "k"}, 2, "k", AccessWrite},
+		{"editable link, no key", roomACL{OwnerID: 1, Sharing: SharingLinkEditable, LinkKey: "k"}, 2, "", AccessNone},
+		{"viewer with an editable link", roomACL{OwnerID: 1, Sharing: SharingLinkEditable, LinkKey: "k", Role: RoleViewer}, 2, "k", AccessWrite},
+		{"room from before ownership", roomACL{Sharing: SharingLinkReadOnly}, 2, "", AccessRead},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, test.acl.access(test.userID, test.linkKey))
+		})
+	}
+}
+
+func TestClaimRoom(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	query := regexp.QuoteMeta("UPDATE text_rooms SET owner_id = COALESCE(owner_id, $2)")
+	mock.ExpectQuery(query).WithArgs("legacy", 7, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"claimed"}).AddRow(true))
+	mock.ExpectQuery(query).WithArgs("owned", 7, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"claimed"}).AddRow(false))
+	mock.ExpectQuery(query).WithArgs("missing", 7, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"claimed"}))
+
+	assert.NoError(t, ClaimRoom(context.Background(), db, "legacy", 7))
+	assert.ErrorIs(t, ClaimRoom(context.Background(), db, "owned", 7), ErrRoomHasOwner)
+	assert.ErrorIs(t, ClaimRoom(context.Background(), db, "missing", 7), ErrRoomNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
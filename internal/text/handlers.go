@@ -1,10 +1,15 @@
 package text
 
 import (
+	"chat-app/internal/auth"
 	"chat-app/internal/storage"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,26 +23,77 @@ type TextRoom struct {
 	Mutex   sync.RWMutex
 }
 
+// HandleTextRoom serves /text/<room>, plus /text/<room>/sharing and /text/<room>/collaborators for the owner.
+// It goes behind auth.Middleware. Users who came through a shared link pass its key as ?key=.
 func HandleTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB) {
-	roomID := r.URL.Path[len("/room/"):]
+	userID, ok := r.Context().Value(auth.UserIDKey).(int)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	roomID, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/text/"), "/")
 	if roomID == "" {
 		http.Error(w, "Room ID is required", http.StatusBadRequest)
 		return
 	}
 
+	access, err := Authorize(r.Context(), db.Conn, roomID, userID, r.URL.Query().Get("key"))
+	if err != nil && !errors.Is(err, ErrRoomNotFound) {
+		slog.Error("Failed to authorize text room access", "error", err)
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+		return
+	}
+	exists := err == nil
+
+	switch resource {
+	case "":
+	case "sharing", "collaborators":
+		// Rooms the user cannot see look the same as rooms that do not exist
+		if !exists || access == AccessNone {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if access != AccessOwner {
+			http.Error(w, "Only the owner can change who has access", http.StatusForbidden)
+			return
+		}
+		if resource == "sharing" {
+			handleSharing(w, r, db, roomID)
+		} else {
+			handleCollaborators(w, r, db, roomID)
+		}
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		handleGetTextRoom(w, r, db, roomID)
+		if !exists || access == AccessNone {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		handleGetTextRoom(w, r, db, roomID, access)
 	case http.MethodPost:
-		handlePostTextRoom(w, r, db, roomID)
+		if exists && access == AccessNone {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		if exists && access < AccessWrite {
+			http.Error(w, "You can only read this room", http.StatusForbidden)
+			return
+		}
+		handlePostTextRoom(w, r, db, roomID, userID, !exists)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 
-	// TODO: Add Websocket support
+	// TODO: Add Websocket support, connections must be authorized with Authorize like the requests above
 }
 
-func handleGetTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string) {
+func handleGetTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string, access Access) {
 	var content string
 	err := db.Conn.QueryRow("SELECT content FROM text_rooms WHERE room_id = $1 ORDER BY created_at DESC LIMIT 1", roomID).Scan(&content)
 	if err != nil {
@@ -46,18 +102,26 @@ func handleGetTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB, r
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"content": content})
+	json.NewEncoder(w).Encode(map[string]string{"content": content, "access": access.String()})
 }
 
-// TODO: Add some safety rules along with limitations to prevent abuse
-func handlePostTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string) {
+// MaxContentBytes caps the size of a text room, requests are rate limited by the server in front of the handler
+const MaxContentBytes = 256 << 10
+
+// handlePostTextRoom saves new content, creating the room owned by the user when it does not exist yet
+func handlePostTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string, userID int, creating bool) {
 	var msg struct {
 		NewContent string `json:"content"`
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxContentBytes+1024) // Leave room for the JSON envelope and escaping
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if len(msg.NewContent) > MaxContentBytes {
+		http.Error(w, "Content is too long", http.StatusRequestEntityTooLarge)
+		return
+	}
 
 	tx, err := db.Conn.Begin()
 	if err != nil {
@@ -67,15 +131,22 @@ func handlePostTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB,
 
 	var oldContent string
 	var oldTimestamp time.Time
-	err = tx.QueryRow("SELECT content, updated_at FROM text_rooms WHERE room_id = $1", roomID).Scan(&oldContent, &oldTimestamp)
+	err = tx.QueryRow("SELECT content, updated_at FROM text_rooms WHERE room_id = $1 FOR UPDATE", roomID).Scan(&oldContent, &oldTimestamp)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Room not found, insert new record
+			linkKey, err := newLinkKey()
+			if err != nil {
+				tx.Rollback()
+				http.Error(w, "Failed to create new room", http.StatusInternalServerError)
+				return
+			}
+
 			_, err = tx.Exec(`
 				INSERT INTO text_rooms 
-				    (room_id, content, content_history) 
-				VALUES ($1, $2, $3)
-			`, roomID, msg.NewContent, "[]")
+				    (room_id, content, content_history, owner_id, sharing, link_key) 
+				VALUES ($1, $2, $3, $4, $5, $6)
+			`, roomID, msg.NewContent, "[]", userID, SharingPrivate, linkKey)
 			if err != nil {
 				tx.Rollback()
 				http.Error(w, "Failed to create new room", http.StatusInternalServerError)
@@ -86,6 +157,11 @@ func handlePostTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB,
 			http.Error(w, "Failed to query room", http.StatusInternalServerError)
 			return
 		}
+	} else if creating {
+		// Someone else created the room since access was checked
+		tx.Rollback()
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
 	} else {
 		// Room found, update existing record
 		historyEntry := map[string]interface{}{
@@ -122,3 +198,160 @@ func handlePostTextRoom(w http.ResponseWriter, r *http.Request, db *storage.DB,
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+type collaborator struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type sharingSettings struct {
+	Sharing       string         `json:"sharing"`
+	LinkKey       string         `json:"link_key"`
+	Collaborators []collaborator `json:"collaborators"`
+}
+
+// handleSharing shows the room's sharing settings on GET, and changes the mode on PUT. Setting rotate_link_key
+// replaces the link key, which revokes every link handed out so far.
+func handleSharing(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Sharing       string `json:"sharing"`
+			RotateLinkKey bool   `json:"rotate_link_key"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validSharing(req.Sharing) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var linkKey sql.NullString
+		if req.RotateLinkKey {
+			key, err := newLinkKey()
+			if err != nil {
+				http.Error(w, "Failed to update sharing", http.StatusInternalServerError)
+				return
+			}
+			linkKey = sql.NullString{String: key, Valid: true}
+		}
+
+		_, err := db.Conn.ExecContext(r.Context(), `
+			UPDATE text_rooms
+			SET sharing = $2, link_key = COALESCE($3, link_key)
+			WHERE room_id = $1
+		`, roomID, req.Sharing, linkKey)
+		if err != nil {
+			http.Error(w, "Failed to update sharing", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings, err := loadSharing(r.Context(), db.Conn, roomID)
+	if err != nil {
+		http.Error(w, "Failed to fetch sharing", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// handleCollaborators adds a collaborator or changes their role on PUT, and removes them on DELETE
+func handleCollaborators(w http.ResponseWriter, r *http.Request, db *storage.DB, roomID string) {
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var result sql.Result
+	var err error
+	switch r.Method {
+	case http.MethodPut:
+		if !validRole(req.Role) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		result, err = db.Conn.ExecContext(r.Context(), `
+			INSERT INTO text_room_permissions (room_id, user_id, role)
+			SELECT $1, u.id, $3
+			FROM users u
+			JOIN text_rooms t ON t.room_id = $1
+			WHERE lower(u.username) = lower($2) AND u.id <> t.owner_id
+			ON CONFLICT (room_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		`, roomID, req.Username, req.Role)
+	case http.MethodDelete:
+		result, err = db.Conn.ExecContext(r.Context(), `
+			DELETE FROM text_room_permissions p
+			USING users u
+			WHERE p.room_id = $1 AND p.user_id = u.id AND lower(u.username) = lower($2)
+		`, roomID, req.Username)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update collaborators", http.StatusInternalServerError)
+		return
+	}
+	if changed, err := result.RowsAffected(); err != nil {
+		http.Error(w, "Failed to update collaborators", http.StatusInternalServerError)
+		return
+	} else if changed == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := loadSharing(r.Context(), db.Conn, roomID)
+	if err != nil {
+		http.Error(w, "Failed to fetch sharing", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func loadSharing(ctx context.Context, db *sql.DB, roomID string) (sharingSettings, error) {
+	var settings sharingSettings
+	var linkKey sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT sharing, link_key
+		FROM text_rooms
+		WHERE room_id = $1
+	`, roomID).Scan(&settings.Sharing, &linkKey)
+	if err != nil {
+		return sharingSettings{}, err
+	}
+	settings.LinkKey = linkKey.String
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT p.user_id, u.username, p.role
+		FROM text_room_permissions p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.room_id = $1
+		ORDER BY u.username
+	`, roomID)
+	if err != nil {
+		return sharingSettings{}, err
+	}
+	defer rows.Close()
+
+	settings.Collaborators = []collaborator{}
+	for rows.Next() {
+		var c collaborator
+		if err := rows.Scan(&c.UserID, &c.Username, &c.Role); err != nil {
+			return sharingSettings{}, err
+		}
+		settings.Collaborators = append(settings.Collaborators, c)
+	}
+
+	return settings, rows.Err()
+}
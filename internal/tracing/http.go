@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"chat-app/internal/utils"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for every request, continuing the trace of the caller when the request carries a
+// traceparent header. The span is named after the ServeMux pattern the request matched, the mux records it on the
+// request it is given so next must pass the request on unchanged. The pattern is copied back onto the request this
+// middleware was given, for the ones in front of it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		// The path is left out, it can carry secrets such as incoming webhook tokens, the route names the request instead
+		ctx, span := Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method)),
+		)
+		defer span.End()
+
+		recorder := utils.NewStatusRecorder(w)
+		req := r.WithContext(ctx)
+		next.ServeHTTP(recorder, req)
+
+		r.Pattern = req.Pattern
+		if r.Pattern != "" {
+			span.SetName(r.Method + " " + r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.Status))
+		if recorder.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.Status))
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"runtime"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	modulePrefix   = "chat-app/"
+	tracingPackage = "chat-app/internal/tracing."
+)
+
+// WrapConnector traces the statements run through the connector's connections. Each span is named after the
+// function that ran the statement, like 'repository.MessageRepository.GetMessages', so traces read like the code.
+// Statements run through prepared statements are not traced, the repositories do not use them.
+func WrapConnector(connector driver.Connector) driver.Connector {
+	return tracedConnector{connector}
+}
+
+type tracedConnector struct {
+	driver.Connector
+}
+
+func (c tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn}, nil
+}
+
+// tracedConn passes everything through to the driver's connection. Optional interfaces the driver lacks answer
+// driver.ErrSkip, or their neutral value, so database/sql falls back as it would with the bare connection.
+type tracedConn struct {
+	driver.Conn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startStatement(ctx, query)
+	defer span.End()
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	endStatement(span, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startStatement(ctx, query)
+	defer span.End()
+
+	result, err := execer.ExecContext(ctx, query, args)
+	endStatement(span, err)
+	return result, err
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin() // What database/sql does for drivers without BeginTx
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// startStatement only walks the call stack for the span's name when the span is sampled, it is too slow for every
+// statement
+func startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	ctx, span := Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient))
+	if span.IsRecording() {
+		span.SetName(callerName())
+		span.SetAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBQueryText(strings.TrimSpace(query)),
+		)
+	}
+	return ctx, span
+}
+
+func endStatement(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) {
+		RecordError(span, err)
+	}
+}
+
+// callerName names the span after the application function that ran the statement, the first one on the call stack
+func callerName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, modulePrefix) && !strings.HasPrefix(frame.Function, tracingPackage) {
+			// Functions are listed as 'chat-app/internal/chat/repository.(*MessageRepository).GetMessages', closures
+			// with a '.func1' suffix
+			name := frame.Function[strings.LastIndex(frame.Function, "/")+1:]
+			name, _, _ = strings.Cut(name, ".func")
+			return strings.NewReplacer("(*", "", ")", "").Replace(name)
+		}
+		if !more {
+			return "db.query"
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tracing_test
+
+import (
+	"chat-app/internal/tracing"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Failed", http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/rooms/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tracing.Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /rooms/{id}", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	for _, attr := range spans[0].Attributes() {
+		assert.NotEqual(t, "url.path", string(attr.Key), "the path can carry secrets")
+	}
+}
+
+// dsnConnector opens the sqlmock driver the way pq.NewConnector opens PostgreSQL
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+func TestWrapConnector(t *testing.T) {
+	recorder := recordSpans(t)
+
+	mockDB, mock, err := sqlmock.NewWithDSN("traced", sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	db := sql.OpenDB(tracing.WrapConnector(dsnConnector{dsn: "traced", driver: mockDB.Driver()}))
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT name FROM Chatrooms WHERE id = $1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("general"))
+	mock.ExpectExec("DELETE FROM Chatrooms WHERE id = $1").
+		WithArgs(7).
+		WillReturnError(sql.ErrConnDone)
+
+	var name string
+	require.NoError(t, db.QueryRowContext(context.Background(), "SELECT name FROM Chatrooms WHERE id = $1", 7).Scan(&name))
+	assert.Equal(t, "general", name)
+	_, err = db.ExecContext(context.Background(), "DELETE FROM Chatrooms WHERE id = $1", 7)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "tracing_test.TestWrapConnector", spans[0].Name())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
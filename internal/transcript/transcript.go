@@ -0,0 +1,232 @@
+package transcript
+
+import (
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/markup"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format, expected json, csv or html")
+
+// Header describes the transcript, it comes before the messages in every format
+type Header struct {
+	ChatroomID   int        `json:"chatroom_id"`
+	ChatroomName string     `json:"chatroom_name"`
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	ExportedAt   time.Time  `json:"exported_at"`
+}
+
+// Writer writes a transcript one message at a time. Close completes the document, a transcript that was not closed is
+// truncated and, for JSON and HTML, not well-formed.
+type Writer interface {
+	WriteMessage(msg repository.ExportedMessage) error
+	Close() error
+}
+
+// Format is an export format, with what the HTTP response needs to know about it
+type Format struct {
+	Name        string
+	ContentType string
+	newWriter   func(w io.Writer, header Header) (Writer, error)
+}
+
+var formats = map[string]Format{
+	FormatJSON: {FormatJSON, "application/json", newJSONWriter},
+	FormatCSV:  {FormatCSV, "text/csv; charset=utf-8", newCSVWriter},
+	FormatHTML: {FormatHTML, "text/html; charset=utf-8", newHTMLWriter},
+}
+
+func Lookup(name string) (Format, error) {
+	format, ok := formats[name]
+	if !ok {
+		return Format{}, ErrUnknownFormat
+	}
+	return format, nil
+}
+
+// NewWriter writes the header of the transcript to w and returns the writer for its messages
+func (f Format) NewWriter(w io.Writer, header Header) (Writer, error) {
+	return f.newWriter(w, header)
+}
+
+// Filename is the suggested name of the downloaded transcript
+func (f Format) Filename(header Header) string {
+	return fmt.Sprintf("chatroom-%d-%s.%s", header.ChatroomID, header.ExportedAt.UTC().Format("20060102-150405"), f.Name)
+}
+
+// jsonWriter writes {"chatroom_id": ..., "messages": [...]} with one message per line
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONWriter(w io.Writer, header Header) (Writer, error) {
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	// The header object stays open for the messages array
+	encoded = append(encoded[:len(encoded)-1], `,"messages":[`...)
+	if _, err := w.Write(encoded); err != nil {
+		return nil, err
+	}
+	return &jsonWriter{w: w}, nil
+}
+
+func (j *jsonWriter) WriteMessage(msg repository.ExportedMessage) error {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if j.count == 0 {
+		separator = "\n"
+	}
+	j.count++
+	_, err = io.WriteString(j.w, separator+string(encoded))
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	_, err := io.WriteString(j.w, "\n]}\n")
+	return err
+}
+
+// csvWriter writes a header row then one row per message, attachments are listed in a single column
+type csvWriter struct {
+	w *csv.Writer
+}
+
+var csvColumns = []string{"id", "timestamp", "parent_id", "user_id", "username", "is_bot", "content", "attachments"}
+
+func newCSVWriter(w io.Writer, _ Header) (Writer, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: writer}, nil
+}
+
+func (c *csvWriter) WriteMessage(msg repository.ExportedMessage) error {
+	parentID := ""
+	if msg.ParentID != nil {
+		parentID = strconv.Itoa(*msg.ParentID)
+	}
+
+	attachments := make([]string, len(msg.Attachments))
+	for i, attachment := range msg.Attachments {
+		attachments[i] = attachment.Filename + " <" + attachment.URL + ">"
+	}
+
+	return c.w.Write([]string{
+		strconv.Itoa(msg.ID),
+		msg.Timestamp.UTC().Format(time.RFC3339),
+		parentID,
+		strconv.Itoa(msg.UserID),
+		csvSafe(msg.Username),
+		strconv.FormatBool(msg.IsBot),
+		csvSafe(msg.Content),
+		csvSafe(strings.Join(attachments, "; ")),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe keeps spreadsheets from evaluating user text as a formula by prefixing it with a quote
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+var htmlTemplates = template.Must(template.New("transcript").Parse(`
+{{- define "header" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.ChatroomName}} transcript</title>
+<style>
+body { font-family: sans-serif; max-width: 50rem; margin: 2rem auto; color: #222; }
+article { padding: .5rem 0; border-bottom: 1px solid #eee; }
+article.reply { margin-left: 2rem; }
+header { font-size: .85rem; color: #666; }
+.author { font-weight: bold; color: #222; }
+.bot { font-size: .75rem; padding: 0 .3rem; border: 1px solid #999; border-radius: .2rem; }
+.content { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.ChatroomName}}</h1>
+<p>Chatroom {{.ChatroomID}}, exported {{.ExportedAt.UTC.Format "2006-01-02 15:04:05 UTC"}}
+{{- with .From}}, messages from {{.UTC.Format "2006-01-02 15:04:05"}}{{end}}
+{{- with .To}}, until {{.UTC.Format "2006-01-02 15:04:05"}}{{end}}</p>
+{{end}}
+
+{{- define "message" -}}
+<article id="m{{.ID}}"{{if .ParentID}} class="reply"{{end}}>
+<header><span class="author">{{.Username}}</span>{{if .IsBot}} <span class="bot">bot</span>{{end}}
+<time datetime="{{.Timestamp.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.Timestamp.UTC.Format "2006-01-02 15:04:05"}}</time>
+{{- with .ParentID}} in reply to <a href="#m{{.}}">#{{.}}</a>{{end}}</header>
+<div class="content">{{.Content}}</div>
+{{- with .Attachments}}
+<ul class="attachments">
+{{- range .}}
+<li><a href="{{.URL}}">{{.Filename}}</a> ({{.ContentType}}, {{.SizeBytes}} bytes)</li>
+{{- end}}
+</ul>
+{{- end}}
+</article>
+{{end}}`))
+
+type htmlWriter struct {
+	w io.Writer
+}
+
+func newHTMLWriter(w io.Writer, header Header) (Writer, error) {
+	if err := htmlTemplates.ExecuteTemplate(w, "header", header); err != nil {
+		return nil, err
+	}
+	return &htmlWriter{w: w}, nil
+}
+
+// WriteMessage renders the formatted content when the message has one, the raw content as escaped text otherwise
+func (h *htmlWriter) WriteMessage(msg repository.ExportedMessage) error {
+	var content interface{} = msg.Content
+	if len(msg.Formatted) > 0 {
+		var doc markup.Document
+		if err := json.Unmarshal(msg.Formatted, &doc); err == nil {
+			content = template.HTML(markup.RenderHTML(doc.Nodes))
+		}
+	}
+
+	return htmlTemplates.ExecuteTemplate(h.w, "message", struct {
+		repository.ExportedMessage
+		Content interface{}
+	}{msg, content})
+}
+
+func (h *htmlWriter) Close() error {
+	_, err := io.WriteString(h.w, "</body>\n</html>\n")
+	return err
+}
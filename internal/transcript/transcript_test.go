@@ -0,0 +1,122 @@
+package transcript
+
+import (
+	"bytes"
+	"chat-app/internal/chat/repository"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testHeader = Header{
+		ChatroomID:   3,
+		ChatroomName: "general",
+		ExportedAt:   time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+	parentID     = 1
+	testMessages = []repository.ExportedMessage{
+		{
+			ID:        1,
+			UserID:    7,
+			Username:  "alice",
+			Content:   "Hello **world** <script>",
+			Formatted: json.RawMessage(`{"nodes":[{"type":"text","text":"Hello "},{"type":"bold","children":[{"type":"text","text":"world"}]},{"type":"text","text":" <script>"}]}`),
+			Timestamp: time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC),
+			Attachments: []repository.ExportedAttachment{
+				{ID: 4, Filename: "report.pdf", ContentType: "application/pdf", SizeBytes: 2048, URL: "/chatroom/attachment?id=4"},
+			},
+		},
+		{
+			ID:        2,
+			ParentID:  &parentID,
+			UserID:    9,
+			Username:  "deploy-hook",
+			IsBot:     true,
+			Content:   "=HYPERLINK(\"http://example.com\")",
+			Timestamp: time.Date(2026, 10, 1, 9, 31, 0, 0, time.UTC),
+		},
+	}
+)
+
+func writeTranscript(t *testing.T, formatName string) string {
+	format, err := Lookup(formatName)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writer, err := format.NewWriter(&buf, testHeader)
+	require.NoError(t, err)
+	for _, msg := range testMessages {
+		require.NoError(t, writer.WriteMessage(msg))
+	}
+	require.NoError(t, writer.Close())
+	return buf.String()
+}
+
+func TestLookup(t *testing.T) {
+	format, err := Lookup(FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv; charset=utf-8", format.ContentType)
+	assert.Equal(t, "chatroom-3-20261019-120000.csv", format.Filename(testHeader))
+
+	_, err = Lookup("xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
+
+func TestJSONWriter(t *testing.T) {
+	var transcript struct {
+		Header
+		Messages []repository.ExportedMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(writeTranscript(t, FormatJSON)), &transcript))
+
+	assert.Equal(t, testHeader, transcript.Header)
+	require.Len(t, transcript.Messages, 2)
+	assert.Equal(t, "alice", transcript.Messages[0].Username)
+	assert.Equal(t, "/chatroom/attachment?id=4", transcript.Messages[0].Attachments[0].URL)
+	assert.True(t, transcript.Messages[1].IsBot)
+	assert.Equal(t, &parentID, transcript.Messages[1].ParentID)
+}
+
+func TestJSONWriter_Empty(t *testing.T) {
+	format, err := Lookup(FormatJSON)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writer, err := format.NewWriter(&buf, testHeader)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	var transcript map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &transcript))
+	assert.Equal(t, []interface{}{}, transcript["messages"])
+}
+
+func TestCSVWriter(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(writeTranscript(t, FormatCSV))).ReadAll()
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{
+		csvColumns,
+		{"1", "2026-10-01T09:30:00Z", "", "7", "alice", "false", "Hello **world** <script>", "report.pdf </chatroom/attachment?id=4>"},
+		{"2", "2026-10-01T09:31:00Z", "1", "9", "deploy-hook", "true", "'=HYPERLINK(\"http://example.com\")", ""},
+	}, records)
+}
+
+func TestHTMLWriter(t *testing.T) {
+	document := writeTranscript(t, FormatHTML)
+
+	assert.Contains(t, document, "<title>general transcript</title>")
+	assert.Contains(t, document, `<div class="content">Hello <strong>world</strong> &lt;script&gt;</div>`)
+	assert.NotContains(t, document, "<script>")
+	assert.Contains(t, document, `<a href="/chatroom/attachment?id=4">report.pdf</a>`)
+	assert.Contains(t, document, `<article id="m2" class="reply">`)
+	assert.Contains(t, document, `in reply to <a href="#m1">#1</a>`)
+	assert.Contains(t, document, `<span class="bot">bot</span>`)
+	assert.True(t, strings.HasSuffix(document, "</body>\n</html>\n"))
+}
@@ -0,0 +1,364 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// MaxURLsPerMessage caps how many links of a single message get a preview
+	MaxURLsPerMessage = 3
+
+	fetchTimeout      = 5 * time.Second
+	maxBodyBytes      = 1 << 20 // Only the head of the page matters, 1 MiB is plenty
+	maxRedirects      = 3
+	maxURLLength      = 2048
+	maxTitleLength    = 200
+	maxDescriptionLen = 500
+	cacheTTL          = 6 * time.Hour
+	failureCacheTTL   = 10 * time.Minute
+	maxCacheEntries   = 10_000
+	userAgent         = "chat-app-link-preview/1.0"
+)
+
+var (
+	ErrInvalidURL     = errors.New("invalid url")
+	ErrBlockedAddress = errors.New("destination address is not allowed")
+	ErrNotHTML        = errors.New("response is not an HTML page")
+
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+	// Ranges that are not covered by the net.IP helpers but must never be reached from the server either
+	blockedNetworks = mustParseCIDRs(
+		"0.0.0.0/8",     // "This" network
+		"100.64.0.0/10", // Carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // Benchmarking
+		"240.0.0.0/4",   // Reserved
+		"64:ff9b::/96",  // NAT64, could be mapped to an internal IPv4 address
+		"2001:db8::/32", // Documentation
+	)
+)
+
+// Preview is what a client needs to render a link card
+type Preview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// ExtractURLs returns the distinct http(s) links found in a message, in order of appearance
+func ExtractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}'")
+		if seen[match] || len(match) > maxURLLength {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == MaxURLsPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+type cacheEntry struct {
+	preview   Preview
+	err       error
+	expiresAt time.Time
+}
+
+// Fetcher downloads pages and extracts their OpenGraph/meta tags. It only connects to public addresses, checked when
+// dialing so DNS rebinding and redirects cannot reach internal services, and caches results in memory.
+type Fetcher struct {
+	client     *http.Client
+	allowLocal bool // Lets tests reach httptest servers, which listen on a random loopback port
+
+	cacheMutex sync.Mutex
+	cache      map[string]cacheEntry
+}
+
+func NewFetcher() *Fetcher {
+	f := &Fetcher{cache: make(map[string]cacheEntry)}
+
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return f.checkAddress(address)
+		},
+	}
+
+	f.client = &http.Client{
+		Timeout: fetchTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil, // A proxy would make the dial checks meaningless
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   fetchTimeout,
+			ResponseHeaderTimeout: fetchTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return f.validateURL(req.URL)
+		},
+	}
+
+	return f
+}
+
+func (f *Fetcher) checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || (!f.allowLocal && !IsPublicIP(ip)) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// IsPublicIP reports whether the address is globally routable
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateURL only lets http(s) URLs on the default ports through, credentials in URLs are refused
+func (f *Fetcher) validateURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidURL
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	if port := u.Port(); !f.allowLocal && port != "" && port != "80" && port != "443" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// Fetch returns the preview of a page, results (including failures) are cached for a while
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	if entry, ok := f.cached(rawURL); ok {
+		return entry.preview, entry.err
+	}
+
+	preview, err := f.fetch(ctx, rawURL)
+
+	ttl := cacheTTL
+	if err != nil {
+		ttl = failureCacheTTL
+	}
+	f.store(rawURL, cacheEntry{preview: preview, err: err, expiresAt: time.Now().Add(ttl)})
+
+	return preview, err
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string) (Preview, error) {
+	if len(rawURL) > maxURLLength {
+		return Preview{}, ErrInvalidURL
+	}
+
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, ErrInvalidURL
+	}
+	if err := f.validateURL(pageURL); err != nil {
+		return Preview{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return Preview{}, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("failed to fetch %s: status %d", rawURL, resp.StatusCode)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	preview := parsePreview(io.LimitReader(resp.Body, maxBodyBytes), resp.Request.URL)
+	preview.URL = rawURL
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, fmt.Errorf("no preview data found for %s", rawURL)
+	}
+
+	return preview, nil
+}
+
+func (f *Fetcher) cached(rawURL string) (cacheEntry, bool) {
+	f.cacheMutex.Lock()
+	defer f.cacheMutex.Unlock()
+
+	entry, ok := f.cache[rawURL]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (f *Fetcher) store(rawURL string, entry cacheEntry) {
+	f.cacheMutex.Lock()
+	defer f.cacheMutex.Unlock()
+
+	if len(f.cache) >= maxCacheEntries {
+		now := time.Now()
+		for key, cached := range f.cache {
+			if now.After(cached.expiresAt) {
+				delete(f.cache, key)
+			}
+		}
+		// Still full of live entries, drop an arbitrary one rather than growing without bound
+		for key := range f.cache {
+			if len(f.cache) < maxCacheEntries {
+				break
+			}
+			delete(f.cache, key)
+		}
+	}
+
+	f.cache[rawURL] = entry
+}
+
+// parsePreview reads the <head> of a page, OpenGraph tags win over Twitter cards which win over plain HTML tags
+func parsePreview(r io.Reader, pageURL *url.URL) Preview {
+	meta := make(map[string]string)
+	var title string
+
+	tokenizer := html.NewTokenizer(r)
+tokens:
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		if tokenType == html.EndTagToken && token.Data == "head" {
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		switch token.Data {
+		case "body":
+			break tokens
+		case "title":
+			if title == "" && tokenizer.Next() == html.TextToken {
+				title = string(tokenizer.Text())
+			}
+		case "meta":
+			var key, content string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "property", "name":
+					key = strings.ToLower(attr.Val)
+				case "content":
+					content = attr.Val
+				}
+			}
+			if _, exists := meta[key]; key != "" && content != "" && !exists {
+				meta[key] = content
+			}
+		}
+	}
+
+	first := func(values ...string) string {
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	return Preview{
+		Title:       truncate(first(meta["og:title"], meta["twitter:title"], title), maxTitleLength),
+		Description: truncate(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLen),
+		ImageURL:    resolveImageURL(pageURL, first(meta["og:image"], meta["og:image:url"], meta["twitter:image"])),
+		SiteName:    truncate(first(meta["og:site_name"], pageURL.Hostname()), maxTitleLength),
+	}
+}
+
+// resolveImageURL makes relative image URLs absolute and drops anything that is not http(s)
+func resolveImageURL(pageURL *url.URL, raw string) string {
+	if raw == "" {
+		return ""
+	}
+
+	imageURL, err := pageURL.Parse(raw)
+	if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || len(imageURL.String()) > maxURLLength {
+		return ""
+	}
+
+	return imageURL.String()
+}
+
+func truncate(s string, maxRunes int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxRunes-1]) + "…"
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -1,8 +1,9 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 )
 
@@ -10,17 +11,41 @@ import (
 func Atoi(s string) (int, error) {
 	i, err := strconv.Atoi(s)
 	if err != nil {
-		log.Println("Failed to convert string to integer:", err)
+		slog.Debug("Failed to convert string to integer", "error", err)
 		return 0, err
 	}
 	return i, nil
 }
 
+// GetEnv returns the value of an environment variable, or the fallback when it is unset or empty.
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// GetEnvInt is GetEnv for integer settings, invalid values are logged and replaced by the fallback.
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid setting, using the default", "key", key, "default", fallback, "error", err)
+		return fallback
+	}
+	return i
+}
+
 func CorsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, traceparent, tracestate")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Content-Disposition")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"bytes"
+	"chat-app/internal/chat/repository"
+	"chat-app/internal/unfurl"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Event types a webhook can subscribe to
+const (
+	EventMessageCreated  = "message.created"
+	EventMessageDeleted  = "message.deleted"
+	EventMemberJoined    = "member.joined"
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+)
+
+// Headers of every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is given up
+	MaxAttempts = 8
+	// DisableAfterFailures is how many consecutive failed attempts disable a webhook
+	DisableAfterFailures = 20
+
+	baseBackoff     = 30 * time.Second
+	maxBackoff      = time.Hour
+	deliveryTimeout = 10 * time.Second
+	claimBatchSize  = 20
+	claimLease      = time.Minute
+	maxURLLength    = 2048
+	maxErrorLength  = 500
+	userAgent       = "chat-app-webhooks/1.0"
+)
+
+var (
+	ErrInvalidURL     = errors.New("webhook url must be an absolute http(s) url without credentials")
+	ErrInvalidEvents  = errors.New("unknown or missing webhook events")
+	ErrBlockedAddress = errors.New("webhook destination address is not allowed")
+
+	events = map[string]bool{
+		EventMessageCreated:  true,
+		EventMessageDeleted:  true,
+		EventMemberJoined:    true,
+		EventReactionAdded:   true,
+		EventReactionRemoved: true,
+	}
+)
+
+// Envelope is the JSON body of a delivery
+type Envelope struct {
+	Type       string      `json:"type"`
+	ChatroomID int         `json:"chatroom_id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+// ValidateURL checks the shape of a webhook URL, the destination address is checked again on every delivery
+func ValidateURL(raw string) error {
+	if len(raw) > maxURLLength {
+		return ErrInvalidURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// ValidateEvents requires at least one event, all of them known
+func ValidateEvents(eventTypes []string) error {
+	if len(eventTypes) == 0 {
+		return ErrInvalidEvents
+	}
+	for _, eventType := range eventTypes {
+		if !events[eventType] {
+			return fmt.Errorf("%w: %s", ErrInvalidEvents, eventType)
+		}
+	}
+	return nil
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign computes the signature header value of a delivery body
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is what receivers run to check a delivery, in constant time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff is the delay before the next try of a delivery that failed 'attempts' times: 30s, 1m, 2m... up to an hour
+func Backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// Store is the persistent delivery queue
+type Store interface {
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]repository.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, attempt repository.DeliveryAttempt, disableAfter int) (bool, error)
+}
+
+// Dispatcher sends queued deliveries. Like link previews, it only connects to public addresses, checked when dialing.
+type Dispatcher struct {
+	store      Store
+	client     *http.Client
+	allowLocal bool // Lets tests reach httptest servers
+	now        func() time.Time
+}
+
+func NewDispatcher(store Store) *Dispatcher {
+	d := &Dispatcher{store: store, now: time.Now}
+
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			return d.checkAddress(address)
+		},
+	}
+
+	d.client = &http.Client{
+		Timeout: deliveryTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   deliveryTimeout,
+			ResponseHeaderTimeout: deliveryTimeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		// A redirect is a failed delivery, following it would sign a request to another destination
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return d
+}
+
+func (d *Dispatcher) checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || (!d.allowLocal && !unfurl.IsPublicIP(ip)) {
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// Run delivers due deliveries every interval until the context is cancelled
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			// Keep going while full batches come back, there is a backlog
+			sent, err := d.DeliverDue(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "Webhook dispatch error", "error", err)
+			}
+			if err != nil || sent < claimBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and records their outcome, it returns how many were attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.store.ClaimDueDeliveries(ctx, claimBatchSize, claimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		attempt := d.deliver(ctx, delivery)
+
+		disabled, err := d.store.RecordAttempt(ctx, attempt, DisableAfterFailures)
+		if err != nil {
+			return 0, err
+		}
+		if disabled {
+			slog.WarnContext(ctx, "Webhook disabled after consecutive failures", "webhook_id", delivery.WebhookID, "failures", DisableAfterFailures)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery repository.WebhookDelivery) repository.DeliveryAttempt {
+	attempt := repository.DeliveryAttempt{DeliveryID: delivery.ID, WebhookID: delivery.WebhookID}
+
+	status, err := d.send(ctx, delivery)
+	attempt.ResponseStatus = status
+	if err == nil {
+		attempt.Succeeded = true
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	if len(attempt.Error) > maxErrorLength {
+		attempt.Error = attempt.Error[:maxErrorLength]
+	}
+	if attempts := delivery.Attempts + 1; attempts < MaxAttempts {
+		attempt.NextAttemptAt = d.now().Add(Backoff(attempts))
+	}
+
+	return attempt
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery repository.WebhookDelivery) (int, error) {
+	if err := ValidateURL(delivery.URL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, ErrInvalidURL
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// NewEnvelope encodes the body of an event delivery
+func NewEnvelope(eventType string, chatroomID int, data interface{}) (json.RawMessage, error) {
+	body, err := json.Marshal(Envelope{
+		Type:       eventType,
+		ChatroomID: chatroomID,
+		CreatedAt:  time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook event: %w", err)
+	}
+	return body, nil
+}
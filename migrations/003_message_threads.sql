@@ -0,0 +1,7 @@
+ALTER TABLE Messages
+    ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES Messages(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS reply_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_reply_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON Messages (parent_id, id);
+CREATE INDEX IF NOT EXISTS idx_messages_chatroom_roots ON Messages (chatroom_id, timestamp DESC) WHERE parent_id IS NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS chatroom_members (
+    chatroom_id INT NOT NULL,
+    user_id INT NOT NULL,
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chatroom_id, user_id),
+    FOREIGN KEY (chatroom_id) REFERENCES Chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_chatroom_members_user_id ON chatroom_members (user_id);
+
+-- Everyone who already posted in a room is considered a member of it
+INSERT INTO chatroom_members (chatroom_id, user_id)
+SELECT DISTINCT chatroom_id, user_id FROM Messages
+ON CONFLICT DO NOTHING;
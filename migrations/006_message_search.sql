@@ -0,0 +1,17 @@
+ALTER TABLE Messages ADD COLUMN IF NOT EXISTS content_tsv TSVECTOR;
+
+UPDATE Messages SET content_tsv = to_tsvector('english', content) WHERE content_tsv IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_content_tsv ON Messages USING GIN (content_tsv);
+
+CREATE OR REPLACE FUNCTION messages_content_tsv_update() RETURNS trigger AS $$
+BEGIN
+    NEW.content_tsv := to_tsvector('english', NEW.content);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS messages_content_tsv_trigger ON Messages;
+CREATE TRIGGER messages_content_tsv_trigger
+    BEFORE INSERT OR UPDATE OF content ON Messages
+    FOR EACH ROW EXECUTE FUNCTION messages_content_tsv_update();
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS room_read_state (
+    user_id INT NOT NULL,
+    chatroom_id INT NOT NULL,
+    last_read_message_id INT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, chatroom_id),
+    FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE,
+    FOREIGN KEY (chatroom_id) REFERENCES Chatrooms(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_read_state_chatroom_id ON room_read_state (chatroom_id);
+CREATE INDEX IF NOT EXISTS idx_messages_chatroom_id_id ON Messages (chatroom_id, id);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id SERIAL PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    uploader_id INT NOT NULL,
+    message_id INT,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(127) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INT,
+    height INT,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (chatroom_id) REFERENCES Chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (uploader_id) REFERENCES Users(id),
+    FOREIGN KEY (message_id) REFERENCES Messages(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments (message_id);
@@ -0,0 +1 @@
+ALTER TABLE Messages ADD COLUMN IF NOT EXISTS link_previews JSONB;
@@ -0,0 +1 @@
+ALTER TABLE Messages ADD COLUMN IF NOT EXISTS formatted JSONB;
@@ -0,0 +1,36 @@
+-- Integrations post as bot users, which have no usable password
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    token_prefix VARCHAR(16) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    chatroom_ids INT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS incoming_webhooks (
+    id SERIAL PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    created_by INT NOT NULL,
+    bot_user_id INT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (chatroom_id) REFERENCES Chatrooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES Users(id),
+    FOREIGN KEY (bot_user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_incoming_webhooks_chatroom_id ON incoming_webhooks (chatroom_id);
@@ -0,0 +1,13 @@
+-- Administrators can unlock accounts, the flag is set by hand until there is an admin API
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Failed logins per account name and per client address. Names that do not exist are tracked too,
+-- so lockouts do not reveal which accounts exist.
+CREATE TABLE IF NOT EXISTS login_throttle (
+    key VARCHAR(128) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttle_last_failed_at ON login_throttle (last_failed_at);
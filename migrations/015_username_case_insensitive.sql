@@ -0,0 +1,3 @@
+-- Usernames are unique regardless of case, so "Alice" cannot impersonate "alice". Creating the index fails if such
+-- duplicates already exist, they have to be renamed by hand first.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON Users (lower(username));
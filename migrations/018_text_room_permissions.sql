@@ -0,0 +1,20 @@
+-- Text rooms belong to the user who created them. Rooms from before ownership have no owner and stay editable by
+-- any signed-in user, they have no link key either.
+ALTER TABLE text_rooms ADD COLUMN IF NOT EXISTS owner_id INT REFERENCES Users(id) ON DELETE CASCADE;
+ALTER TABLE text_rooms ADD COLUMN IF NOT EXISTS sharing VARCHAR(16) NOT NULL DEFAULT 'private';
+ALTER TABLE text_rooms ADD COLUMN IF NOT EXISTS link_key VARCHAR(64);
+
+UPDATE text_rooms SET sharing = 'link_editable' WHERE owner_id IS NULL;
+
+-- Named collaborators, in addition to whoever the sharing mode lets in
+CREATE TABLE IF NOT EXISTS text_room_permissions (
+    room_id VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES text_rooms(room_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES Users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_text_room_permissions_user_id ON text_room_permissions (user_id);
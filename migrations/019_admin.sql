@@ -0,0 +1,19 @@
+-- A global role replaces the admin flag from 014
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'is_admin') THEN
+        UPDATE Users SET role = 'admin' WHERE is_admin;
+        ALTER TABLE Users DROP COLUMN is_admin;
+    END IF;
+END $$;
+
+-- Disabled users cannot sign in. Sessions issued before sessions_revoked_at are refused, disabling an account and
+-- resetting its password both set it.
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS sessions_revoked_at TIMESTAMP;
+
+-- Archived chatrooms stay readable but take no new messages
+ALTER TABLE Chatrooms ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
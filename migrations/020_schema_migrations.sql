@@ -0,0 +1,9 @@
+-- Records the migrations applied to the database, readiness checks compare it with the version the servers expect.
+-- Every migration from this one on ends by inserting its own number.
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The schema of a database that got this far includes every earlier migration
+INSERT INTO schema_migrations (version) SELECT generate_series(1, 20) ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,31 @@
+-- Retention policy of a chatroom: messages are kept forever when both limits are NULL, at most one is set.
+-- A legal hold stops the retention janitor from touching the room whatever its policy.
+ALTER TABLE Chatrooms ADD COLUMN IF NOT EXISTS retention_days INT CHECK (retention_days > 0);
+ALTER TABLE Chatrooms ADD COLUMN IF NOT EXISTS retention_messages INT CHECK (retention_messages > 0);
+ALTER TABLE Chatrooms ADD COLUMN IF NOT EXISTS legal_hold_at TIMESTAMP;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chatrooms_single_retention_limit') THEN
+        ALTER TABLE Chatrooms ADD CONSTRAINT chatrooms_single_retention_limit
+            CHECK (retention_days IS NULL OR retention_messages IS NULL);
+    END IF;
+END $$;
+
+-- Expired messages end up here when the janitor archives rather than deletes, attachments are kept as metadata and
+-- their files stay in blob storage
+CREATE TABLE IF NOT EXISTS archived_messages (
+    id INT PRIMARY KEY,
+    chatroom_id INT NOT NULL,
+    user_id INT NOT NULL,
+    parent_id INT,
+    content TEXT NOT NULL,
+    formatted JSONB,
+    attachments JSONB,
+    timestamp TIMESTAMP NOT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_archived_messages_chatroom ON archived_messages (chatroom_id, timestamp);
+
+INSERT INTO schema_migrations (version) VALUES (21) ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,5 @@
+-- Rooms from before ownership have neither an owner nor a link key, so anyone signed in could overwrite them. They
+-- become read-only until an administrator hands them to an owner with the claim-text-room command.
+UPDATE text_rooms SET sharing = 'link_read_only' WHERE owner_id IS NULL AND sharing = 'link_editable';
+
+INSERT INTO schema_migrations (version) VALUES (22) ON CONFLICT (version) DO NOTHING;